@@ -189,20 +189,30 @@ func (a *Admin) QueryMessageByID(id string) (*message.MessageExt, error) {
 
 // MaxOffset fetches the max offset of the consume queue
 func (a *Admin) MaxOffset(q *message.Queue) (int64, error) {
-	addr, err := a.client.FindBrokerAddr(q.BrokerName, rocketmq.MasterID, false)
+	addr, err := a.findBrokerAddr(q)
 	if err != nil {
-		err = a.client.UpdateTopicRouterInfoFromNamesrv(q.Topic)
-		if err != nil {
-			return -1, err
-		}
+		return -1, err
+	}
 
-		addr, err = a.client.FindBrokerAddr(q.BrokerName, rocketmq.MasterID, false)
-		if err != nil {
-			return -1, err
-		}
+	return a.rpc.MaxOffset(addr, q.Topic, uint8(q.QueueID), 3*time.Second)
+}
+
+func (a *Admin) findBrokerAddr(q *message.Queue) (string, error) {
+	addr, err := a.client.FindBrokerAddr(q.BrokerName, rocketmq.MasterID, false)
+	if err == nil {
+		return addr.Addr, nil
 	}
 
-	return a.rpc.MaxOffset(addr.Addr, q.Topic, uint8(q.QueueID), 3*time.Second)
+	err = a.client.UpdateTopicRouterInfoFromNamesrv(q.Topic)
+	if err != nil {
+		return "", err
+	}
+
+	addr, err = a.client.FindBrokerAddr(q.BrokerName, rocketmq.MasterID, false)
+	if err != nil {
+		return "", err
+	}
+	return addr.Addr, nil
 }
 
 // GetConsumerIDs get the consumer ids from the broker
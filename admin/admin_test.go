@@ -50,6 +50,21 @@ func TestAdmin(t *testing.T) {
 
 type mockRPC struct {
 	createTopicErrorCount int
+
+	minOffset    int64
+	minOffsetErr *remote.RPCError
+
+	topicRouters map[string]*route.TopicRouter
+
+	pullHeader   *rpc.PullHeader
+	pullResponse *rpc.PullResponse
+	pullErr      error
+
+	sendAddr     string
+	sendBody     []byte
+	sendHeader   *rpc.SendHeader
+	sendResponse *rpc.SendResponse
+	sendErr      error
 }
 
 func (r *mockRPC) CreateOrUpdateTopic(addr string, header *rpc.CreateOrUpdateTopicHeader, to time.Duration) error {
@@ -70,9 +85,27 @@ func (r *mockRPC) QueryMessageByOffset(addr string, offset int64, timeout time.D
 func (r *mockRPC) MaxOffset(addr, topic string, queueID uint8, timeout time.Duration) (int64, *remote.RPCError) {
 	return maxOffset, nil
 }
+func (r *mockRPC) MinOffset(addr, topic string, queueID uint8, timeout time.Duration) (int64, *remote.RPCError) {
+	return r.minOffset, r.minOffsetErr
+}
 func (r *mockRPC) GetConsumerIDs(addr, group string, timeout time.Duration) ([]string, error) {
 	return nil, nil
 }
+func (r *mockRPC) GetTopicRouteInfo(addr, topic string, timeout time.Duration) (*route.TopicRouter, error) {
+	return r.topicRouters[topic], nil
+}
+func (r *mockRPC) PullMessageSync(addr string, header *rpc.PullHeader, timeout time.Duration) (
+	*rpc.PullResponse, error,
+) {
+	r.pullHeader = header
+	return r.pullResponse, r.pullErr
+}
+func (r *mockRPC) SendMessageSync(addr string, body []byte, header *rpc.SendHeader, timeout time.Duration) (
+	*rpc.SendResponse, error,
+) {
+	r.sendAddr, r.sendBody, r.sendHeader = addr, body, header
+	return r.sendResponse, r.sendErr
+}
 
 type mockMQClient struct {
 	*client.EmptyMQClient
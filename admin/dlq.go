@@ -0,0 +1,230 @@
+package admin
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go"
+	"github.com/zjykzk/rocketmq-client-go/consumer"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+const toolsConsumerGroup = "TOOLS_CONSUMER"
+
+var (
+	errEmptyGroup       = errors.New("empty group")
+	errNotDLQTopic      = errors.New("not the DLQ topic")
+	errTopicNotExist    = errors.New("topic not exist")
+	errNoOriginTopic    = errors.New("no origin topic")
+	errNoWritableQueue  = errors.New("no writable queue")
+	errBadMaxCount      = errors.New("bad max count")
+	errReplayNotSuccess = errors.New("replay not success")
+)
+
+// DLQTopic returns the DLQ topic of the group
+func DLQTopic(group string) string {
+	return rocketmq.DLQGroupTopicPrefix + group
+}
+
+// DLQQueue the queue of the DLQ topic with the offset range of the messages in it
+type DLQQueue struct {
+	message.Queue
+	MinOffset int64
+	MaxOffset int64
+}
+
+// DLQQueues lists the queues of the DLQ topic of the group
+func (a *Admin) DLQQueues(group string) ([]*DLQQueue, error) {
+	if group == "" {
+		return nil, errEmptyGroup
+	}
+
+	topic := DLQTopic(group)
+	router, err := a.topicRouter(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	qs := make([]*DLQQueue, 0, len(router.Queues))
+	for _, tq := range router.Queues {
+		addr := masterAddr(router, tq.BrokerName)
+		if addr == "" {
+			a.Logger.Warnf("no master of broker:%s, topic:%s", tq.BrokerName, topic)
+			continue
+		}
+
+		for i := 0; i < tq.ReadCount; i++ {
+			q := &DLQQueue{Queue: message.Queue{Topic: topic, BrokerName: tq.BrokerName, QueueID: uint8(i)}}
+			minOffset, err := a.rpc.MinOffset(addr, topic, q.QueueID, 3*time.Second)
+			if err != nil {
+				return nil, err
+			}
+			maxOffset, err := a.rpc.MaxOffset(addr, topic, q.QueueID, 3*time.Second)
+			if err != nil {
+				return nil, err
+			}
+			q.MinOffset, q.MaxOffset = minOffset, maxOffset
+			qs = append(qs, q)
+		}
+	}
+	return qs, nil
+}
+
+// BrowseDLQ returns at most maxCount messages from the offset in the queue of the DLQ topic,
+// and the offset of the next page
+func (a *Admin) BrowseDLQ(q *message.Queue, offset int64, maxCount int) (
+	msgs []*message.MessageExt, nextOffset int64, err error,
+) {
+	if !strings.HasPrefix(q.Topic, rocketmq.DLQGroupTopicPrefix) {
+		return nil, offset, errNotDLQTopic
+	}
+
+	if maxCount <= 0 {
+		return nil, offset, errBadMaxCount
+	}
+
+	addr, err := a.findBrokerAddr(q)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	pr, err := a.rpc.PullMessageSync(addr, &rpc.PullHeader{
+		ConsumerGroup:  toolsConsumerGroup,
+		Topic:          q.Topic,
+		QueueID:        q.QueueID,
+		QueueOffset:    offset,
+		MaxCount:       int32(maxCount),
+		SysFlag:        consumer.PullSubscribe,
+		Subscription:   "*",
+		ExpressionType: consumer.ExprTypeTag,
+	}, 3*time.Second)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	if pr.Code == rpc.Success {
+		msgs = pr.Messages
+	}
+	return msgs, pr.NextBeginOffset, nil
+}
+
+// ReplayDLQMessage sends the message in the DLQ topic to its origin topic,
+// returns the id of the message sent
+func (a *Admin) ReplayDLQMessage(m *message.MessageExt) (string, error) {
+	topic := m.GetProperty(message.PropertyRetryTopic)
+	if topic == "" {
+		return "", errNoOriginTopic
+	}
+
+	router, err := a.topicRouter(topic)
+	if err != nil {
+		return "", err
+	}
+
+	q, addr := selectWritableQueue(router)
+	if addr == "" {
+		return "", errNoWritableQueue
+	}
+
+	properties := make(map[string]string, len(m.Properties))
+	for k, v := range m.Properties {
+		properties[k] = v
+	}
+	for _, k := range []string{
+		message.PropertyRetryTopic,
+		message.PropertyDelayTimeLevel,
+		message.PropertyReconsumeTime,
+		message.PropertyMaxReconsumeTimes,
+		message.PropertyRealTopic,
+		message.PropertyRealQueueID,
+	} {
+		delete(properties, k)
+	}
+	if properties[message.PropertyOriginMessageID] == "" {
+		properties[message.PropertyOriginMessageID] = m.MsgID
+	}
+	properties[message.PropertyUniqClientMessageIDKeyidx] = message.CreateUniqID()
+
+	resp, err := a.rpc.SendMessageSync(addr, m.Body, &rpc.SendHeader{
+		Group:                 a.GroupName,
+		Topic:                 topic,
+		DefaultTopic:          rocketmq.DefaultTopic,
+		DefaultTopicQueueNums: 4,
+		QueueID:               q.QueueID,
+		BornTimestamp:         rocketmq.UnixMilli(),
+		Flag:                  m.Flag,
+		Properties:            message.Properties2String(properties),
+	}, 3*time.Second)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.Code {
+	case rpc.Success, rpc.FlushDiskTimeout, rpc.FlushSlaveTimeout, rpc.SlaveNotAvailable:
+		return properties[message.PropertyUniqClientMessageIDKeyidx], nil
+	default:
+		a.Logger.Errorf("replay message:%s, code:%d, error:%s", m.MsgID, resp.Code, resp.Message)
+		return "", errReplayNotSuccess
+	}
+}
+
+func (a *Admin) topicRouter(topic string) (router *route.TopicRouter, err error) {
+	l := len(a.NameServerAddrs)
+	for i, c := rand.Intn(l), l; c > 0; i, c = i+1, c-1 {
+		addr := a.NameServerAddrs[i%l]
+		router, err = a.rpc.GetTopicRouteInfo(addr, topic, 3*time.Second)
+		if err == nil {
+			break
+		}
+
+		a.Logger.Errorf("request topic %s router from %s, error:%s", topic, addr, err)
+	}
+
+	if err == nil && router == nil {
+		err = errTopicNotExist
+	}
+	return
+}
+
+func masterAddr(router *route.TopicRouter, broker string) string {
+	for _, b := range router.Brokers {
+		if b.Name == broker {
+			return b.Addresses[rocketmq.MasterID]
+		}
+	}
+	return ""
+}
+
+func selectWritableQueue(router *route.TopicRouter) (q *message.Queue, addr string) {
+	type writableQueue struct {
+		q    *message.Queue
+		addr string
+	}
+
+	var qs []writableQueue
+	for _, tq := range router.Queues {
+		if !route.IsWritable(tq.Perm) {
+			continue
+		}
+
+		addr := masterAddr(router, tq.BrokerName)
+		if addr == "" {
+			continue
+		}
+
+		for i := 0; i < tq.WriteCount; i++ {
+			qs = append(qs, writableQueue{&message.Queue{BrokerName: tq.BrokerName, QueueID: uint8(i)}, addr})
+		}
+	}
+
+	if len(qs) == 0 {
+		return nil, ""
+	}
+
+	wq := qs[rand.Intn(len(qs))]
+	return wq.q, wq.addr
+}
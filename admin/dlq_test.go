@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/consumer"
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+func newTestDLQAdmin() (*Admin, *mockRPC) {
+	r := &mockRPC{topicRouters: map[string]*route.TopicRouter{
+		DLQTopic("g"): &route.TopicRouter{
+			Queues: []*route.TopicQueue{
+				&route.TopicQueue{BrokerName: "b1", ReadCount: 1, WriteCount: 1, Perm: route.PermRead},
+				&route.TopicQueue{BrokerName: "b2", ReadCount: 1, WriteCount: 1, Perm: route.PermRead},
+				&route.TopicQueue{BrokerName: "no master", ReadCount: 1, WriteCount: 1},
+			},
+			Brokers: []*route.Broker{
+				&route.Broker{Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+				&route.Broker{Name: "b2", Addresses: map[int32]string{0: "b2 addr"}},
+				&route.Broker{Name: "no master", Addresses: map[int32]string{1: "slave"}},
+			},
+		},
+		"origin": &route.TopicRouter{
+			Queues: []*route.TopicQueue{
+				&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermRead},
+				&route.TopicQueue{BrokerName: "b2", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+			},
+			Brokers: []*route.Broker{
+				&route.Broker{Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+				&route.Broker{Name: "b2", Addresses: map[int32]string{0: "b2 addr"}},
+			},
+		},
+	}}
+
+	a := NewAdmin([]string{"namesrv"}, &log.MockLogger{})
+	a.rpc = r
+	a.client = &mockMQClient{mockBrokerAddrs: map[string]string{"b1": "b1 addr"}}
+	return a, r
+}
+
+func TestDLQQueues(t *testing.T) {
+	a, r := newTestDLQAdmin()
+
+	_, err := a.DLQQueues("")
+	assert.Equal(t, errEmptyGroup, err)
+
+	_, err = a.DLQQueues("not exist")
+	assert.Equal(t, errTopicNotExist, err)
+
+	r.minOffset = 10
+	qs, err := a.DLQQueues("g")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(qs))
+	for i, b := range []string{"b1", "b2"} {
+		assert.Equal(t, message.Queue{Topic: DLQTopic("g"), BrokerName: b}, qs[i].Queue)
+		assert.Equal(t, int64(10), qs[i].MinOffset)
+		assert.Equal(t, maxOffset, qs[i].MaxOffset)
+	}
+
+	r.minOffsetErr = &remote.RPCError{Code: -1, Message: "bad min offset"}
+	_, err = a.DLQQueues("g")
+	assert.Equal(t, r.minOffsetErr, err)
+}
+
+func TestBrowseDLQ(t *testing.T) {
+	a, r := newTestDLQAdmin()
+	q := &message.Queue{Topic: DLQTopic("g"), BrokerName: "b1"}
+
+	_, _, err := a.BrowseDLQ(&message.Queue{Topic: "origin", BrokerName: "b1"}, 0, 1)
+	assert.Equal(t, errNotDLQTopic, err)
+
+	_, _, err = a.BrowseDLQ(q, 0, 0)
+	assert.Equal(t, errBadMaxCount, err)
+
+	r.pullErr = errors.New("bad pull")
+	_, next, err := a.BrowseDLQ(q, 3, 1)
+	assert.Equal(t, r.pullErr, err)
+	assert.Equal(t, int64(3), next)
+	r.pullErr = nil
+
+	r.pullResponse = &rpc.PullResponse{
+		Code:            rpc.Success,
+		NextBeginOffset: 5,
+		Messages:        []*message.MessageExt{{QueueOffset: 3}, {QueueOffset: 4}},
+	}
+	msgs, next, err := a.BrowseDLQ(q, 3, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, int64(5), next)
+	assert.Equal(t, toolsConsumerGroup, r.pullHeader.ConsumerGroup)
+	assert.Equal(t, q.Topic, r.pullHeader.Topic)
+	assert.Equal(t, int64(3), r.pullHeader.QueueOffset)
+	assert.Equal(t, int32(2), r.pullHeader.MaxCount)
+	assert.Equal(t, int32(consumer.PullSubscribe), r.pullHeader.SysFlag)
+
+	// no more message
+	r.pullResponse = &rpc.PullResponse{Code: rpc.PullNotFound, NextBeginOffset: 5}
+	msgs, next, err = a.BrowseDLQ(q, 5, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(msgs))
+	assert.Equal(t, int64(5), next)
+}
+
+func TestReplayDLQMessage(t *testing.T) {
+	a, r := newTestDLQAdmin()
+	m := &message.MessageExt{
+		Message: message.Message{
+			Topic: DLQTopic("g"),
+			Body:  []byte("dlq"),
+			Flag:  3,
+			Properties: map[string]string{
+				message.PropertyTags:              "tag",
+				message.PropertyReconsumeTime:     "16",
+				message.PropertyMaxReconsumeTimes: "16",
+				message.PropertyDelayTimeLevel:    "3",
+			},
+		},
+		MsgID: "msgid",
+	}
+
+	_, err := a.ReplayDLQMessage(m)
+	assert.Equal(t, errNoOriginTopic, err)
+
+	m.PutProperty(message.PropertyRetryTopic, "not exist")
+	_, err = a.ReplayDLQMessage(m)
+	assert.Equal(t, errTopicNotExist, err)
+
+	m.PutProperty(message.PropertyRetryTopic, "origin")
+	r.sendErr = errors.New("bad send")
+	_, err = a.ReplayDLQMessage(m)
+	assert.Equal(t, r.sendErr, err)
+	r.sendErr = nil
+
+	r.sendResponse = &rpc.SendResponse{Code: rpc.Success}
+	id, err := a.ReplayDLQMessage(m)
+	assert.Nil(t, err)
+	assert.True(t, id != "")
+	assert.Equal(t, "b2 addr", r.sendAddr)
+	assert.Equal(t, m.Body, r.sendBody)
+	h := r.sendHeader
+	assert.Equal(t, "origin", h.Topic)
+	assert.Equal(t, m.Flag, h.Flag)
+	assert.Equal(t, a.GroupName, h.Group)
+	props := message.String2Properties(h.Properties)
+	assert.Equal(t, map[string]string{
+		message.PropertyTags:                      "tag",
+		message.PropertyOriginMessageID:           "msgid",
+		message.PropertyUniqClientMessageIDKeyidx: id,
+	}, props)
+	assert.Equal(t, "origin", m.GetProperty(message.PropertyRetryTopic))
+
+	r.sendResponse = &rpc.SendResponse{Code: rpc.SystemError}
+	_, err = a.ReplayDLQMessage(m)
+	assert.Equal(t, errReplayNotSuccess, err)
+
+	r.topicRouters["origin"].Queues[1].Perm = route.PermRead
+	_, err = a.ReplayDLQMessage(m)
+	assert.Equal(t, errNoWritableQueue, err)
+}
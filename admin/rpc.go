@@ -16,5 +16,11 @@ type rpcI interface {
 	GetBrokerClusterInfo(addr string, timeout time.Duration) (*route.ClusterInfo, error)
 	QueryMessageByOffset(addr string, offset int64, timeout time.Duration) (*message.MessageExt, error)
 	MaxOffset(addr, topic string, queueID uint8, timeout time.Duration) (int64, *remote.RPCError)
+	MinOffset(addr, topic string, queueID uint8, timeout time.Duration) (int64, *remote.RPCError)
 	GetConsumerIDs(addr, group string, timeout time.Duration) ([]string, error)
+	GetTopicRouteInfo(addr, topic string, timeout time.Duration) (*route.TopicRouter, error)
+	PullMessageSync(addr string, header *rpc.PullHeader, timeout time.Duration) (*rpc.PullResponse, error)
+	SendMessageSync(addr string, body []byte, header *rpc.SendHeader, timeout time.Duration) (
+		*rpc.SendResponse, error,
+	)
 }
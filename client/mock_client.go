@@ -27,6 +27,9 @@ func (c *EmptyMQClient) FindBrokerAddr(brokerName string, hintBrokerID int32, lo
 func (c *EmptyMQClient) FindAnyBrokerAddr(brokerName string) (*FindBrokerResult, error) {
 	return nil, nil
 }
+func (c *EmptyMQClient) FindAllBrokerAddrs(brokerName string) []*FindBrokerResult {
+	return nil
+}
 func (c *EmptyMQClient) FindMasterBrokerAddr(brokerName string) (string, error) {
 	return "", nil
 }
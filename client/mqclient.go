@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/zjykzk/rocketmq-client-go"
 	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
 	"github.com/zjykzk/rocketmq-client-go/remote"
 	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 	"github.com/zjykzk/rocketmq-client-go/route"
@@ -36,6 +38,7 @@ type MQClient interface {
 	GetMasterBrokerAddrs() []string
 	FindBrokerAddr(brokerName string, hintBrokerID int32, lock bool) (*FindBrokerResult, error)
 	FindAnyBrokerAddr(brokerName string) (*FindBrokerResult, error)
+	FindAllBrokerAddrs(brokerName string) []*FindBrokerResult
 	RemotingClient() remote.Client
 	SendHeartbeat()
 }
@@ -88,6 +91,7 @@ var mqClients = mqClientColl{
 
 var errEmptyClientID = errors.New("empty client id")
 var errEmptyNameSrvAddress = errors.New("empty name server address")
+var errEmptyMessage = errors.New("empty message")
 
 func newMQClient(config *Config, clientID string, logger log.Logger) MQClient {
 	c := &mqClient{
@@ -340,6 +344,23 @@ func (c *mqClient) FindAnyBrokerAddr(brokerName string) (
 	}, nil
 }
 
+// FindAllBrokerAddrs returns all the brokers whose name is the specified name, sorted by the broker id,
+// so the master is the first one if exists
+func (c *mqClient) FindAllBrokerAddrs(brokerName string) []*FindBrokerResult {
+	addrs := c.brokerAddrs.brokerAddrs(brokerName)
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].brokerID < addrs[j].brokerID })
+
+	rs := make([]*FindBrokerResult, len(addrs))
+	for i, a := range addrs {
+		rs[i] = &FindBrokerResult{
+			Addr:    a.addr,
+			IsSlave: a.brokerID != rocketmq.MasterID,
+			Version: c.brokerVersions.get(brokerName, a.addr),
+		}
+	}
+	return rs
+}
+
 func (c *mqClient) getTopicRouteInfo(topic string) (*route.TopicRouter, error) {
 	var err error
 	l := len(c.NameServerAddrs)
@@ -588,8 +609,11 @@ func (c *mqClient) processRequest(ctx *remote.ChannelContext, cmd *remote.Comman
 			co.ReblanceQueue()
 		}
 	case rpc.CheckTransactionState:
+		c.checkTransactionState(ctx.Address, cmd)
 	case rpc.ResetConsumerClientOffset:
+		c.resetOffset(cmd)
 	case rpc.GetConsumerStatusFromClient:
+		c.getConsumerStatus(ctx.Address, cmd)
 	case rpc.GetConsumerRunningInfo:
 		group := cmd.ExtFields["consumerGroup"]
 		co := c.consumers.get(group)
@@ -603,9 +627,10 @@ func (c *mqClient) processRequest(ctx *remote.ChannelContext, cmd *remote.Comman
 			cmd.Code = rpc.Success
 			cmd.Remark = ""
 		}
-		cmd, err := c.Client.RequestSync(ctx.Address, cmd, time.Second)
+		err := c.response(ctx.Address, cmd)
 		c.logger.Debugf("GetConsumerRunningInfo result:%s, err:%v", cmd, err)
 	case rpc.ConsumeMessageDirectly:
+		c.consumeMessageDirectly(ctx.Address, cmd)
 	default:
 		return false
 	}
@@ -613,6 +638,132 @@ func (c *mqClient) processRequest(ctx *remote.ChannelContext, cmd *remote.Comman
 	return true
 }
 
+// response sends the command as the response of the request from the broker
+func (c *mqClient) response(addr string, cmd *remote.Command) error {
+	cmd.MarkResponseType()
+	return c.Client.RequestOneway(addr, cmd)
+}
+
+// resetOffset resets the consume offsets of the consumer, the request is sent by the broker oneway
+func (c *mqClient) resetOffset(cmd *remote.Command) {
+	header, err := rpc.ParseResetOffsetHeader(cmd)
+	if err != nil {
+		c.logger.Errorf("parse reset offset header error:%s", err)
+		return
+	}
+
+	offsets, err := rpc.ParseResetOffsetBody(cmd.Body)
+	if err != nil {
+		c.logger.Errorf("parse reset offset body error:%s", err)
+		return
+	}
+
+	co := c.consumers.get(header.Group)
+	if co == nil {
+		c.logger.Errorf("reset offset, no consumer of group:%s", header.Group)
+		return
+	}
+
+	c.logger.Infof("reset offset of group:%s, topic:%s, offsets:%v", header.Group, header.Topic, offsets)
+	co.ResetOffset(header.Topic, offsets)
+}
+
+// getConsumerStatus responses the consume offsets of the consumer
+func (c *mqClient) getConsumerStatus(addr string, cmd *remote.Command) {
+	header := rpc.ParseConsumerStatusHeader(cmd)
+	co := c.consumers.get(header.Group)
+	if co == nil {
+		c.logger.Errorf("get consumer status, no consumer of group:%s", header.Group)
+		cmd.Code = rpc.SystemError
+		cmd.Remark = fmt.Sprintf("The Consumer Group <%s> not exist in this consumer", header.Group)
+		cmd.Body = nil
+	} else {
+		body, err := rpc.EncodeConsumerStatusBody(co.ConsumeOffsets(header.Topic))
+		if err != nil {
+			c.logger.Errorf("encode consumer status error:%s", err)
+			cmd.Code = rpc.SystemError
+			cmd.Remark = err.Error()
+		} else {
+			cmd.Code = rpc.Success
+			cmd.Remark = ""
+		}
+		cmd.Body = body
+	}
+
+	if err := c.response(addr, cmd); err != nil {
+		c.logger.Errorf("response the consumer status error:%s", err)
+	}
+}
+
+// consumeMessageDirectly consumes the message in the request, and responses the result
+func (c *mqClient) consumeMessageDirectly(addr string, cmd *remote.Command) {
+	header := rpc.ParseConsumeMessageDirectlyHeader(cmd)
+	body, err := c.consumeMessageDirectly0(header, cmd.Body)
+	if err != nil {
+		c.logger.Errorf("consume message:%s directly error:%s", header.MsgID, err)
+		cmd.Code = rpc.SystemError
+		cmd.Remark = err.Error()
+	} else {
+		cmd.Code = rpc.Success
+		cmd.Remark = ""
+	}
+	cmd.Body = body
+
+	if err := c.response(addr, cmd); err != nil {
+		c.logger.Errorf("response the result of consuming message directly error:%s", err)
+	}
+}
+
+func (c *mqClient) consumeMessageDirectly0(
+	header *rpc.ConsumeMessageDirectlyHeader, body []byte,
+) (
+	[]byte, error,
+) {
+	co := c.consumers.get(header.Group)
+	if co == nil {
+		return nil, fmt.Errorf("The Consumer Group <%s> not exist in this consumer", header.Group)
+	}
+
+	msgs, err := message.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msgs) == 0 {
+		return nil, errEmptyMessage
+	}
+
+	r, err := co.ConsumeMessageDirectly(msgs[0], header.BrokerName)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(r)
+}
+
+func (c *mqClient) checkTransactionState(addr string, cmd *remote.Command) {
+	header, err := rpc.ParseCheckTransactionStateHeader(cmd)
+	if err != nil {
+		c.logger.Errorf("parse check transaction state header error:%s", err)
+		return
+	}
+
+	msgs, err := message.Decode(cmd.Body)
+	if err != nil || len(msgs) == 0 {
+		c.logger.Errorf("decode message of checking transaction state error:%v", err)
+		return
+	}
+
+	m := msgs[0]
+	group := m.GetProperty(message.PropertyProducerGroup)
+	p := c.producers.get(group)
+	if p == nil {
+		c.logger.Errorf("no producer of group:%s", group)
+		return
+	}
+
+	p.CheckTransactionState(addr, m, header)
+}
+
 func (c *mqClient) RemotingClient() remote.Client {
 	return c.Client
 }
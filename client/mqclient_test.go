@@ -1,13 +1,17 @@
 package client
 
 import (
+	"encoding/binary"
 	"errors"
 	"sort"
 	"testing"
 	"time"
 
+	"github.com/zjykzk/rocketmq-client-go/buf"
 	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
 	"github.com/zjykzk/rocketmq-client-go/remote"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -40,10 +44,10 @@ func TestMQClient(t *testing.T) {
 
 	t.Run("[un]register consumer", func(t *testing.T) {
 		assert.NotNil(t, client.RegisterConsumer(&mockConsumer{}))
-		assert.Nil(t, client.RegisterConsumer(&mockConsumer{"group"}))
-		assert.NotNil(t, client.RegisterConsumer(&mockConsumer{"group"}))
+		assert.Nil(t, client.RegisterConsumer(&mockConsumer{group: "group"}))
+		assert.NotNil(t, client.RegisterConsumer(&mockConsumer{group: "group"}))
 		assert.Equal(t, 1, client.ConsumerCount())
-		assert.Nil(t, client.RegisterConsumer(&mockConsumer{"1group"}))
+		assert.Nil(t, client.RegisterConsumer(&mockConsumer{group: "1group"}))
 		assert.Equal(t, 2, client.ConsumerCount())
 
 		client.UnregisterConsumer("group")
@@ -83,7 +87,7 @@ func TestMQClient(t *testing.T) {
 			t.Fatal(err)
 		}
 		err = client1.RegisterProducer(&mockProducer{"p1"})
-		mc := &mockConsumer{"c0"}
+		mc := &mockConsumer{group: "c0"}
 		client1.RegisterConsumer(mc)
 
 		hd := client1.(*mqClient).prepareHeartbeatData()
@@ -130,6 +134,14 @@ func TestMQClient(t *testing.T) {
 		assert.NotNil(t, err)
 		_, err = impl.FindBrokerAddr("b0", 3, true)
 		assert.NotNil(t, err)
+
+		impl.brokerAddrs.put("b3", map[int32]string{2: "slave2", 0: "master3", 1: "slave1"})
+		rs := impl.FindAllBrokerAddrs("b3")
+		assert.Equal(t, 3, len(rs))
+		assert.Equal(t, &FindBrokerResult{Addr: "master3"}, rs[0])
+		assert.Equal(t, &FindBrokerResult{Addr: "slave1", IsSlave: true}, rs[1])
+		assert.Equal(t, &FindBrokerResult{Addr: "slave2", IsSlave: true}, rs[2])
+		assert.Equal(t, 0, len(impl.FindAllBrokerAddrs("b0")))
 	})
 
 	t.Run("update topic router from namesrv", func(t *testing.T) {
@@ -167,6 +179,9 @@ type mockRemoteClient struct {
 
 	requestSyncErr error
 	command        remote.Command
+
+	onewayAddr    string
+	onewayCommand *remote.Command
 }
 
 func (m *mockRemoteClient) RequestSync(addr string, cmd *remote.Command, timeout time.Duration) (
@@ -174,3 +189,234 @@ func (m *mockRemoteClient) RequestSync(addr string, cmd *remote.Command, timeout
 ) {
 	return &m.command, m.requestSyncErr
 }
+
+func (m *mockRemoteClient) RequestOneway(addr string, cmd *remote.Command) error {
+	m.onewayAddr, m.onewayCommand = addr, cmd
+	return nil
+}
+
+type checkTransactionProducer struct {
+	*mockProducer
+
+	addr   string
+	m      *message.MessageExt
+	header *rpc.CheckTransactionStateHeader
+}
+
+func (p *checkTransactionProducer) CheckTransactionState(
+	addr string, m *message.MessageExt, header *rpc.CheckTransactionStateHeader,
+) {
+	p.addr, p.m, p.header = addr, m, header
+}
+
+func encodeStoredMessage(m *message.MessageExt) []byte {
+	properties := message.Properties2String(m.Properties)
+	bb := buf.NewByteBuffer(binary.BigEndian)
+	bb.PutInt32(int32(message.BodySizePosition + 4 + len(m.Body) + 1 + len(m.Topic) + 2 + len(properties)))
+	bb.PutUint32(message.MagicCode)
+	bb.PutInt32(m.BodyCRC)
+	bb.PutInt32(int32(m.QueueID))
+	bb.PutInt32(m.Flag)
+	bb.PutInt64(m.QueueOffset)
+	bb.PutInt64(m.CommitLogOffset)
+	bb.PutInt32(m.SysFlag)
+	bb.PutInt64(m.BornTimestamp)
+	bb.PutBytes(m.BornHost.Host)
+	bb.PutInt32(int32(m.BornHost.Port))
+	bb.PutInt64(m.StoreTimestamp)
+	bb.PutBytes(m.StoreHost.Host)
+	bb.PutInt32(int32(m.StoreHost.Port))
+	bb.PutInt32(m.ReconsumeTimes)
+	bb.PutInt64(m.PreparedTransactionOffset)
+	bb.PutInt32(int32(len(m.Body)))
+	bb.PutBytes(m.Body)
+	bb.PutInt8(int8(len(m.Topic)))
+	bb.PutBytes([]byte(m.Topic))
+	bb.PutInt16(int16(len(properties)))
+	bb.PutBytes([]byte(properties))
+	return bb.Bytes()
+}
+
+func TestCheckTransactionState(t *testing.T) {
+	c := newMQClient(
+		&Config{NameServerAddrs: []string{"addr"}}, "check transaction", &log.MockLogger{},
+	).(*mqClient)
+	p := &checkTransactionProducer{mockProducer: &mockProducer{"tp"}}
+	c.RegisterProducer(p)
+
+	m := &message.MessageExt{
+		Message: message.Message{
+			Topic: "transaction",
+			Body:  []byte("transaction body"),
+			Properties: map[string]string{
+				message.PropertyProducerGroup: "tp",
+			},
+		},
+		BornHost:        message.Addr{Host: []byte{127, 0, 0, 1}, Port: 1},
+		StoreHost:       message.Addr{Host: []byte{127, 0, 0, 2}, Port: 2},
+		CommitLogOffset: 100,
+	}
+	cmd := &remote.Command{
+		Code: rpc.CheckTransactionState,
+		ExtFields: map[string]string{
+			"tranStateTableOffset": "12",
+			"commitLogOffset":      "100",
+			"msgId":                "msg id",
+			"transactionId":        "tid",
+			"offsetMsgId":          "offset msg id",
+		},
+		Body: encodeStoredMessage(m),
+	}
+	ctx := &remote.ChannelContext{Address: "broker addr"}
+
+	// ok
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, "broker addr", p.addr)
+	assert.Equal(t, m.Topic, p.m.Topic)
+	assert.Equal(t, m.Body, p.m.Body)
+	assert.Equal(t, m.CommitLogOffset, p.m.CommitLogOffset)
+	assert.Equal(t, &rpc.CheckTransactionStateHeader{
+		TranStateTableOffset: 12,
+		CommitLogOffset:      100,
+		MsgID:                "msg id",
+		TransactionID:        "tid",
+		OffsetMsgID:          "offset msg id",
+	}, p.header)
+
+	// no producer
+	p.m = nil
+	m.Properties[message.PropertyProducerGroup] = "not exist"
+	cmd.Body = encodeStoredMessage(m)
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Nil(t, p.m)
+
+	// bad header
+	cmd.ExtFields["commitLogOffset"] = "bad"
+	m.Properties[message.PropertyProducerGroup] = "tp"
+	cmd.Body = encodeStoredMessage(m)
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Nil(t, p.m)
+}
+
+func TestResetOffset(t *testing.T) {
+	c := newMQClient(
+		&Config{NameServerAddrs: []string{"addr"}}, "reset offset", &log.MockLogger{},
+	).(*mqClient)
+	co := &mockConsumer{group: "g"}
+	c.RegisterConsumer(co)
+	ctx := &remote.ChannelContext{Address: "broker addr"}
+
+	cmd := &remote.Command{
+		Code:      rpc.ResetConsumerClientOffset,
+		ExtFields: map[string]string{"topic": "t", "group": "g", "timestamp": "1"},
+		Body:      []byte(`{"offsetTable":{{"brokerName":"b","queueId":1,"topic":"t"}:10}}`),
+	}
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, "t", co.resetTopic)
+	assert.Equal(t, map[message.Queue]int64{{Topic: "t", BrokerName: "b", QueueID: 1}: 10}, co.resetOffsets)
+
+	// bad body
+	co.resetOffsets = nil
+	cmd.Body = []byte(`{"offsetTable":{`)
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Nil(t, co.resetOffsets)
+
+	// no consumer
+	cmd.Body = []byte(`{"offsetTable":{}}`)
+	cmd.ExtFields["group"] = "not exist"
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Nil(t, co.resetOffsets)
+}
+
+func TestGetConsumerStatus(t *testing.T) {
+	c := newMQClient(
+		&Config{NameServerAddrs: []string{"addr"}}, "consumer status", &log.MockLogger{},
+	).(*mqClient)
+	remoteClient := &mockRemoteClient{}
+	c.Client = remoteClient
+	co := &mockConsumer{
+		group:          "g",
+		consumeOffsets: map[message.Queue]int64{{Topic: "t", BrokerName: "b", QueueID: 1}: 10},
+	}
+	c.RegisterConsumer(co)
+	ctx := &remote.ChannelContext{Address: "broker addr"}
+
+	cmd := &remote.Command{
+		Code:      rpc.GetConsumerStatusFromClient,
+		Opaque:    12,
+		ExtFields: map[string]string{"topic": "t", "group": "g"},
+	}
+	assert.True(t, c.processRequest(ctx, cmd))
+	resp := remoteClient.onewayCommand
+	assert.Equal(t, "broker addr", remoteClient.onewayAddr)
+	assert.Equal(t, rpc.Success, resp.Code)
+	assert.Equal(t, int32(12), resp.Opaque)
+	assert.Equal(t, int32(1), resp.Flag&1)
+	assert.Equal(t,
+		`{"messageQueueTable":{{"topic":"t","brokerName":"b","queueId":1}:10},"consumerTable":{}}`,
+		string(resp.Body),
+	)
+
+	// no consumer
+	cmd = &remote.Command{
+		Code:      rpc.GetConsumerStatusFromClient,
+		ExtFields: map[string]string{"topic": "t", "group": "not exist"},
+	}
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, rpc.SystemError, remoteClient.onewayCommand.Code)
+}
+
+func TestConsumeMessageDirectly(t *testing.T) {
+	c := newMQClient(
+		&Config{NameServerAddrs: []string{"addr"}}, "consume directly", &log.MockLogger{},
+	).(*mqClient)
+	remoteClient := &mockRemoteClient{}
+	c.Client = remoteClient
+	co := &mockConsumer{
+		group:        "g",
+		directResult: &rpc.ConsumeMessageDirectlyResult{ConsumeResult: rpc.ConsumeSuccess, SpentTimeMills: 2},
+	}
+	c.RegisterConsumer(co)
+	ctx := &remote.ChannelContext{Address: "broker addr"}
+
+	m := &message.MessageExt{
+		Message:   message.Message{Topic: "direct", Body: []byte("direct body")},
+		BornHost:  message.Addr{Host: []byte{127, 0, 0, 1}, Port: 1},
+		StoreHost: message.Addr{Host: []byte{127, 0, 0, 2}, Port: 2},
+	}
+	cmd := &remote.Command{
+		Code:      rpc.ConsumeMessageDirectly,
+		ExtFields: map[string]string{"consumerGroup": "g", "brokerName": "b", "msgId": "id"},
+		Body:      encodeStoredMessage(m),
+	}
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, "b", co.directBroker)
+	assert.Equal(t, m.Body, co.directMessage.Body)
+	resp := remoteClient.onewayCommand
+	assert.Equal(t, rpc.Success, resp.Code)
+	assert.Equal(t,
+		`{"order":false,"autoCommit":false,"consumeResult":"CR_SUCCESS","remark":"","spentTimeMills":2}`,
+		string(resp.Body),
+	)
+
+	// consume error
+	co.directErr = errors.New("not supported")
+	cmd.Code, cmd.Body = rpc.ConsumeMessageDirectly, encodeStoredMessage(m)
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, rpc.SystemError, remoteClient.onewayCommand.Code)
+	assert.Equal(t, "not supported", remoteClient.onewayCommand.Remark)
+
+	// bad message
+	co.directErr, co.directMessage = nil, nil
+	cmd.Code, cmd.Body = rpc.ConsumeMessageDirectly, []byte("bad")
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, rpc.SystemError, remoteClient.onewayCommand.Code)
+	assert.Nil(t, co.directMessage)
+
+	// no consumer
+	cmd.ExtFields["consumerGroup"] = "not exist"
+	cmd.Code, cmd.Body = rpc.ConsumeMessageDirectly, encodeStoredMessage(m)
+	assert.True(t, c.processRequest(ctx, cmd))
+	assert.Equal(t, rpc.SystemError, remoteClient.onewayCommand.Code)
+	assert.Nil(t, co.directMessage)
+}
@@ -3,6 +3,8 @@ package client
 import (
 	"sync"
 
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 	"github.com/zjykzk/rocketmq-client-go/route"
 )
 
@@ -12,6 +14,7 @@ type producer interface {
 	PublishTopics() []string
 	UpdateTopicPublish(topic string, router *route.TopicRouter)
 	NeedUpdateTopicPublish(topic string) bool
+	CheckTransactionState(addr string, m *message.MessageExt, header *rpc.CheckTransactionStateHeader)
 }
 
 type producerColl struct {
@@ -41,6 +44,13 @@ func (pc *producerColl) putIfAbsent(group string, p producer) (prev producer, su
 	return
 }
 
+func (pc *producerColl) get(group string) producer {
+	pc.RLock()
+	p := pc.eles[group]
+	pc.RUnlock()
+	return p
+}
+
 func (pc *producerColl) contains(group string) bool {
 	pc.RLock()
 	_, b := pc.eles[group]
@@ -66,7 +76,18 @@ type RunningInfo struct {
 	Properties    map[string]string `json:"properties"`
 	Subscriptions []*Data           `json:"subscriptionSet"`
 	// MQTable map[string]*ProcessQueueInfo TODO
-	// Statuses map[string]ConsumerStatus TODO
+	Statuses map[string]ConsumeStatus `json:"statusTable"` // key: topic
+}
+
+// ConsumeStatus the statistics of pulling & consuming the messages of one topic in the last minute
+// the RT is in millisecond
+type ConsumeStatus struct {
+	PullRT            float64 `json:"pullRT"`
+	PullTPS           float64 `json:"pullTPS"`
+	ConsumeRT         float64 `json:"consumeRT"`
+	ConsumeOKTPS      float64 `json:"consumeOKTPS"`
+	ConsumeFailedTPS  float64 `json:"consumeFailedTPS"`
+	ConsumeFailedMsgs int64   `json:"consumeFailedMsgs"` // in the last hour
 }
 
 // consumer interface needed by reblance
@@ -82,6 +103,9 @@ type consumer interface {
 	Subscriptions() []*Data
 	ReblanceQueue()
 	RunningInfo() RunningInfo
+	ResetOffset(topic string, offsets map[message.Queue]int64)
+	ConsumeOffsets(topic string) map[message.Queue]int64
+	ConsumeMessageDirectly(m *message.MessageExt, broker string) (*rpc.ConsumeMessageDirectlyResult, error)
 }
 
 type consumerColl struct {
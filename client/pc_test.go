@@ -5,6 +5,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 	"github.com/zjykzk/rocketmq-client-go/route"
 )
 
@@ -26,6 +28,11 @@ func (mp *mockProducer) NeedUpdateTopicPublish(topic string) bool {
 	return false
 }
 
+func (mp *mockProducer) CheckTransactionState(
+	addr string, m *message.MessageExt, header *rpc.CheckTransactionStateHeader,
+) {
+}
+
 func TestProducerColl(t *testing.T) {
 	group := "g1"
 	pc := producerColl{eles: make(map[string]producer)}
@@ -48,6 +55,15 @@ func TestProducerColl(t *testing.T) {
 
 type mockConsumer struct {
 	group string
+
+	resetTopic     string
+	resetOffsets   map[message.Queue]int64
+	consumeOffsets map[message.Queue]int64
+
+	directMessage *message.MessageExt
+	directBroker  string
+	directResult  *rpc.ConsumeMessageDirectlyResult
+	directErr     error
 }
 
 func (mc *mockConsumer) Group() string {
@@ -81,6 +97,18 @@ func (mc *mockConsumer) ReblanceQueue() {}
 func (mc *mockConsumer) RunningInfo() RunningInfo {
 	return RunningInfo{}
 }
+func (mc *mockConsumer) ResetOffset(topic string, offsets map[message.Queue]int64) {
+	mc.resetTopic, mc.resetOffsets = topic, offsets
+}
+func (mc *mockConsumer) ConsumeOffsets(topic string) map[message.Queue]int64 {
+	return mc.consumeOffsets
+}
+func (mc *mockConsumer) ConsumeMessageDirectly(m *message.MessageExt, broker string) (
+	*rpc.ConsumeMessageDirectlyResult, error,
+) {
+	mc.directMessage, mc.directBroker = m, broker
+	return mc.directResult, mc.directErr
+}
 
 func TestConsumer(t *testing.T) {
 	group := "g1"
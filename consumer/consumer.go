@@ -1,36 +1,25 @@
 package consumer
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zjykzk/rocketmq-client-go"
 	"github.com/zjykzk/rocketmq-client-go/client"
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote"
 	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 	"github.com/zjykzk/rocketmq-client-go/route"
 )
 
-type queueAssigner interface {
-	Assign(group, clientID string, clientIDs []string, qs []*message.Queue) ([]*message.Queue, error)
-	Name() string
-}
-
-type offseter interface {
-	persist() error
-	updateQueues(...*message.Queue)
-	updateOffsetIfGreater(mq *message.Queue, offset int64)
-	persistOne(mq *message.Queue)
-	removeOffset(mq *message.Queue) (offset int64, ok bool)
-	readOffset(mq *message.Queue, typ int) (offset int64, err error)
-}
-
 type messageQueueReblancer interface {
 	reblance(topic string)
 }
@@ -47,12 +36,22 @@ type Config struct {
 	MessageModel     Model
 	Typ              Type
 	FromWhere        fromWhere
+	// OffsetStore the custom offset store, use the remote store when the message model is clustering,
+	// otherwise the local one if it's nil
+	OffsetStore OffsetStore
+	// FsyncLocalOffset fsyncs the offset file when persisting the offsets to the local store
+	FsyncLocalOffset bool
+	// QueueAssigner the custom strategy assigning the queues in the clustering model,
+	// use Averagely if it's nil
+	QueueAssigner QueueAssigner
 }
 
 const (
 	defaultInstanceName = "DEFAULT"
 )
 
+var errConsumeDirectlyNotSupported = errors.New("consume message directly not supported")
+
 var defaultConfig = Config{
 	Client: rocketmq.Client{
 		HeartbeatBrokerInterval:       30 * time.Second,
@@ -72,8 +71,8 @@ type consumer struct {
 	subscribeData   *client.DataTable
 	topicRouters    *route.TopicRouterTable
 	reblancer       messageQueueReblancer
-	assigner        queueAssigner
-	offseter        offseter
+	assigner        QueueAssigner
+	offseter        OffsetStore
 	startTime       time.Time
 	rpc             rpcI
 
@@ -81,6 +80,13 @@ type consumer struct {
 
 	brokerSuggester brokerSuggester
 
+	// ownedQueues returns the queues processed by the consumer, and queueLocker locks them in the broker,
+	// used by the sticky reblancing
+	ownedQueues func() []message.Queue
+	queueLocker queueLocker
+
+	filteredMessageCount int64
+
 	sync.WaitGroup
 	exitChan chan struct{}
 
@@ -97,7 +103,10 @@ func (c *consumer) start() (err error) {
 		return
 	}
 
-	if c.MessageModel == Clustering {
+	// the clustering consumers in the different processes use the different instance names by default,
+	// the broadcasting consumer keeps the default one, since its offsets are stored in the directory
+	// named by the client id, which MUST NOT change after restarting
+	if c.MessageModel == Clustering && c.InstanceName == defaultInstanceName {
 		c.InstanceName = strconv.Itoa(os.Getpid())
 	}
 
@@ -106,6 +115,10 @@ func (c *consumer) start() (err error) {
 	c.topicRouters = route.NewTopicRouterTable()
 	c.brokerSuggester.table = make(map[string]int32, 32)
 
+	if c.QueueAssigner != nil {
+		c.assigner = c.QueueAssigner
+	}
+
 	c.ClientID = client.BuildMQClientID(c.ClientIP, c.UnitName, c.InstanceName)
 	c.client, err = client.NewMQClient(
 		&client.Config{
@@ -149,22 +162,31 @@ func (c *consumer) shutdown() {
 	c.Logger.Infof("Shutdown consumer, group:%s, clientID:%s", c.GroupName, c.ClientID)
 	c.client.UnregisterConsumer(c.GroupName)
 	c.client.Shutdown()
-	c.offseter.persist()
+	c.offseter.Persist()
 	close(c.exitChan)
 	c.Wait()
 	c.Logger.Infof("Shutdown consumer, group:%s, clientID:%s OK", c.GroupName, c.ClientID)
 }
 
 func (c *consumer) initOffset() (err error) {
-	switch c.MessageModel {
-	case BroadCasting:
-		c.offseter, err = newLocalStore(localStoreConfig{clientID: c.ClientID, group: c.GroupName})
-	case Clustering:
+	switch {
+	case c.OffsetStore != nil:
+		c.offseter = c.OffsetStore
+	case c.MessageModel == BroadCasting:
+		c.offseter, err = newLocalStore(localStoreConfig{
+			clientID: c.ClientID, group: c.GroupName, fsync: c.FsyncLocalOffset,
+		})
+	case c.MessageModel == Clustering:
 		c.offseter, err = newRemoteStore(remoteStoreConfig{offsetOperAdaptor{c}, c.Logger})
 	default:
 		err = fmt.Errorf("unknow message model:%v", c.MessageModel)
 	}
-	return
+
+	if err != nil {
+		return
+	}
+
+	return c.offseter.Load()
 }
 
 func (c *consumer) schedule(delay, period time.Duration, f func()) {
@@ -274,6 +296,18 @@ func (c *consumer) Subscribe(topic string) {
 	c.subscribeData.PutIfAbsent(topic, BuildSubscribeData(c.GroupName, topic, ""))
 }
 
+// SubscribeWithSelector subscribes the topic with the selector, replaces the previous one,
+// returns error if the expression is bad
+func (c *consumer) SubscribeWithSelector(topic string, selector MessageSelector) error {
+	d, err := BuildSubscribeDataWithSelector(c.GroupName, topic, selector)
+	if err != nil {
+		return err
+	}
+
+	c.subscribeData.Put(topic, d)
+	return nil
+}
+
 func (c *consumer) Unsubscribe(topic string) {
 	c.subscribeData.Delete(topic)
 	c.subscribeQueues.Delete(topic)
@@ -288,6 +322,65 @@ func (c *consumer) selectBrokerID(q *message.Queue) int32 {
 	return id
 }
 
+// findPullBrokerAddr returns the broker suggested by the last pulling, which is the master by default,
+// the other brokers with the same name are used if it is unreachable
+func (c *consumer) findPullBrokerAddr(q *message.Queue) (*client.FindBrokerResult, error) {
+	addr, err := c.client.FindBrokerAddr(q.BrokerName, c.selectBrokerID(q), false)
+	if err != nil {
+		c.client.UpdateTopicRouterInfoFromNamesrv(q.Topic)
+		addr, err = c.client.FindBrokerAddr(q.BrokerName, c.selectBrokerID(q), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	if !c.brokerSuggester.isUnreachable(addr.Addr, now) {
+		return addr, nil
+	}
+
+	for _, r := range c.client.FindAllBrokerAddrs(q.BrokerName) {
+		if r.Addr != addr.Addr && !c.brokerSuggester.isUnreachable(r.Addr, now) {
+			c.Logger.Warnf("broker %s of queue %s is unreachable, pull from %s", addr.Addr, q, r.Addr)
+			return r, nil
+		}
+	}
+	return addr, nil
+}
+
+// updateBrokerReachable marks the broker unreachable when the pulling request is failed,
+// the errors returned by the broker are not the case
+func (c *consumer) updateBrokerReachable(addr string, err error) {
+	if err == nil {
+		c.brokerSuggester.markReachable(addr)
+		return
+	}
+
+	if _, ok := err.(*remote.RPCError); !ok {
+		c.brokerSuggester.markUnreachable(addr, time.Now())
+	}
+}
+
+// filterMessages returns the messages matched by the filter, and counts the others
+func (c *consumer) filterMessages(f MessageFilter, msgs []*message.MessageExt) []*message.MessageExt {
+	matched := make([]*message.MessageExt, 0, len(msgs))
+	for _, m := range msgs {
+		if f.Match(m) {
+			matched = append(matched, m)
+		}
+	}
+
+	if n := len(msgs) - len(matched); n > 0 {
+		atomic.AddInt64(&c.filteredMessageCount, int64(n))
+	}
+	return matched
+}
+
+// FilteredMessageCount returns the count of the messages pulled but dropped by the filter
+func (c *consumer) FilteredMessageCount() int64 {
+	return atomic.LoadInt64(&c.filteredMessageCount)
+}
+
 // RunningInfo returns the consumter's running information
 func (c *consumer) RunningInfo() client.RunningInfo {
 	return c.runnerInfo()
@@ -318,7 +411,7 @@ func (c *consumer) QueryConsumerOffset(q *message.Queue) (int64, error) {
 	}
 
 	if rpcErr.Code == rpc.QueryNotFound {
-		return 0, errOffsetNotExist
+		return 0, ErrOffsetNotExist
 	}
 
 	return offset, rpcErr
@@ -337,8 +430,40 @@ func (c *consumer) QueryMaxOffset(q *message.Queue) (int64, error) {
 	return 0, rpcErr
 }
 
+// QueryMinOffset returns the min offset of the queue in the broker
+func (c *consumer) QueryMinOffset(q *message.Queue) (int64, error) {
+	addr, err := c.findBrokerAddr(q.BrokerName, q.Topic, true)
+	if err != nil {
+		return 0, fmt.Errorf("cannot find broker address:%s %s, error:%s", q.BrokerName, q.Topic, err)
+	}
+	offset, rpcErr := c.rpc.MinOffset(addr, q.Topic, q.QueueID, time.Second*5)
+	if rpcErr == nil {
+		return offset, nil
+	}
+
+	return 0, rpcErr
+}
+
+// SearchOffset returns the offset of the first message stored since the timestamp in the broker
+func (c *consumer) SearchOffset(q *message.Queue, timestamp time.Time) (int64, error) {
+	addr, err := c.findBrokerAddr(q.BrokerName, q.Topic, true)
+	if err != nil {
+		return 0, fmt.Errorf("cannot find broker address:%s %s, error:%s", q.BrokerName, q.Topic, err)
+	}
+	offset, rpcErr := c.rpc.SearchOffsetByTimestamp(
+		addr, q.BrokerName, q.Topic, q.QueueID, timestamp, time.Second*3,
+	)
+	if rpcErr == nil {
+		return offset, nil
+	}
+
+	return 0, rpcErr
+}
+
+// UpdateOffset commits the offset to the master broker, the offset is committed next time
+// if the master is not available
 func (c *consumer) UpdateOffset(q *message.Queue, offset int64, oneway bool) error {
-	addr, err := c.findBrokerAddr(q.BrokerName, q.Topic, false)
+	addr, err := c.findBrokerAddr(q.BrokerName, q.Topic, true)
 	if err != nil {
 		c.Logger.Errorf("update offset failed:%s", err)
 		return nil
@@ -350,18 +475,54 @@ func (c *consumer) UpdateOffset(q *message.Queue, offset int64, oneway bool) err
 }
 
 func (c *consumer) PersistOffset() {
-	err := c.offseter.persist()
+	err := c.offseter.Persist()
 	if err != nil {
 		c.Logger.Errorf("persist consume offset error:%s", err)
 	}
 }
 
+// ResetOffset applies the offsets reset by the broker to the offset store
+func (c *consumer) ResetOffset(topic string, offsets map[message.Queue]int64) {
+	for q, offset := range offsets {
+		if q.Topic != topic {
+			continue
+		}
+
+		c.resetOffset(&q, offset)
+	}
+}
+
+// resetOffset replaces the offset of the queue, and persists it
+func (c *consumer) resetOffset(q *message.Queue, offset int64) {
+	c.offseter.RemoveOffset(q)
+	c.offseter.UpdateOffsetIfGreater(q, offset)
+	c.offseter.PersistOne(q)
+}
+
+// ConsumeOffsets returns the consume offsets in the memory of the topic's queues
+func (c *consumer) ConsumeOffsets(topic string) map[message.Queue]int64 {
+	offsets := make(map[message.Queue]int64)
+	for _, q := range c.subscribeQueues.Get(topic) {
+		if of, err := c.offseter.ReadOffset(q, ReadOffsetFromMemory); err == nil && of >= 0 {
+			offsets[*q] = of
+		}
+	}
+	return offsets
+}
+
+// ConsumeMessageDirectly consumes the message sent by the broker, only the push consumer supports it
+func (c *consumer) ConsumeMessageDirectly(m *message.MessageExt, broker string) (
+	*rpc.ConsumeMessageDirectlyResult, error,
+) {
+	return nil, errConsumeDirectlyNotSupported
+}
+
 func (c *consumer) reblanceClustering(topic string, queues []*message.Queue) (
 	[]*message.Queue, error,
 ) {
 	clientIDs := c.getConsumerIDs(topic, c.GroupName)
 	if len(clientIDs) == 0 {
-		err := fmt.Errorf("no client id of group:" + c.GroupName)
+		err := fmt.Errorf("no client id of group:%s", c.GroupName)
 		c.Logger.Warn(err)
 		return nil, err
 	}
@@ -372,7 +533,13 @@ func (c *consumer) reblanceClustering(topic string, queues []*message.Queue) (
 	copy(all, queues)
 	message.SortQueue(all)
 	sort.Strings(clientIDs)
-	divided, err := c.assigner.Assign(c.GroupName, c.ClientID, clientIDs, all)
+	var divided []*message.Queue
+	var err error
+	if a, ok := c.assigner.(StickyQueueAssigner); ok && c.ownedQueues != nil && c.queueLocker != nil {
+		divided, err = c.assignSticky(a, topic, clientIDs, all)
+	} else {
+		divided, err = c.assigner.Assign(c.GroupName, c.ClientID, clientIDs, all)
+	}
 	if err != nil {
 		err = fmt.Errorf("reblance %s:%s clients:%v, error:%s", c.GroupName, c.ClientID, clientIDs, err)
 		c.Logger.Error(err)
@@ -386,6 +553,63 @@ func (c *consumer) reblanceClustering(topic string, queues []*message.Queue) (
 	return divided, nil
 }
 
+// assignSticky assigns the queues with the ones processed by the client, the owners of the queues
+// are the clients locking them in the broker, so that the clients agree with each other
+func (c *consumer) assignSticky(
+	a StickyQueueAssigner, topic string, clientIDs []string, queues []*message.Queue,
+) (
+	[]*message.Queue, error,
+) {
+	owned := c.ownedQueues()
+	held, isHeld := make([]*message.Queue, 0, len(owned)), make(map[message.Queue]bool, len(owned))
+	for i := range owned {
+		if owned[i].Topic == topic {
+			held, isHeld[owned[i]] = append(held, &owned[i]), true
+		}
+	}
+
+	return a.AssignSticky(c.ClientID, clientIDs, queues, held, func(qs []*message.Queue) []*message.Queue {
+		return c.lockQueuesOfBrokers(qs, isHeld)
+	})
+}
+
+// lockQueuesOfBrokers locks the queues in their brokers, the held queues are regarded as locked
+// if the broker failed, in case of moving the queues for the temporary failure
+func (c *consumer) lockQueuesOfBrokers(qs []*message.Queue, isHeld map[message.Queue]bool) []*message.Queue {
+	var brokers []string
+	queuesOfBroker := make(map[string][]message.Queue)
+	for _, q := range qs {
+		if _, ok := queuesOfBroker[q.BrokerName]; !ok {
+			brokers = append(brokers, q.BrokerName)
+		}
+		queuesOfBroker[q.BrokerName] = append(queuesOfBroker[q.BrokerName], *q)
+	}
+
+	locked := make(map[message.Queue]bool, len(qs))
+	for _, b := range brokers {
+		mqs := queuesOfBroker[b]
+		lockedMQs, err := c.queueLocker.lockQueues(b, mqs)
+		if err != nil {
+			c.Logger.Errorf("sticky reblance, lock queues %v of broker %s error:%s", mqs, b, err)
+			for _, q := range mqs {
+				locked[q] = isHeld[q]
+			}
+			continue
+		}
+		for _, q := range lockedMQs {
+			locked[q] = true
+		}
+	}
+
+	var r []*message.Queue
+	for _, q := range qs {
+		if locked[*q] {
+			r = append(r, q)
+		}
+	}
+	return r
+}
+
 func (c *consumer) getConsumerIDs(topic, group string) []string {
 	addr := c.findBrokerAddrByTopic(topic)
 	if addr == "" {
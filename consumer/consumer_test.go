@@ -1,11 +1,17 @@
 package consumer
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/zjykzk/rocketmq-client-go"
 	"github.com/zjykzk/rocketmq-client-go/client"
 	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
 	"github.com/zjykzk/rocketmq-client-go/route"
 
 	"github.com/stretchr/testify/assert"
@@ -108,3 +114,147 @@ func TestStart(t *testing.T) {
 
 	c.Shutdown()
 }
+
+func TestBroadcastingOffsetPathAfterRestart(t *testing.T) {
+	start := func() string {
+		c := &consumer{Logger: &log.MockLogger{}, Config: defaultConfig}
+		c.StartFunc, c.ShutdownFunc = c.start, c.shutdown
+		c.NameServerAddrs = []string{"mock addr"}
+		c.GroupName = "TestBroadcastingOffsetPathAfterRestart"
+		c.MessageModel = BroadCasting
+		assert.Nil(t, c.Start())
+		defer c.Shutdown()
+
+		assert.Equal(t, defaultInstanceName, c.InstanceName)
+		return c.offseter.(*localStore).path
+	}
+
+	path := start()
+	defer os.RemoveAll(filepath.Dir(path))
+	assert.Equal(t, path, start())
+}
+
+// mockReplicaMQClient finds the brokers like the mq client, all the brokers have the same name
+type mockReplicaMQClient struct {
+	*client.EmptyMQClient
+	addrs map[int32]string // key: broker id
+}
+
+func (c *mockReplicaMQClient) FindBrokerAddr(brokerName string, hintBrokerID int32, lock bool) (
+	*client.FindBrokerResult, error,
+) {
+	if addr, ok := c.addrs[hintBrokerID]; ok {
+		return &client.FindBrokerResult{Addr: addr, IsSlave: hintBrokerID != rocketmq.MasterID}, nil
+	}
+	if rs := c.FindAllBrokerAddrs(brokerName); !lock && len(rs) > 0 {
+		return rs[0], nil
+	}
+	return nil, errors.New("mock broker not exist")
+}
+
+func (c *mockReplicaMQClient) FindAllBrokerAddrs(brokerName string) []*client.FindBrokerResult {
+	var ids []int
+	for id := range c.addrs {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	var rs []*client.FindBrokerResult
+	for _, id := range ids {
+		rs = append(rs, &client.FindBrokerResult{
+			Addr: c.addrs[int32(id)], IsSlave: int32(id) != rocketmq.MasterID,
+		})
+	}
+	return rs
+}
+
+func TestPullFromReplicas(t *testing.T) {
+	r := &mockConsumerRPC{}
+	mc := &mockReplicaMQClient{addrs: map[int32]string{rocketmq.MasterID: "master", 1: "slave"}}
+	c := NewPullConsumer("test pull from replicas", []string{"dummy"}, &log.MockLogger{})
+	c.rpc, c.client = r, mc
+	c.brokerSuggester.table = make(map[string]int32)
+	q := &message.Queue{BrokerName: "b"}
+
+	// the master is unreachable
+	_, err := c.PullSync(q, "", 0, 10)
+	assert.NotNil(t, err)
+	assert.Equal(t, "master", r.pullAddr)
+	assert.True(t, c.brokerSuggester.isUnreachable("master", time.Now()))
+
+	// fail over to the slave
+	_, err = c.PullSync(q, "", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "slave", r.pullAddr)
+
+	// the master is back
+	c.brokerSuggester.markReachable("master")
+	c.brokerSuggester.put(q, rocketmq.MasterID)
+	c.PullSync(q, "", 0, 10)
+	assert.Equal(t, "master", r.pullAddr)
+
+	// the slave suggested by the broker
+	c.brokerSuggester.put(q, 1)
+	c.PullSync(q, "", 0, 10)
+	assert.Equal(t, "slave", r.pullAddr)
+
+	// all the brokers are unreachable, pull from the suggested one
+	c.brokerSuggester.markUnreachable("master", time.Now())
+	c.brokerSuggester.markUnreachable("slave", time.Now())
+	c.brokerSuggester.put(q, 1)
+	c.PullSync(q, "", 0, 10)
+	assert.Equal(t, "slave", r.pullAddr)
+
+	// the offset is committed to the master only
+	assert.Nil(t, c.UpdateOffset(q, 1, false))
+	assert.Equal(t, "master", r.updateOffsetAddr)
+	r.updateOffsetAddr = ""
+	delete(mc.addrs, rocketmq.MasterID)
+	assert.Nil(t, c.UpdateOffset(q, 1, true))
+	assert.Equal(t, "", r.updateOffsetAddr)
+}
+
+func TestAssignSticky(t *testing.T) {
+	topic := "TestAssignSticky"
+	c := &consumer{
+		subscribeData:   client.NewDataTable(),
+		subscribeQueues: client.NewQueueTable(),
+		topicRouters:    route.NewTopicRouterTable(),
+		Logger:          &log.MockLogger{},
+	}
+	c.ClientID = "a"
+	queues := []*message.Queue{
+		{Topic: topic, QueueID: 0}, {Topic: topic, QueueID: 1},
+		{Topic: topic, QueueID: 2}, {Topic: topic, QueueID: 3},
+	}
+
+	var owned []message.Queue
+	c.ownedQueues = func() []message.Queue { return owned }
+	locker := &mockQueueLocker{}
+	c.queueLocker = locker
+
+	// the locked queues are assigned
+	locker.lockedQueues = []message.Queue{*queues[0], *queues[1], *queues[2], *queues[3]}
+	qs, err := c.assignSticky(&Sticky{}, topic, []string{"a"}, queues)
+	assert.Nil(t, err)
+	assert.Equal(t, queues, qs)
+
+	// the queues locked by the others are not assigned
+	locker.lockedQueues = []message.Queue{*queues[0], *queues[3]}
+	qs, err = c.assignSticky(&Sticky{}, topic, []string{"a"}, queues)
+	assert.Nil(t, err)
+	assert.Equal(t, []*message.Queue{queues[0], queues[3]}, qs)
+
+	// the processing queues are kept
+	owned = []message.Queue{*queues[2], *queues[3], {Topic: "other"}}
+	locker.lockedQueues = []message.Queue{*queues[0], *queues[1], *queues[2], *queues[3]}
+	qs, err = c.assignSticky(&Sticky{}, topic, []string{"a", "b"}, queues)
+	assert.Nil(t, err)
+	assert.Equal(t, queues[2:], qs)
+
+	// the processing queues are kept if the broker failed
+	locker.lockErr = errors.New("bad lock")
+	qs, err = c.assignSticky(&Sticky{}, topic, []string{"a", "b"}, queues)
+	assert.Nil(t, err)
+	assert.Equal(t, queues[2:], qs)
+}
@@ -1,21 +1,51 @@
 package consumer
 
 import (
+	"errors"
 	"hash/fnv"
 	"strings"
 
 	"github.com/zjykzk/rocketmq-client-go/client"
+	"github.com/zjykzk/rocketmq-client-go/consumer/internel/sql92"
+	"github.com/zjykzk/rocketmq-client-go/message"
 )
 
 const (
 	subAll = "*"
 	// ExprTypeTag TAG literal
 	ExprTypeTag = "TAG"
+	// ExprTypeSQL92 SQL92 literal
+	ExprTypeSQL92 = "SQL92"
 )
 
+var (
+	errEmptySQL92Expr = errors.New("empty sql92 expression")
+	errBadExprType    = errors.New("bad expression type")
+)
+
+// MessageSelector the expression selecting the messages, by tag or by SQL92
+type MessageSelector struct {
+	Type string
+	Expr string
+}
+
+// ByTag selects the messages by tag, the expression is like "tag1 || tag2"
+func ByTag(expr string) MessageSelector {
+	return MessageSelector{Type: ExprTypeTag, Expr: expr}
+}
+
+// BySQL92 selects the messages by the SQL92 expression on the properties, like "region = 'hz' AND amount > 100"
+func BySQL92(expr string) MessageSelector {
+	return MessageSelector{Type: ExprTypeSQL92, Expr: expr}
+}
+
+func (s MessageSelector) String() string {
+	return "MessageSelector [type=" + s.Type + ",expr=" + s.Expr + "]"
+}
+
 // BuildSubscribeData build the subscribe data
 func BuildSubscribeData(group, topic, expr string) *client.Data {
-	d := &client.Data{Topic: topic, Expr: expr}
+	d := &client.Data{Topic: topic, Expr: expr, Typ: ExprTypeTag}
 	if expr == "" {
 		d.Expr = subAll
 		return d
@@ -37,6 +67,22 @@ func BuildSubscribeData(group, topic, expr string) *client.Data {
 	return d
 }
 
+// BuildSubscribeDataWithSelector build the subscribe data with the selector,
+// returns error if the SQL92 expression is bad
+func BuildSubscribeDataWithSelector(group, topic string, selector MessageSelector) (*client.Data, error) {
+	switch {
+	case IsTag(selector.Type):
+		return BuildSubscribeData(group, topic, selector.Expr), nil
+	case IsSQL92(selector.Type):
+		if _, err := parseSQL92(selector.Expr); err != nil {
+			return nil, err
+		}
+		return &client.Data{Topic: topic, Expr: selector.Expr, Typ: ExprTypeSQL92}, nil
+	default:
+		return nil, errBadExprType
+	}
+}
+
 // IsTag returns true if the expresstion type is "TAG" or empty string, false otherwise
 func IsTag(typ string) bool {
 	return typ == "" || ExprTypeTag == typ
@@ -55,3 +101,74 @@ func ParseTags(expr string) []string {
 
 	return tags
 }
+
+// IsSQL92 returns true if the expresstion type is "SQL92", false otherwise
+func IsSQL92(typ string) bool {
+	return ExprTypeSQL92 == typ
+}
+
+// MessageFilter filters the messages locally
+type MessageFilter interface {
+	Match(m *message.MessageExt) bool
+}
+
+// NewMessageFilter creates the filter of the selector, returns error if the SQL92 expression is bad
+func NewMessageFilter(selector MessageSelector) (MessageFilter, error) {
+	switch {
+	case IsTag(selector.Type):
+		return tagFilter(ParseTags(selector.Expr)), nil
+	case IsSQL92(selector.Type):
+		e, err := parseSQL92(selector.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return sql92Filter{e}, nil
+	default:
+		return nil, errBadExprType
+	}
+}
+
+// newSubscriptionFilter creates the filter re-checking the tags of the messages pulled with the subscription,
+// since the broker filters by the hash code of the tag, the message with the other tag of the same hash code
+// is delivered too
+func newSubscriptionFilter(d *client.Data) MessageFilter {
+	if !IsTag(d.Typ) || d.Expr == subAll {
+		return tagFilter(nil)
+	}
+	return tagFilter(d.Tags)
+}
+
+func parseSQL92(expr string) (*sql92.Expression, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, errEmptySQL92Expr
+	}
+	return sql92.Parse(expr)
+}
+
+type tagFilter []string
+
+func (f tagFilter) Match(m *message.MessageExt) bool {
+	if len(f) == 0 {
+		return true
+	}
+
+	tag := m.GetTags()
+	if tag == "" {
+		return false
+	}
+
+	for _, t := range f {
+		if tag == t {
+			return true
+		}
+	}
+	return false
+}
+
+type sql92Filter struct {
+	*sql92.Expression
+}
+
+func (f sql92Filter) Match(m *message.MessageExt) bool {
+	return f.Expression.Match(m.Properties)
+}
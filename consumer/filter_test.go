@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/client"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+func TestBuildSubscribeDataWithSelector(t *testing.T) {
+	d, err := BuildSubscribeDataWithSelector("g", "topic", ByTag("t1 || t2"))
+	assert.Nil(t, err)
+	assert.Equal(t, ExprTypeTag, d.Typ)
+	assert.Equal(t, []string{"t1", "t2"}, d.Tags)
+
+	d, err = BuildSubscribeDataWithSelector("g", "topic", BySQL92("a > 1"))
+	assert.Nil(t, err)
+	assert.Equal(t, &client.Data{Topic: "topic", Expr: "a > 1", Typ: ExprTypeSQL92}, d)
+
+	_, err = BuildSubscribeDataWithSelector("g", "topic", BySQL92(" "))
+	assert.Equal(t, errEmptySQL92Expr, err)
+
+	_, err = BuildSubscribeDataWithSelector("g", "topic", BySQL92("a >"))
+	assert.NotNil(t, err)
+
+	_, err = BuildSubscribeDataWithSelector("g", "topic", MessageSelector{Type: "bad", Expr: "a"})
+	assert.Equal(t, errBadExprType, err)
+}
+
+func TestMessageFilter(t *testing.T) {
+	m1 := &message.MessageExt{Message: message.Message{Properties: map[string]string{
+		message.PropertyTags: "t1", "region": "hz", "amount": "100",
+	}}}
+	m2 := &message.MessageExt{Message: message.Message{Properties: map[string]string{
+		message.PropertyTags: "t2", "region": "sh",
+	}}}
+	m3 := &message.MessageExt{}
+
+	matched := func(s MessageSelector) []bool {
+		f, err := NewMessageFilter(s)
+		assert.Nil(t, err)
+		return []bool{f.Match(m1), f.Match(m2), f.Match(m3)}
+	}
+
+	assert.Equal(t, []bool{true, true, true}, matched(ByTag("")))
+	assert.Equal(t, []bool{true, true, true}, matched(ByTag("*")))
+	assert.Equal(t, []bool{true, true, true}, matched(MessageSelector{}))
+	assert.Equal(t, []bool{true, false, false}, matched(ByTag("t1")))
+	assert.Equal(t, []bool{true, true, false}, matched(ByTag("t1 || t2")))
+	assert.Equal(t, []bool{true, false, false}, matched(BySQL92("region = 'hz' AND amount >= 100")))
+	assert.Equal(t, []bool{true, true, false}, matched(BySQL92("region IN ('hz', 'sh')")))
+	assert.Equal(t, []bool{false, true, true}, matched(BySQL92("amount IS NULL")))
+	assert.Equal(t, []bool{false, true, false}, matched(BySQL92("TAGS = 't2'")))
+
+	_, err := NewMessageFilter(BySQL92(""))
+	assert.Equal(t, errEmptySQL92Expr, err)
+	_, err = NewMessageFilter(MessageSelector{Type: "bad"})
+	assert.Equal(t, errBadExprType, err)
+}
+
+func TestSubscribeWithSelector(t *testing.T) {
+	c := &consumer{
+		subscribeData:   client.NewDataTable(),
+		subscribeQueues: client.NewQueueTable(),
+		topicRouters:    route.NewTopicRouterTable(),
+	}
+
+	assert.NotNil(t, c.SubscribeWithSelector("topic", BySQL92("a =")))
+	assert.Nil(t, c.subscribeData.Get("topic"))
+
+	c.Subscribe("topic")
+	assert.Equal(t, ExprTypeTag, c.subscribeData.Get("topic").Typ)
+
+	assert.Nil(t, c.SubscribeWithSelector("topic", BySQL92("a = 1")))
+	d := c.subscribeData.Get("topic")
+	assert.Equal(t, ExprTypeSQL92, d.Typ)
+	assert.Equal(t, "a = 1", d.Expr)
+}
@@ -0,0 +1,291 @@
+package sql92
+
+import (
+	"strconv"
+	"strings"
+)
+
+// node the element of the expression tree
+// eval returns nil for the unknown value, or the value of type bool, string, int64 and float64
+type node interface {
+	eval(props map[string]string) interface{}
+}
+
+type property string
+
+func (p property) eval(props map[string]string) interface{} {
+	v, ok := props[string(p)]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (l literal) eval(map[string]string) interface{} {
+	return l.v
+}
+
+type and struct {
+	l, r node
+}
+
+func (e and) eval(props map[string]string) interface{} {
+	l := e.l.eval(props)
+	if l == false {
+		return false
+	}
+
+	r := e.r.eval(props)
+	if r == false {
+		return false
+	}
+
+	if l == nil || r == nil {
+		return nil
+	}
+	return true
+}
+
+type or struct {
+	l, r node
+}
+
+func (e or) eval(props map[string]string) interface{} {
+	l := e.l.eval(props)
+	if l == true {
+		return true
+	}
+
+	r := e.r.eval(props)
+	if r == true {
+		return true
+	}
+
+	if l == nil || r == nil {
+		return nil
+	}
+	return false
+}
+
+type not struct {
+	e node
+}
+
+func (e not) eval(props map[string]string) interface{} {
+	v, ok := e.e.eval(props).(bool)
+	if !ok {
+		return nil
+	}
+	return !v
+}
+
+func negate(v interface{}, yes bool) interface{} {
+	if !yes {
+		return v
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return nil
+	}
+	return !b
+}
+
+type compare struct {
+	op   string
+	l, r node
+}
+
+func (e compare) eval(props map[string]string) interface{} {
+	l, r := e.l.eval(props), e.r.eval(props)
+	if l == nil || r == nil {
+		return nil
+	}
+
+	switch e.op {
+	case "=":
+		return equal(l, r)
+	case "<>", "!=":
+		return !equal(l, r)
+	}
+
+	c, ok := compareNumber(l, r)
+	if !ok {
+		return nil
+	}
+
+	switch e.op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	default:
+		panic("BUG:unknown operator:" + e.op)
+	}
+}
+
+type between struct {
+	e, low, high node
+	not          bool
+}
+
+func (e between) eval(props map[string]string) interface{} {
+	v, low, high := e.e.eval(props), e.low.eval(props), e.high.eval(props)
+	if v == nil || low == nil || high == nil {
+		return nil
+	}
+
+	c1, ok1 := compareNumber(v, low)
+	c2, ok2 := compareNumber(v, high)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	return negate(c1 >= 0 && c2 <= 0, e.not)
+}
+
+type in struct {
+	e      node
+	values []string
+	not    bool
+}
+
+func (e in) eval(props map[string]string) interface{} {
+	v, ok := e.e.eval(props).(string)
+	if !ok {
+		return nil
+	}
+
+	for _, s := range e.values {
+		if s == v {
+			return negate(true, e.not)
+		}
+	}
+	return negate(false, e.not)
+}
+
+type isNull struct {
+	e   node
+	not bool
+}
+
+func (e isNull) eval(props map[string]string) interface{} {
+	return (e.e.eval(props) == nil) != e.not
+}
+
+type stringMatch struct {
+	op  string
+	e   node
+	s   string
+	not bool
+}
+
+func (e stringMatch) eval(props map[string]string) interface{} {
+	v, ok := e.e.eval(props).(string)
+	if !ok {
+		return nil
+	}
+
+	var r bool
+	switch e.op {
+	case "STARTSWITH":
+		r = strings.HasPrefix(v, e.s)
+	case "ENDSWITH":
+		r = strings.HasSuffix(v, e.s)
+	case "CONTAINS":
+		r = strings.Contains(v, e.s)
+	default:
+		panic("BUG:unknown operator:" + e.op)
+	}
+	return negate(r, e.not)
+}
+
+func toNumber(v interface{}) (interface{}, bool) {
+	switch n := v.(type) {
+	case int64, float64:
+		return n, true
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
+
+// compareNumber compares the values as the numbers, returns false if any of them is not number
+func compareNumber(l, r interface{}) (int, bool) {
+	l, ok := toNumber(l)
+	if !ok {
+		return 0, false
+	}
+
+	r, ok = toNumber(r)
+	if !ok {
+		return 0, false
+	}
+
+	li, ok1 := l.(int64)
+	ri, ok2 := r.(int64)
+	if ok1 && ok2 {
+		switch {
+		case li > ri:
+			return 1, true
+		case li < ri:
+			return -1, true
+		default:
+			return 0, true
+		}
+	}
+
+	lf, rf := toFloat(l), toFloat(r)
+	switch {
+	case lf > rf:
+		return 1, true
+	case lf < rf:
+		return -1, true
+	default:
+		return 0, true
+	}
+}
+
+func equal(l, r interface{}) bool {
+	switch lv := l.(type) {
+	case string:
+		switch rv := r.(type) {
+		case string:
+			return lv == rv
+		case bool:
+			b, err := strconv.ParseBool(lv)
+			return err == nil && b == rv
+		}
+	case bool:
+		switch rv := r.(type) {
+		case bool:
+			return lv == rv
+		case string:
+			b, err := strconv.ParseBool(rv)
+			return err == nil && b == lv
+		}
+		return false
+	}
+
+	c, ok := compareNumber(l, r)
+	return ok && c == 0
+}
@@ -0,0 +1,171 @@
+package sql92
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokIdent
+	tokKeyword
+	tokString
+	tokNumber
+	tokOperator
+	tokLParen
+	tokRParen
+	tokComma
+	tokMinus
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == tokEOF {
+		return "EOF"
+	}
+	return fmt.Sprintf("'%s' at %d", t.val, t.pos)
+}
+
+var keywords = map[string]bool{
+	"AND":        true,
+	"OR":         true,
+	"NOT":        true,
+	"BETWEEN":    true,
+	"IN":         true,
+	"IS":         true,
+	"NULL":       true,
+	"TRUE":       true,
+	"FALSE":      true,
+	"STARTSWITH": true,
+	"ENDSWITH":   true,
+	"CONTAINS":   true,
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lex splits the expression into the tokens, the last one is EOF
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '-':
+			tokens = append(tokens, token{tokMinus, "-", i})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{tokOperator, "=", i})
+			i++
+		case c == '<' || c == '>' || c == '!':
+			op := string(c)
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '<' && expr[i+1] == '>')) {
+				op += string(expr[i+1])
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at %d", i)
+			}
+			tokens = append(tokens, token{tokOperator, op, i})
+			i += len(op)
+		case c == '\'':
+			s, n, err := lexString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s at %d", err, i)
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i += n
+		case isDigit(c):
+			n := lexNumber(expr[i:])
+			tokens = append(tokens, token{tokNumber, expr[i : i+n], i})
+			i += n
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(expr) && isIdentPart(expr[j]) {
+				j++
+			}
+			word := expr[i:j]
+			if upper := strings.ToUpper(word); keywords[upper] {
+				tokens = append(tokens, token{tokKeyword, upper, i})
+			} else {
+				tokens = append(tokens, token{tokIdent, word, i})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at %d", c, i)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(expr)}), nil
+}
+
+// lexString reads the string quoted by the single quote, two single quotes stand for one
+func lexString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func lexNumber(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+
+	if i+1 < len(s) && s[i] == '.' && isDigit(s[i+1]) {
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
@@ -0,0 +1,349 @@
+// Package sql92 parses and evaluates the SQL92 filter expression on the message properties
+//
+// the supported syntax:
+// 1. logic: AND, OR, NOT, parentheses
+// 2. numeric comparison: >, >=, <, <=, BETWEEN ... AND ...
+// 3. comparison: =, <>, !=
+// 4. string: IN ('a', 'b'), STARTSWITH 'a', ENDSWITH 'a', CONTAINS 'a'
+// 5. null: IS NULL, IS NOT NULL
+// 6. constant: 'string', 123, 1.23, TRUE, FALSE
+//
+// the comparison with the missing property is unknown, which is not matched
+package sql92
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Expression the compiled SQL92 expression
+type Expression struct {
+	raw  string
+	root node
+}
+
+// Parse compiles the expression, returns error if the syntax is bad
+func Parse(expr string) (*Expression, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, k, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.typ != tokEOF {
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+
+	if k != kindBool {
+		return nil, fmt.Errorf("not a boolean expression:%s", expr)
+	}
+
+	return &Expression{raw: expr, root: root}, nil
+}
+
+// Match returns true if the properties matches the expression
+func (e *Expression) Match(props map[string]string) bool {
+	return e.root.eval(props) == true
+}
+
+func (e *Expression) String() string {
+	return e.raw
+}
+
+type kind int
+
+const (
+	kindBool kind = iota
+	kindProperty
+	kindString
+	kindNumber
+	kindNull
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(k string) bool {
+	t := p.peek()
+	return t.typ == tokKeyword && t.val == k
+}
+
+func (p *parser) expectKeyword(k string) error {
+	if t := p.next(); t.typ != tokKeyword || t.val != k {
+		return fmt.Errorf("expect %s, but %s", k, t)
+	}
+	return nil
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, fmt.Errorf("expect %s, but %s", what, t)
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (node, kind, error) {
+	l, k, err := p.parseAnd()
+	if err != nil {
+		return nil, k, err
+	}
+
+	for p.isKeyword("OR") {
+		t := p.next()
+		r, rk, err := p.parseAnd()
+		if err != nil {
+			return nil, rk, err
+		}
+
+		if k != kindBool || rk != kindBool {
+			return nil, k, fmt.Errorf("the operands of %s must be boolean", t)
+		}
+		l = or{l, r}
+	}
+	return l, k, nil
+}
+
+func (p *parser) parseAnd() (node, kind, error) {
+	l, k, err := p.parseNot()
+	if err != nil {
+		return nil, k, err
+	}
+
+	for p.isKeyword("AND") {
+		t := p.next()
+		r, rk, err := p.parseNot()
+		if err != nil {
+			return nil, rk, err
+		}
+
+		if k != kindBool || rk != kindBool {
+			return nil, k, fmt.Errorf("the operands of %s must be boolean", t)
+		}
+		l = and{l, r}
+	}
+	return l, k, nil
+}
+
+func (p *parser) parseNot() (node, kind, error) {
+	if !p.isKeyword("NOT") {
+		return p.parsePredicate()
+	}
+
+	t := p.next()
+	e, k, err := p.parseNot()
+	if err != nil {
+		return nil, k, err
+	}
+
+	if k != kindBool {
+		return nil, k, fmt.Errorf("the operand of %s must be boolean", t)
+	}
+	return not{e}, kindBool, nil
+}
+
+func (p *parser) parsePredicate() (node, kind, error) {
+	l, k, err := p.parsePrimary()
+	if err != nil {
+		return nil, k, err
+	}
+
+	t := p.peek()
+	if t.typ == tokOperator {
+		p.next()
+		r, rk, err := p.parsePrimary()
+		if err != nil {
+			return nil, rk, err
+		}
+
+		if k == kindNull || rk == kindNull {
+			return nil, k, fmt.Errorf("compare with NULL by %s, use IS NULL instead", t)
+		}
+
+		if t.val != "=" && t.val != "<>" && t.val != "!=" && (!isNumeric(k) || !isNumeric(rk)) {
+			return nil, k, fmt.Errorf("the operands of %s must be numeric", t)
+		}
+		return compare{t.val, l, r}, kindBool, nil
+	}
+
+	if t.typ != tokKeyword {
+		return l, k, nil
+	}
+
+	negative := false
+	if t.val == "NOT" {
+		p.next()
+		negative, t = true, p.peek()
+	}
+
+	switch t.val {
+	case "BETWEEN":
+		p.next()
+		return p.parseBetween(l, k, negative)
+	case "IN":
+		p.next()
+		return p.parseIn(l, k, negative)
+	case "STARTSWITH", "ENDSWITH", "CONTAINS":
+		p.next()
+		if k != kindProperty {
+			return nil, k, fmt.Errorf("the left operand of %s must be property", t)
+		}
+
+		s, err := p.expect(tokString, "string")
+		if err != nil {
+			return nil, k, err
+		}
+		return stringMatch{op: t.val, e: l, s: s.val, not: negative}, kindBool, nil
+	case "IS":
+		if negative {
+			return nil, k, fmt.Errorf("unexpected %s", t)
+		}
+
+		p.next()
+		if k != kindProperty {
+			return nil, k, fmt.Errorf("the left operand of %s must be property", t)
+		}
+
+		if p.isKeyword("NOT") {
+			p.next()
+			negative = true
+		}
+
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, k, err
+		}
+		return isNull{e: l, not: negative}, kindBool, nil
+	}
+
+	if negative {
+		return nil, k, fmt.Errorf("unexpected %s", t)
+	}
+	return l, k, nil
+}
+
+func (p *parser) parseBetween(e node, k kind, negative bool) (node, kind, error) {
+	low, lk, err := p.parsePrimary()
+	if err != nil {
+		return nil, lk, err
+	}
+
+	if err = p.expectKeyword("AND"); err != nil {
+		return nil, lk, err
+	}
+
+	high, hk, err := p.parsePrimary()
+	if err != nil {
+		return nil, hk, err
+	}
+
+	if !isNumeric(k) || !isNumeric(lk) || !isNumeric(hk) {
+		return nil, k, fmt.Errorf("the operands of BETWEEN must be numeric")
+	}
+	return between{e: e, low: low, high: high, not: negative}, kindBool, nil
+}
+
+func (p *parser) parseIn(e node, k kind, negative bool) (node, kind, error) {
+	if k != kindProperty {
+		return nil, k, fmt.Errorf("the left operand of IN must be property")
+	}
+
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, k, err
+	}
+
+	var values []string
+	for {
+		s, err := p.expect(tokString, "string")
+		if err != nil {
+			return nil, k, err
+		}
+		values = append(values, s.val)
+
+		t := p.next()
+		if t.typ == tokRParen {
+			break
+		}
+
+		if t.typ != tokComma {
+			return nil, k, fmt.Errorf("expect ',' or ')', but %s", t)
+		}
+	}
+	return in{e: e, values: values, not: negative}, kindBool, nil
+}
+
+func (p *parser) parsePrimary() (node, kind, error) {
+	t := p.next()
+	switch t.typ {
+	case tokIdent:
+		return property(t.val), kindProperty, nil
+	case tokString:
+		return literal{t.val}, kindString, nil
+	case tokNumber:
+		return parseNumber(t.val, false)
+	case tokMinus:
+		n, err := p.expect(tokNumber, "number")
+		if err != nil {
+			return nil, kindNumber, err
+		}
+		return parseNumber(n.val, true)
+	case tokLParen:
+		e, k, err := p.parseOr()
+		if err != nil {
+			return nil, k, err
+		}
+
+		if _, err = p.expect(tokRParen, ")"); err != nil {
+			return nil, k, err
+		}
+		return e, k, nil
+	case tokKeyword:
+		switch t.val {
+		case "TRUE":
+			return literal{true}, kindBool, nil
+		case "FALSE":
+			return literal{false}, kindBool, nil
+		case "NULL":
+			return literal{nil}, kindNull, nil
+		}
+	}
+	return nil, kindNull, fmt.Errorf("unexpected %s", t)
+}
+
+func parseNumber(s string, negative bool) (node, kind, error) {
+	if negative {
+		s = "-" + s
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return literal{i}, kindNumber, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, kindNumber, fmt.Errorf("bad number:%s", s)
+	}
+	return literal{f}, kindNumber, nil
+}
+
+func isNumeric(k kind) bool {
+	return k == kindNumber || k == kindProperty
+}
@@ -0,0 +1,113 @@
+package sql92
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := lex("a.b>=-1.5e3 AND c<>'it''s' or (d IN ('x','y'))")
+	assert.Nil(t, err)
+	typs := []tokenType{
+		tokIdent, tokOperator, tokMinus, tokNumber, tokKeyword, tokIdent, tokOperator, tokString,
+		tokKeyword, tokLParen, tokIdent, tokKeyword, tokLParen, tokString, tokComma, tokString,
+		tokRParen, tokRParen, tokEOF,
+	}
+	assert.Equal(t, len(typs), len(tokens))
+	for i, typ := range typs {
+		assert.Equal(t, typ, tokens[i].typ, tokens[i].String())
+	}
+	assert.Equal(t, "1.5e3", tokens[3].val)
+	assert.Equal(t, "it's", tokens[7].val)
+	assert.Equal(t, "OR", tokens[8].val)
+
+	for _, expr := range []string{"a ! b", "a = 'unterminated", "a # 1"} {
+		_, err = lex(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"a",
+		"'a'",
+		"a = ",
+		"a = NULL",
+		"a > 'x'",
+		"a AND b",
+		"NOT a",
+		"a BETWEEN 'x' AND 2",
+		"a BETWEEN 1 2",
+		"'a' IN ('a')",
+		"a IN ()",
+		"a IN (1)",
+		"a IN ('a' 'b')",
+		"a IS NOT 1",
+		"a NOT IS NULL",
+		"'a' IS NULL",
+		"a STARTSWITH 1",
+		"1 CONTAINS 'a'",
+		"(a = 1",
+		"a = 1)",
+		"a NOT = 1",
+		"(a = 1 OR b > 1) AND 1",
+	} {
+		_, err := Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	props := map[string]string{
+		"region": "hz",
+		"amount": "150",
+		"rate":   "0.5",
+		"vip":    "true",
+	}
+
+	for expr, expected := range map[string]bool{
+		"region = 'hz'":                  true,
+		"region <> 'hz'":                 false,
+		"region != 'sh'":                 true,
+		"amount = 150":                   true,
+		"amount > 100 AND region = 'hz'": true,
+		"amount >= 150.0":                true,
+		"amount < -1":                    false,
+		"rate <= 0.5":                    true,
+		"amount BETWEEN 100 AND 200":     true,
+		"amount NOT BETWEEN 100 AND 200": false,
+		"region IN ('sh', 'hz')":         true,
+		"region NOT IN ('sh', 'hz')":     false,
+		"region STARTSWITH 'h'":          true,
+		"region ENDSWITH 'h'":            false,
+		"region NOT CONTAINS 'z'":        false,
+		"vip = TRUE":                     true,
+		"missing IS NULL":                true,
+		"region IS NOT NULL":             true,
+		"NOT (region = 'sh')":            true,
+		"region = 'sh' OR amount > 100":  true,
+		"TRUE":                           true,
+		"FALSE OR TRUE":                  true,
+		"region > 1":                     false,
+		// the unknown value
+		"missing = 'hz'":                    false,
+		"NOT (missing = 'hz')":              false,
+		"missing = 'hz' OR region = 'hz'":   true,
+		"missing = 'hz' AND region = 'sh'":  false,
+		"missing NOT IN ('a')":              false,
+		"missing BETWEEN 1 AND 2":           false,
+		"NOT (missing BETWEEN 1 AND 2)":     false,
+		"missing STARTSWITH 'a'":            false,
+		"NOT (missing NOT STARTSWITH 'a')":  false,
+		"missing IS NULL AND amount = 150":  true,
+		"missing IS NULL AND amount = 'x'":  false,
+		"region = 'hz' AND NOT missing > 1": false,
+	} {
+		e, err := Parse(expr)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, expected, e.Match(props), expr)
+		assert.Equal(t, expr, e.String())
+	}
+}
@@ -0,0 +1,521 @@
+package consumer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+)
+
+const (
+	defaultLitePullBatchSize         = 10
+	defaultLitePullThresholdForQueue = 1000
+	defaultLiteAutoCommitInterval    = 5 * time.Second
+	defaultLiteBatchChanSize         = 64
+
+	litePullDelayWhenNotFound = 100 * time.Millisecond
+)
+
+var (
+	errQueueNotAssigned    = errors.New("queue not assigned")
+	errOffsetOutOfRange    = errors.New("offset out of range")
+	errSubscribedAndAssign = errors.New("cannot assign the queues after subscribing")
+)
+
+// LitePullConsumer pulls the messages of the subscribed or assigned queues in the background,
+// the caller gets them by Poll, and commits the offsets automatically or manually
+type LitePullConsumer struct {
+	*PullConsumer
+
+	// AutoCommit commits the offsets of the polled messages periodically
+	AutoCommit         bool
+	AutoCommitInterval time.Duration
+	// PullBatchSize the max count of the messages pulled once
+	PullBatchSize int
+	// PullThresholdForQueue the max count of the messages cached for one queue,
+	// stop pulling the messages of the queue if the cached messages exceed it
+	PullThresholdForQueue int
+
+	queuesLocker sync.Mutex
+	queues       map[message.Queue]*liteQueue
+	assigned     bool
+	pulling      bool
+
+	batches chan *liteBatch
+}
+
+type liteQueue struct {
+	sync.Mutex
+	queue message.Queue
+
+	nextOffset      int64 // the offset to pull, -1 means computing from the store
+	consumeOffset   int64 // the offset after the polled messages, -1 means nothing polled
+	committedOffset int64
+	cachedCount     int   // the count of the messages pulled but not polled
+	version         int64 // increases when seeking, the pulled messages of the old version are discarded
+
+	dropped bool
+	stop    chan struct{}
+}
+
+type liteBatch struct {
+	queue      *liteQueue
+	version    int64
+	nextOffset int64
+	messages   []*message.MessageExt
+}
+
+// NewLitePullConsumer creates the lite pull consumer
+func NewLitePullConsumer(group string, namesrvAddrs []string, logger log.Logger) *LitePullConsumer {
+	c := &LitePullConsumer{
+		PullConsumer: NewPullConsumer(group, namesrvAddrs, logger),
+
+		AutoCommit:            true,
+		AutoCommitInterval:    defaultLiteAutoCommitInterval,
+		PullBatchSize:         defaultLitePullBatchSize,
+		PullThresholdForQueue: defaultLitePullThresholdForQueue,
+
+		queues:  make(map[message.Queue]*liteQueue),
+		batches: make(chan *liteBatch, defaultLiteBatchChanSize),
+	}
+	c.reblancer = c
+	c.StartFunc, c.ShutdownFunc = c.start, c.shutdown
+	return c
+}
+
+func (c *LitePullConsumer) start() error {
+	err := c.PullConsumer.start()
+	if err != nil {
+		return err
+	}
+
+	if c.AutoCommit {
+		c.schedule(c.AutoCommitInterval, c.AutoCommitInterval, c.Commit)
+	}
+
+	c.queuesLocker.Lock()
+	c.pulling = true
+	all := make([]*message.Queue, 0, len(c.queues))
+	for q, lq := range c.queues {
+		q := q
+		all = append(all, &q)
+		c.startPulling(lq)
+	}
+	c.offseter.UpdateQueues(all...)
+	c.queuesLocker.Unlock()
+	return nil
+}
+
+func (c *LitePullConsumer) shutdown() {
+	if c.AutoCommit {
+		c.Commit()
+	}
+
+	c.queuesLocker.Lock()
+	c.pulling = false
+	for q, lq := range c.queues {
+		lq.drop()
+		delete(c.queues, q)
+	}
+	c.queuesLocker.Unlock()
+
+	c.PullConsumer.shutdown()
+}
+
+// Assign assigns the queues to pull manually, replaces the previous ones
+// it returns error if any topic is subscribed
+func (c *LitePullConsumer) Assign(queues []*message.Queue) error {
+	if len(c.SubscribeTopics()) > 0 {
+		return errSubscribedAndAssign
+	}
+
+	c.queuesLocker.Lock()
+	c.assigned = true
+	c.updateQueues(func(q *message.Queue) bool { return true }, queues)
+	c.queuesLocker.Unlock()
+	return nil
+}
+
+// Unsubscribe unsubscribes the topic, and stops pulling the messages of it
+func (c *LitePullConsumer) Unsubscribe(topic string) {
+	c.consumer.Unsubscribe(topic)
+
+	c.queuesLocker.Lock()
+	c.updateQueues(func(q *message.Queue) bool { return q.Topic == topic }, nil)
+	c.queuesLocker.Unlock()
+}
+
+func (c *LitePullConsumer) reblance(topic string) {
+	allQueues, newQueues, err := c.reblanceQueue(topic)
+	if err != nil {
+		c.Logger.Errorf("reblance queue error:%s", err)
+		return
+	}
+	if len(allQueues) == 0 {
+		return
+	}
+
+	c.queuesLocker.Lock()
+	if !c.assigned {
+		c.updateQueues(func(q *message.Queue) bool { return q.Topic == topic }, newQueues)
+	}
+	c.queuesLocker.Unlock()
+}
+
+// updateQueues replaces the queues in the scope with the new ones, the queues locker MUST be held
+func (c *LitePullConsumer) updateQueues(inScope func(*message.Queue) bool, queues []*message.Queue) {
+	newQueues := make(map[message.Queue]bool, len(queues))
+	for _, q := range queues {
+		newQueues[*q] = true
+	}
+
+	changed := false
+	for q, lq := range c.queues {
+		if !inScope(&q) || newQueues[q] {
+			continue
+		}
+
+		lq.drop()
+		delete(c.queues, q)
+		if c.pulling {
+			if c.AutoCommit {
+				c.commit(lq)
+			}
+			c.offseter.PersistOne(&q)
+			c.offseter.RemoveOffset(&q)
+		}
+		c.Logger.Infof("lite pull consumer %s, remove queue %s", c.GroupName, &q)
+		changed = true
+	}
+
+	for q := range newQueues {
+		if _, ok := c.queues[q]; ok {
+			continue
+		}
+
+		lq := newLiteQueue(q)
+		c.queues[q] = lq
+		if c.pulling {
+			c.startPulling(lq)
+		}
+		c.Logger.Infof("lite pull consumer %s, add queue %s", c.GroupName, &q)
+		changed = true
+	}
+
+	if changed && c.pulling {
+		all := make([]*message.Queue, 0, len(c.queues))
+		for q := range c.queues {
+			q := q
+			all = append(all, &q)
+		}
+		c.offseter.UpdateQueues(all...)
+	}
+}
+
+// Queues returns the queues pulled by the consumer
+func (c *LitePullConsumer) Queues() []message.Queue {
+	c.queuesLocker.Lock()
+	qs := make([]message.Queue, 0, len(c.queues))
+	for q := range c.queues {
+		qs = append(qs, q)
+	}
+	c.queuesLocker.Unlock()
+	return qs
+}
+
+func (c *LitePullConsumer) liteQueue(q *message.Queue) (*liteQueue, bool) {
+	c.queuesLocker.Lock()
+	lq, ok := c.queues[*q]
+	c.queuesLocker.Unlock()
+	return lq, ok
+}
+
+func (c *LitePullConsumer) startPulling(lq *liteQueue) {
+	c.Add(1)
+	go func() {
+		defer c.Done()
+		for {
+			delay := c.pullOnce(lq)
+			if delay < 0 {
+				return
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-lq.stop:
+				return
+			case <-c.exitChan:
+				return
+			}
+		}
+	}()
+}
+
+// pullOnce pulls the messages of the queue, returns the delay of the next pulling,
+// the negative one means stopping
+func (c *LitePullConsumer) pullOnce(lq *liteQueue) time.Duration {
+	offset, version, cachedCount, dropped := lq.pullState()
+	if dropped {
+		return -1
+	}
+
+	if cachedCount >= c.PullThresholdForQueue {
+		return pullTimeDelayWhenFlowControl
+	}
+
+	q := &lq.queue
+	if offset < 0 {
+		var err error
+		if offset, err = c.computePullOffset(q); err != nil {
+			c.Logger.Errorf("compute the offset to pull of queue %s error:%s", q, err)
+			return pullTimeDelayWhenException
+		}
+		lq.initOffset(version, offset)
+	}
+
+	selector := ByTag(subAll)
+	if d := c.subscribeData.Get(q.Topic); d != nil {
+		selector = MessageSelector{Type: d.Typ, Expr: d.Expr}
+	}
+
+	pr, err := c.pullSync(q, selector, offset, c.PullBatchSize, true)
+	if err != nil {
+		c.Logger.Errorf("pull message of queue %s error:%s", q, err)
+		return pullTimeDelayWhenException
+	}
+
+	switch pr.Status {
+	case Found:
+		b := &liteBatch{queue: lq, version: version, nextOffset: pr.NextBeginOffset, messages: pr.Messages}
+		if !lq.pulled(b) {
+			return 0
+		}
+		if len(b.messages) == 0 {
+			return 0
+		}
+
+		select {
+		case c.batches <- b:
+		case <-lq.stop:
+			return -1
+		case <-c.exitChan:
+			return -1
+		}
+		return 0
+	case NoNewMessage, NoMatchedMessage:
+		lq.pulled(&liteBatch{version: version, nextOffset: pr.NextBeginOffset})
+		return litePullDelayWhenNotFound
+	case OffsetIllegal:
+		c.Logger.Warnf(
+			"offset of queue:%s is illegal, from %d to %d", q, offset, pr.NextBeginOffset,
+		)
+		lq.pulled(&liteBatch{version: version, nextOffset: pr.NextBeginOffset})
+		return 0
+	default:
+		return pullTimeDelayWhenException
+	}
+}
+
+func (c *LitePullConsumer) computePullOffset(q *message.Queue) (int64, error) {
+	offset, err := c.offseter.ReadOffset(q, ReadOffsetFromStore)
+	if err == nil && offset >= 0 {
+		return offset, nil
+	}
+
+	if err != nil && err != ErrOffsetNotExist {
+		return 0, err
+	}
+
+	if c.FromWhere == consumeFromFirstOffset {
+		return c.QueryMinOffset(q)
+	}
+	return c.QueryMaxOffset(q)
+}
+
+// Poll returns the messages pulled in the background, waits at most timeout if no message,
+// the consume offsets are moved after the returned messages
+func (c *LitePullConsumer) Poll(timeout time.Duration) []*message.MessageExt {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case b := <-c.batches:
+			if b.queue.polled(b) {
+				return b.messages
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// Commit commits the consume offsets of the polled messages to the offset store
+func (c *LitePullConsumer) Commit() {
+	c.queuesLocker.Lock()
+	lqs := make([]*liteQueue, 0, len(c.queues))
+	for _, lq := range c.queues {
+		lqs = append(lqs, lq)
+	}
+	c.queuesLocker.Unlock()
+
+	for _, lq := range lqs {
+		c.commit(lq)
+	}
+}
+
+func (c *LitePullConsumer) commit(lq *liteQueue) {
+	if offset, ok := lq.offsetToCommit(); ok {
+		c.resetOffset(&lq.queue, offset)
+	}
+}
+
+// CommittedOffset returns the committed offset of the queue
+func (c *LitePullConsumer) CommittedOffset(q *message.Queue) (int64, error) {
+	return c.offseter.ReadOffset(q, ReadOffsetMemoryFirstThenStore)
+}
+
+// Seek pulls the messages of the queue from the offset, the pulled messages not polled are discarded
+func (c *LitePullConsumer) Seek(q *message.Queue, offset int64) error {
+	lq, ok := c.liteQueue(q)
+	if !ok {
+		return errQueueNotAssigned
+	}
+
+	min, err := c.QueryMinOffset(q)
+	if err != nil {
+		return err
+	}
+	max, err := c.QueryMaxOffset(q)
+	if err != nil {
+		return err
+	}
+	if offset < min || offset > max {
+		return errOffsetOutOfRange
+	}
+
+	lq.seek(offset)
+	return nil
+}
+
+// SeekToBegin pulls the messages of the queue from the min offset
+func (c *LitePullConsumer) SeekToBegin(q *message.Queue) error {
+	offset, err := c.QueryMinOffset(q)
+	if err != nil {
+		return err
+	}
+	return c.Seek(q, offset)
+}
+
+// SeekToEnd pulls the messages of the queue from the max offset
+func (c *LitePullConsumer) SeekToEnd(q *message.Queue) error {
+	offset, err := c.QueryMaxOffset(q)
+	if err != nil {
+		return err
+	}
+	return c.Seek(q, offset)
+}
+
+// SeekByTimestamp pulls the messages of the queue stored since the timestamp
+func (c *LitePullConsumer) SeekByTimestamp(q *message.Queue, timestamp time.Time) error {
+	offset, err := c.SearchOffset(q, timestamp)
+	if err != nil {
+		return err
+	}
+	return c.Seek(q, offset)
+}
+
+func newLiteQueue(q message.Queue) *liteQueue {
+	return &liteQueue{
+		queue:           q,
+		nextOffset:      -1,
+		consumeOffset:   -1,
+		committedOffset: -1,
+		stop:            make(chan struct{}),
+	}
+}
+
+func (lq *liteQueue) pullState() (offset, version int64, cachedCount int, dropped bool) {
+	lq.Lock()
+	offset, version, cachedCount, dropped = lq.nextOffset, lq.version, lq.cachedCount, lq.dropped
+	lq.Unlock()
+	return
+}
+
+func (lq *liteQueue) initOffset(version, offset int64) {
+	lq.Lock()
+	if lq.version == version && lq.nextOffset < 0 {
+		lq.nextOffset = offset
+		lq.consumeOffset = offset
+		lq.committedOffset = offset
+	}
+	lq.Unlock()
+}
+
+// pulled moves the offset to pull, and caches the messages,
+// returns false if the queue is seeked or dropped during pulling
+func (lq *liteQueue) pulled(b *liteBatch) bool {
+	lq.Lock()
+	defer lq.Unlock()
+
+	if lq.dropped || lq.version != b.version {
+		return false
+	}
+
+	lq.nextOffset = b.nextOffset
+	if len(b.messages) == 0 {
+		if lq.cachedCount == 0 {
+			lq.consumeOffset = b.nextOffset
+		}
+		return true
+	}
+
+	lq.cachedCount += len(b.messages)
+	return true
+}
+
+// polled moves the consume offset after the messages,
+// returns false if the queue is seeked or dropped after pulling
+func (lq *liteQueue) polled(b *liteBatch) bool {
+	lq.Lock()
+	defer lq.Unlock()
+
+	if lq.dropped || lq.version != b.version {
+		return false
+	}
+
+	lq.cachedCount -= len(b.messages)
+	lq.consumeOffset = b.nextOffset
+	return true
+}
+
+func (lq *liteQueue) offsetToCommit() (int64, bool) {
+	lq.Lock()
+	defer lq.Unlock()
+
+	if lq.consumeOffset < 0 || lq.consumeOffset == lq.committedOffset {
+		return 0, false
+	}
+	lq.committedOffset = lq.consumeOffset
+	return lq.consumeOffset, true
+}
+
+func (lq *liteQueue) seek(offset int64) {
+	lq.Lock()
+	lq.version++
+	lq.nextOffset = offset
+	lq.consumeOffset = offset
+	lq.cachedCount = 0
+	lq.Unlock()
+}
+
+func (lq *liteQueue) drop() {
+	lq.Lock()
+	if !lq.dropped {
+		lq.dropped = true
+		close(lq.stop)
+	}
+	lq.Unlock()
+}
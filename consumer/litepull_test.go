@@ -0,0 +1,219 @@
+package consumer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/client"
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+// mockLitePullRPC pulls the messages from the queue with the offsets in [minOffset, maxOffset)
+type mockLitePullRPC struct {
+	mockConsumerRPC
+
+	sync.Mutex
+	pullOffsets []int64
+}
+
+func (r *mockLitePullRPC) PullMessageSync(
+	addr string, header *rpc.PullHeader, to time.Duration,
+) (*rpc.PullResponse, error) {
+	r.Lock()
+	r.pullOffsets = append(r.pullOffsets, header.QueueOffset)
+	r.Unlock()
+
+	resp := &rpc.PullResponse{MinOffset: r.minOffset, MaxOffset: r.maxOffset}
+	offset := header.QueueOffset
+	switch {
+	case offset < r.minOffset || offset > r.maxOffset:
+		resp.Code, resp.NextBeginOffset = rpc.PullOffsetMoved, r.minOffset
+		return resp, nil
+	case offset == r.maxOffset:
+		time.Sleep(time.Millisecond * 10) // suspended by the broker
+		resp.Code, resp.NextBeginOffset = rpc.PullNotFound, offset
+		return resp, nil
+	}
+
+	resp.Code = rpc.Success
+	for ; offset < r.maxOffset && len(resp.Messages) < int(header.MaxCount); offset++ {
+		resp.Messages = append(resp.Messages, &message.MessageExt{
+			Message:     message.Message{Topic: header.Topic},
+			QueueOffset: offset,
+		})
+	}
+	resp.NextBeginOffset = offset
+	return resp, nil
+}
+
+func newTestLitePullConsumer(r rpcI) *LitePullConsumer {
+	c := NewLitePullConsumer("test lite pull consumer", []string{"dummy"}, &log.MockLogger{})
+	c.rpc = r
+	c.client = &mockMQClient{brokderAddr: "mock"}
+	c.offseter = NewMemoryOffsetStore()
+	c.exitChan = make(chan struct{})
+	c.subscribeData = client.NewDataTable()
+	c.subscribeQueues = client.NewQueueTable()
+	c.topicRouters = route.NewTopicRouterTable()
+	c.brokerSuggester.table = make(map[string]int32)
+	c.pulling = true
+	return c
+}
+
+// pollOffsets polls the messages until the count is reached, returns the offsets of them
+func pollOffsets(c *LitePullConsumer, count int) []int64 {
+	var offsets []int64
+	for len(offsets) < count {
+		msgs := c.Poll(time.Second)
+		if len(msgs) == 0 {
+			break
+		}
+		for _, m := range msgs {
+			offsets = append(offsets, m.QueueOffset)
+		}
+	}
+	return offsets
+}
+
+func rangeOffsets(from, to int64) []int64 {
+	var offsets []int64
+	for i := from; i < to; i++ {
+		offsets = append(offsets, i)
+	}
+	return offsets
+}
+
+func TestLitePullConsumer(t *testing.T) {
+	r := &mockLitePullRPC{}
+	r.minOffset, r.maxOffset, r.searchOffsetByTimestampRet = 0, 25, 20
+	c := newTestLitePullConsumer(r)
+	c.PullBatchSize = 4
+
+	q := &message.Queue{Topic: "TestLitePullConsumer", BrokerName: "b"}
+	c.offseter.UpdateOffsetIfGreater(q, 5)
+	c.offseter.PersistOne(q)
+	assert.Nil(t, c.Assign([]*message.Queue{q}))
+	assert.Equal(t, []message.Queue{*q}, c.Queues())
+
+	// poll from the offset in the store
+	assert.Equal(t, rangeOffsets(5, 25), pollOffsets(c, 20))
+	assert.Nil(t, c.Poll(time.Millisecond*50))
+
+	// commit
+	c.Commit()
+	offset, err := c.CommittedOffset(q)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(25), offset)
+
+	// seek
+	assert.Nil(t, c.Seek(q, 10))
+	assert.Equal(t, rangeOffsets(10, 25), pollOffsets(c, 15))
+	assert.Nil(t, c.SeekToBegin(q))
+	assert.Equal(t, rangeOffsets(0, 25), pollOffsets(c, 25))
+	assert.Nil(t, c.SeekByTimestamp(q, time.Now()))
+	assert.Equal(t, rangeOffsets(20, 25), pollOffsets(c, 5))
+	assert.Nil(t, c.SeekToEnd(q))
+	assert.Nil(t, c.Poll(time.Millisecond*50))
+
+	assert.Equal(t, errOffsetOutOfRange, c.Seek(q, 26))
+	assert.Equal(t, errOffsetOutOfRange, c.Seek(q, -1))
+	assert.Equal(t, errQueueNotAssigned, c.Seek(&message.Queue{}, 1))
+
+	// the committed offset is not changed by seeking until committing
+	offset, _ = c.CommittedOffset(q)
+	assert.Equal(t, int64(25), offset)
+	assert.Nil(t, c.Seek(q, 3))
+	assert.Equal(t, []int64{3, 4, 5, 6}, pollOffsets(c, 1))
+	c.Commit()
+	offset, _ = c.CommittedOffset(q)
+	assert.Equal(t, int64(7), offset)
+
+	// the removed queue is committed, and stops pulling
+	assert.Nil(t, c.Assign(nil))
+	assert.Equal(t, 0, len(c.Queues()))
+	offset, _ = c.offseter.ReadOffset(q, ReadOffsetFromMemory)
+	assert.Equal(t, int64(-1), offset)
+	offset, _ = c.offseter.ReadOffset(q, ReadOffsetFromStore)
+	assert.Equal(t, int64(7), offset)
+
+	close(c.exitChan)
+	c.Wait()
+}
+
+func TestLitePullOffsetMoved(t *testing.T) {
+	r := &mockLitePullRPC{}
+	r.minOffset, r.maxOffset = 10, 12
+	c := newTestLitePullConsumer(r)
+
+	q := &message.Queue{Topic: "TestLitePullOffsetMoved", BrokerName: "b"}
+	c.offseter.UpdateOffsetIfGreater(q, 1)
+	c.offseter.PersistOne(q)
+	assert.Nil(t, c.Assign([]*message.Queue{q}))
+	assert.Equal(t, []int64{10, 11}, pollOffsets(c, 2))
+
+	close(c.exitChan)
+	c.Wait()
+	assert.Equal(t, []int64{1, 10, 12}, r.pullOffsets[:3])
+}
+
+func TestLitePullFlowControl(t *testing.T) {
+	r := &mockLitePullRPC{}
+	r.maxOffset = 100
+	c := newTestLitePullConsumer(r)
+	c.pulling = false
+	c.PullBatchSize, c.PullThresholdForQueue = 10, 20
+
+	q := &message.Queue{Topic: "TestLitePullFlowControl", BrokerName: "b"}
+	c.offseter.UpdateOffsetIfGreater(q, 0)
+	c.offseter.PersistOne(q)
+	assert.Nil(t, c.Assign([]*message.Queue{q}))
+	lq, _ := c.liteQueue(q)
+
+	assert.Equal(t, time.Duration(0), c.pullOnce(lq))
+	assert.Equal(t, time.Duration(0), c.pullOnce(lq))
+	assert.Equal(t, pullTimeDelayWhenFlowControl, c.pullOnce(lq))
+	assert.Equal(t, 2, len(c.batches))
+
+	// pull again after polling
+	assert.Equal(t, 10, len(c.Poll(time.Millisecond)))
+	assert.Equal(t, time.Duration(0), c.pullOnce(lq))
+
+	// the dropped queue stops pulling
+	lq.drop()
+	assert.True(t, c.pullOnce(lq) < 0)
+	assert.Nil(t, c.Poll(time.Millisecond))
+}
+
+func TestLitePullSubscribe(t *testing.T) {
+	r := &mockLitePullRPC{}
+	r.maxOffset, r.clientIDs = 10, []string{"a", "b"}
+	c := newTestLitePullConsumer(r)
+	c.pulling = false
+	c.ClientID = "a"
+
+	topic := "TestLitePullSubscribe"
+	c.Subscribe(topic)
+	assert.Equal(t, errSubscribedAndAssign, c.Assign(nil))
+
+	qs := []*message.Queue{{Topic: topic}, {Topic: topic, QueueID: 1}}
+	c.subscribeQueues.Put(topic, qs)
+	c.topicRouters.Put(topic, &route.TopicRouter{
+		Brokers: []*route.Broker{{Addresses: map[int32]string{0: "mock"}}},
+	})
+	c.reblance(topic)
+	assert.Equal(t, []message.Queue{*qs[0]}, c.Queues())
+
+	// clustering with one client
+	r.clientIDs = []string{"a"}
+	c.reblance(topic)
+	assert.Equal(t, 2, len(c.Queues()))
+
+	c.Unsubscribe(topic)
+	assert.Equal(t, 0, len(c.Queues()))
+}
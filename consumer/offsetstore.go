@@ -9,9 +9,29 @@ import (
 )
 
 var (
-	errOffsetNotExist = errors.New("offset not exist")
+	// ErrOffsetNotExist the offset of the queue is not in the store
+	ErrOffsetNotExist = errors.New("offset not exist")
 )
 
+// OffsetStore stores the consume offsets of the queues
+type OffsetStore interface {
+	// Load loads the offsets from the store, called when the consumer starts
+	Load() error
+	// UpdateQueues updates the queues assigned to the consumer
+	UpdateQueues(...*message.Queue)
+	// UpdateOffsetIfGreater updates the offset in the memory if it's greater than the current one
+	UpdateOffsetIfGreater(mq *message.Queue, offset int64)
+	// ReadOffset returns the offset of the queue by the read offset type,
+	// returns ErrOffsetNotExist if the offset is not in the store
+	ReadOffset(mq *message.Queue, readType int) (offset int64, err error)
+	// RemoveOffset removes the offset of the queue from the memory
+	RemoveOffset(mq *message.Queue) (offset int64, ok bool)
+	// PersistOne persists the offset of the queue
+	PersistOne(mq *message.Queue)
+	// Persist persists all the offsets in the memory
+	Persist() error
+}
+
 // read offset type
 const (
 	ReadOffsetFromMemory = iota
@@ -33,21 +53,27 @@ func newOffsets(broker string) *offsets {
 func (of *offsets) updateIfGreater(q *message.Queue, offset int64) {
 	of.Lock()
 	o, ok := of.OffsetOfTopic[q.QueueID][q.Topic]
-	if ok && o < offset {
-		of.OffsetOfTopic[q.QueueID][q.Topic] = offset
+	if !ok || o < offset {
+		of.set(q, offset)
 	}
 	of.Unlock()
 }
 
 func (of *offsets) update(q *message.Queue, offset int64) {
 	of.Lock()
-	_, ok := of.OffsetOfTopic[q.QueueID][q.Topic]
-	if ok {
-		of.OffsetOfTopic[q.QueueID][q.Topic] = offset
-	}
+	of.set(q, offset)
 	of.Unlock()
 }
 
+func (of *offsets) set(q *message.Queue, offset int64) {
+	m := of.OffsetOfTopic[q.QueueID]
+	if m == nil {
+		m = make(map[string]int64)
+		of.OffsetOfTopic[q.QueueID] = m
+	}
+	m[q.Topic] = offset
+}
+
 func (of *offsets) remove(q *message.Queue) (offset int64, ok bool) {
 	of.Lock()
 	m := of.OffsetOfTopic[q.QueueID]
@@ -159,17 +185,43 @@ func (bs *baseStore) queuesAndOffsets() (queues []message.Queue, offsets []int64
 	return
 }
 
+// copyOffsets returns the copy of the offsets, which is safe to marshal
+func (bs *baseStore) copyOffsets() []*offsets {
+	bs.RLock()
+	ofs := bs.Offsets
+	bs.RUnlock()
+
+	r := make([]*offsets, len(ofs))
+	for i, of := range ofs {
+		c := newOffsets(of.Broker)
+		of.RLock()
+		for qid, m := range of.OffsetOfTopic {
+			if m == nil {
+				continue
+			}
+
+			c.OffsetOfTopic[qid] = make(map[string]int64, len(m))
+			for t, o := range m {
+				c.OffsetOfTopic[qid][t] = o
+			}
+		}
+		of.RUnlock()
+		r[i] = c
+	}
+	return r
+}
+
 func (bs *baseStore) updateOffset(q *message.Queue, offset int64) {
 	bs.updateOffset0(q, offset, false)
 }
 
-func (bs *baseStore) updateOffsetIfGreater(q *message.Queue, offset int64) {
+func (bs *baseStore) UpdateOffsetIfGreater(q *message.Queue, offset int64) {
 	bs.updateOffset0(q, offset, true)
 }
 
-// readOffset returns the offset of the queue
-// return -1 if the queue is not exist
-func (bs *baseStore) readOffset(q *message.Queue, readOffsetType int) (int64, error) {
+// ReadOffset returns the offset of the queue
+// return -1 if the queue is not exist in the memory
+func (bs *baseStore) ReadOffset(q *message.Queue, readOffsetType int) (int64, error) {
 	switch readOffsetType {
 	case ReadOffsetMemoryFirstThenStore:
 		of, ok := bs.readOffsetFromMemory(q)
@@ -190,7 +242,7 @@ func (bs *baseStore) readOffset(q *message.Queue, readOffsetType int) (int64, er
 	}
 }
 
-func (bs *baseStore) removeOffset(q *message.Queue) (int64, bool) {
+func (bs *baseStore) RemoveOffset(q *message.Queue) (int64, bool) {
 	var offsets *offsets
 	bs.RLock()
 	for _, of := range bs.Offsets {
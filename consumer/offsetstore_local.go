@@ -13,13 +13,15 @@ import (
 type localStore struct {
 	*baseStore
 
-	path string
+	path  string
+	fsync bool
 }
 
 type localStoreConfig struct {
 	rootPath string
 	clientID string
 	group    string
+	fsync    bool
 }
 
 func newLocalStore(conf localStoreConfig) (*localStore, error) {
@@ -42,14 +44,14 @@ func newLocalStore(conf localStoreConfig) (*localStore, error) {
 	ls := &localStore{
 		baseStore: &baseStore{Offsets: make([]*offsets, 0, 8)},
 		path:      filepath.Join(conf.rootPath, conf.clientID, conf.group, "offsets.json"),
+		fsync:     conf.fsync,
 	}
 	ls.baseStore.readOffsetFromStore = ls.readOffsetFromStore
-
-	ls.load()
 	return ls, nil
 }
 
-func (ls *localStore) load() error {
+// Load loads the offsets from the local file
+func (ls *localStore) Load() error {
 	of, err := loadFromFiles(ls.path)
 	if err != nil {
 		return err
@@ -59,31 +61,30 @@ func (ls *localStore) load() error {
 }
 
 // loadFromFiles returns the offset data
-// if the path is not exist, try to load from the bak file
+// if the path is not exist or broken, try to load from the bak file
 func loadFromFiles(path string) (of []*offsets, err error) {
 	of, err = loadFromFile(path)
 	if err == nil {
 		return
 	}
 
-	if !os.IsNotExist(err) { // ignore the file not exist
-		return
+	of, bakErr := loadFromFile(bakPath(path))
+	if bakErr == nil {
+		return of, nil
 	}
 
-	of, err = loadFromFile(bakPath(path))
-	if os.IsNotExist(err) { // ignore the file not exist
-		err = nil
+	if !os.IsNotExist(err) {
+		return nil, err
 	}
-	return
-}
 
-func loadFromFile(path string) (of []*offsets, err error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return
+	if os.IsNotExist(bakErr) { // ignore the file not exist
+		return nil, nil
 	}
+	return nil, bakErr
+}
 
-	d, err := ioutil.ReadAll(file)
+func loadFromFile(path string) (of []*offsets, err error) {
+	d, err := ioutil.ReadFile(path)
 	if err != nil {
 		return
 	}
@@ -99,69 +100,86 @@ func (ls *localStore) readOffsetFromStore(q *message.Queue) (int64, error) {
 	}
 
 	offset, ok := readOffset(offsets, q)
-	if ok {
-		ls.updateOffset(q, offset)
+	if !ok {
+		return 0, ErrOffsetNotExist
 	}
+
+	ls.updateOffset(q, offset)
 	return offset, nil
 }
 
-func (ls *localStore) persist() error {
+// Persist writes the offsets to the temporary file, then replaces the current file with it
+// the current file is kept as the bak file
+func (ls *localStore) Persist() error {
 	if err := ls.makeSureDir(); err != nil {
 		return err
 	}
 
-	// write to temporary file
-	d, err := json.Marshal(ls.Offsets)
+	d, err := json.Marshal(ls.copyOffsets())
 	if err != nil {
 		return err
 	}
+
 	tmpName := ls.path + ".tmp"
-	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE, 0666)
-	_, err = f.Write(d)
-	if err != nil {
-		return err
-	}
-	if err = f.Close(); err != nil {
+	if err = writeFile(tmpName, d, ls.fsync); err != nil {
 		return err
 	}
 
 	// backup
-	f, err = os.Open(ls.path)
-	if os.IsNotExist(err) {
-		goto RENAME
-	}
-	if err != nil {
+	err = os.Rename(ls.path, bakPath(ls.path))
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	d, err = ioutil.ReadAll(f)
-	if err != nil {
+
+	if err = os.Rename(tmpName, ls.path); err != nil {
 		return err
 	}
-	if err = f.Close(); err != nil {
-		return err
+
+	if ls.fsync {
+		return syncDir(filepath.Dir(ls.path))
 	}
+	return nil
+}
 
-	f, err = os.OpenFile(bakPath(ls.path), os.O_RDWR|os.O_CREATE, 0666)
+func writeFile(path string, d []byte, fsync bool) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
+
 	_, err = f.Write(d)
+	if err == nil && fsync {
+		err = f.Sync()
+	}
+
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+
 	if err != nil {
-		return err
+		os.Remove(path)
 	}
-	if err = f.Close(); err != nil {
+	return err
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
 		return err
 	}
 
-RENAME:
-	return os.Rename(tmpName, ls.path)
+	err = f.Sync()
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
 }
 
 func (ls *localStore) makeSureDir() error {
 	return os.MkdirAll(filepath.Dir(ls.path), os.ModePerm)
 }
 
-func (ls *localStore) updateQueues(qs ...*message.Queue) {
+func (ls *localStore) UpdateQueues(qs ...*message.Queue) {
 	// DO NOTHING
 }
 
@@ -169,4 +187,4 @@ func bakPath(path string) string {
 	return path + ".bak"
 }
 
-func (ls *localStore) persistOne(mq *message.Queue) {}
+func (ls *localStore) PersistOne(mq *message.Queue) {}
@@ -1,6 +1,7 @@
 package consumer
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -39,43 +40,43 @@ func TestLocalOffset(t *testing.T) {
 		group:    "group",
 	})
 	assert.Nil(t, err)
-	err = ls.load()
+	err = ls.Load()
 	t.Log(err)
 	assert.Nil(t, err)
 
 	q := &message.Queue{Topic: "TestLocalOffset", BrokerName: "b", QueueID: 1}
 	ls.updateOffset(q, 1)
-	of, err := ls.readOffset(q, ReadOffsetFromMemory)
+	of, err := ls.ReadOffset(q, ReadOffsetFromMemory)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(1), of)
 
-	ls.updateOffsetIfGreater(q, 0)
-	of, err = ls.readOffset(q, ReadOffsetFromMemory)
+	ls.UpdateOffsetIfGreater(q, 0)
+	of, err = ls.ReadOffset(q, ReadOffsetFromMemory)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(1), of)
 
-	ls.updateOffsetIfGreater(q, 2)
-	of, err = ls.readOffset(q, ReadOffsetFromMemory)
+	ls.UpdateOffsetIfGreater(q, 2)
+	of, err = ls.ReadOffset(q, ReadOffsetFromMemory)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(2), of)
 
-	of, err = ls.readOffset(q, ReadOffsetFromStore)
-	assert.Nil(t, err)
+	of, err = ls.ReadOffset(q, ReadOffsetFromStore)
+	assert.Equal(t, ErrOffsetNotExist, err)
 
-	of, err = ls.readOffset(q, ReadOffsetMemoryFirstThenStore)
+	of, err = ls.ReadOffset(q, ReadOffsetMemoryFirstThenStore)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(2), of)
 
-	of, err = ls.readOffset(&message.Queue{BrokerName: "notexist"}, ReadOffsetFromMemory)
+	of, err = ls.ReadOffset(&message.Queue{BrokerName: "notexist"}, ReadOffsetFromMemory)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(-1), of)
 
-	of, err = ls.readOffset(&message.Queue{BrokerName: "notexist"}, ReadOffsetMemoryFirstThenStore)
-	assert.Nil(t, err)
+	of, err = ls.ReadOffset(&message.Queue{BrokerName: "notexist"}, ReadOffsetMemoryFirstThenStore)
+	assert.Equal(t, ErrOffsetNotExist, err)
 
-	assert.Nil(t, ls.persist())
+	assert.Nil(t, ls.Persist())
 	// backup
-	assert.Nil(t, ls.persist())
+	assert.Nil(t, ls.Persist())
 	f, err := os.Open(bakPath(ls.path))
 	f.Close()
 	assert.Nil(t, err)
@@ -87,12 +88,12 @@ func TestLocalOffset(t *testing.T) {
 	})
 	assert.Nil(t, err)
 
-	assert.Nil(t, ls.load())
-	of, err = ls.readOffset(q, ReadOffsetFromMemory)
+	assert.Nil(t, ls.Load())
+	of, err = ls.ReadOffset(q, ReadOffsetFromMemory)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(2), of)
 
-	of, err = ls.readOffset(q, ReadOffsetFromStore)
+	of, err = ls.ReadOffset(q, ReadOffsetFromStore)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(2), of)
 
@@ -108,6 +109,80 @@ func TestLocalOffset(t *testing.T) {
 	remove(ls)
 }
 
+func TestLocalOffsetRecovery(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-offset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	newStore := func() *localStore {
+		ls, err := newLocalStore(localStoreConfig{rootPath: root, clientID: "c", group: "g", fsync: true})
+		assert.Nil(t, err)
+		return ls
+	}
+
+	readOffset := func(q *message.Queue) int64 {
+		ls := newStore()
+		assert.Nil(t, ls.Load())
+		of, err := ls.ReadOffset(q, ReadOffsetFromMemory)
+		assert.Nil(t, err)
+		return of
+	}
+
+	q := &message.Queue{Topic: "TestLocalOffsetRecovery", BrokerName: "b", QueueID: 1}
+	ls := newStore()
+	assert.Nil(t, ls.Load())
+	ls.updateOffset(q, 1000)
+	assert.Nil(t, ls.Persist())
+	ls.updateOffset(q, 2)
+	assert.Nil(t, ls.Persist())
+	assert.Equal(t, int64(2), readOffset(q)) // shorter content than the previous one
+
+	_, err = os.Stat(ls.path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// truncated file, load from the bak
+	d, err := ioutil.ReadFile(ls.path)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(ls.path, d[:len(d)/2], 0666))
+	assert.Equal(t, int64(1000), readOffset(q))
+
+	of, err := ls.ReadOffset(q, ReadOffsetFromStore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), of)
+
+	// empty file, load from the bak
+	assert.Nil(t, ioutil.WriteFile(ls.path, nil, 0666))
+	assert.Equal(t, int64(1000), readOffset(q))
+
+	// crash after the backup, before the rename
+	assert.Nil(t, os.Remove(ls.path))
+	assert.Equal(t, int64(1000), readOffset(q))
+
+	// both broken
+	assert.Nil(t, ioutil.WriteFile(ls.path, d[:1], 0666))
+	assert.Nil(t, ioutil.WriteFile(bakPath(ls.path), d[:2], 0666))
+	assert.NotNil(t, newStore().Load())
+
+	// broken bak only
+	assert.Nil(t, os.Remove(ls.path))
+	assert.NotNil(t, newStore().Load())
+
+	// recover by persisting
+	ls.updateOffset(q, 3)
+	assert.Nil(t, ls.Persist())
+	assert.Equal(t, int64(3), readOffset(q))
+
+	// nothing exists
+	assert.Nil(t, os.Remove(ls.path))
+	assert.Nil(t, os.Remove(bakPath(ls.path)))
+	ls = newStore()
+	assert.Nil(t, ls.Load())
+	_, err = ls.ReadOffset(q, ReadOffsetFromStore)
+	assert.Equal(t, ErrOffsetNotExist, err)
+}
+
 func remove(ls *localStore) {
 	os.RemoveAll("testdata")
 }
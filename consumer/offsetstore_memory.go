@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+)
+
+// MemoryOffsetStore stores the offsets in the memory only, the offsets are lost when the process exits
+// it's useful for testing
+type MemoryOffsetStore struct {
+	*baseStore
+
+	// the persisted offsets, which are kept after the queue removed
+	persistedLocker sync.RWMutex
+	persisted       map[message.Queue]int64
+}
+
+// NewMemoryOffsetStore creates the offset store in the memory
+func NewMemoryOffsetStore() *MemoryOffsetStore {
+	ms := &MemoryOffsetStore{baseStore: &baseStore{}, persisted: make(map[message.Queue]int64)}
+	ms.baseStore.readOffsetFromStore = ms.readOffsetFromStore
+	return ms
+}
+
+func (ms *MemoryOffsetStore) readOffsetFromStore(q *message.Queue) (int64, error) {
+	ms.persistedLocker.RLock()
+	of, ok := ms.persisted[*q]
+	ms.persistedLocker.RUnlock()
+	if !ok {
+		return 0, ErrOffsetNotExist
+	}
+
+	ms.updateOffset(q, of)
+	return of, nil
+}
+
+// Load does nothing
+func (ms *MemoryOffsetStore) Load() error {
+	return nil
+}
+
+// UpdateQueues does nothing, the offsets of the queues are kept
+func (ms *MemoryOffsetStore) UpdateQueues(qs ...*message.Queue) {}
+
+// PersistOne persists the offset of the queue
+func (ms *MemoryOffsetStore) PersistOne(q *message.Queue) {
+	of, ok := ms.readOffsetFromMemory(q)
+	if !ok {
+		return
+	}
+
+	ms.persistedLocker.Lock()
+	ms.persisted[*q] = of
+	ms.persistedLocker.Unlock()
+}
+
+// Persist persists the offsets of all the queues
+func (ms *MemoryOffsetStore) Persist() error {
+	queues, offsets := ms.queuesAndOffsets()
+	ms.persistedLocker.Lock()
+	for i, q := range queues {
+		ms.persisted[q] = offsets[i]
+	}
+	ms.persistedLocker.Unlock()
+	return nil
+}
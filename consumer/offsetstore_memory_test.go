@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+)
+
+func TestMemoryOffsetStore(t *testing.T) {
+	var s OffsetStore = NewMemoryOffsetStore()
+	assert.Nil(t, s.Load())
+
+	q := &message.Queue{Topic: "TestMemoryOffsetStore", BrokerName: "b", QueueID: 1}
+	_, err := s.ReadOffset(q, ReadOffsetFromStore)
+	assert.Equal(t, ErrOffsetNotExist, err)
+
+	of, err := s.ReadOffset(q, ReadOffsetFromMemory)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), of)
+
+	s.UpdateOffsetIfGreater(q, 2)
+	s.UpdateOffsetIfGreater(q, 1)
+	for _, typ := range []int{ReadOffsetFromMemory, ReadOffsetMemoryFirstThenStore} {
+		of, err = s.ReadOffset(q, typ)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), of)
+	}
+	_, err = s.ReadOffset(q, ReadOffsetFromStore) // not persisted
+	assert.Equal(t, ErrOffsetNotExist, err)
+
+	s.UpdateQueues()
+	s.PersistOne(q)
+	of, err = s.ReadOffset(q, ReadOffsetFromStore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), of)
+
+	// another queue of the same broker
+	q1 := &message.Queue{Topic: "TestMemoryOffsetStore", BrokerName: "b", QueueID: 2}
+	s.UpdateOffsetIfGreater(q1, 3)
+	assert.Nil(t, s.Persist())
+	of, err = s.ReadOffset(q1, ReadOffsetFromStore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), of)
+
+	// the persisted offset is kept after the queue removed
+	of, ok := s.RemoveOffset(q)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), of)
+	of, err = s.ReadOffset(q, ReadOffsetFromMemory)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), of)
+	of, err = s.ReadOffset(q, ReadOffsetMemoryFirstThenStore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), of)
+	of, err = s.ReadOffset(q, ReadOffsetFromMemory) // added back
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), of)
+}
+
+func TestCustomOffsetStore(t *testing.T) {
+	s := NewMemoryOffsetStore()
+	c := &consumer{Config: Config{MessageModel: Clustering, OffsetStore: s}}
+	assert.Nil(t, c.initOffset())
+	assert.Equal(t, OffsetStore(s), c.offseter)
+
+	c = &consumer{Config: Config{MessageModel: Clustering}, Logger: &log.MockLogger{}}
+	assert.Nil(t, c.initOffset())
+	_, ok := c.offseter.(*remoteStore)
+	assert.True(t, ok)
+}
@@ -43,15 +43,20 @@ func (rs *remoteStore) readOffsetFromStore(q *message.Queue) (int64, error) {
 	return rs.offsetOper.fetch(q)
 }
 
-func (rs *remoteStore) persist() error {
+// Load does nothing, the offset is fetched from the broker when reading
+func (rs *remoteStore) Load() error {
+	return nil
+}
+
+func (rs *remoteStore) Persist() error {
 	curQueues, _ := rs.queuesAndOffsets()
 	for _, q := range curQueues {
-		rs.persistOne(&q)
+		rs.PersistOne(&q)
 	}
 	return nil
 }
 
-func (rs *remoteStore) persistOne(q *message.Queue) {
+func (rs *remoteStore) PersistOne(q *message.Queue) {
 	of, ok := rs.readOffsetFromMemory(q)
 	if !ok {
 		return
@@ -65,9 +70,9 @@ func (rs *remoteStore) persistOne(q *message.Queue) {
 
 // updateQueues persists the offset to the remote
 // clear the queues not contained in the specified queue
-func (rs *remoteStore) updateQueues(qs ...*message.Queue) {
+func (rs *remoteStore) UpdateQueues(qs ...*message.Queue) {
 	for i := range qs {
-		rs.persistOne(qs[i])
+		rs.PersistOne(qs[i])
 	}
 
 	curQueues, _ := rs.queuesAndOffsets()
@@ -79,7 +84,7 @@ CMP:
 				continue CMP
 			}
 		}
-		rs.removeOffset(q)
+		rs.RemoveOffset(q)
 		rs.logger.Infof("remove offset %s", q)
 	}
 }
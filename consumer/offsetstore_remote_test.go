@@ -52,19 +52,19 @@ func TestRemoteStore(t *testing.T) {
 	rs.updateOffset(q, 0)
 
 	// persistOne
-	rs.persistOne(&message.Queue{QueueID: 2})
+	rs.PersistOne(&message.Queue{QueueID: 2})
 	assert.False(t, mockRemoteOper.runUpdate)
-	rs.persistOne(q)
+	rs.PersistOne(q)
 	assert.True(t, mockRemoteOper.runUpdate)
 	mockRemoteOper.updateErr = errors.New("bad update")
-	rs.persistOne(q)
+	rs.PersistOne(q)
 	assert.True(t, mockRemoteOper.runUpdate)
 
 	q1 := &message.Queue{BrokerName: "b1", QueueID: 1}
 	// persist and clear
 	rs.updateOffset(q1, 1)
 	mockRemoteOper.runUpdate = false
-	rs.updateQueues(q1)
+	rs.UpdateQueues(q1)
 	assert.True(t, mockRemoteOper.runUpdate)
 
 	_, ok := rs.readOffsetFromMemory(q)
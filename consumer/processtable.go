@@ -13,6 +13,7 @@ import (
 const (
 	normal = iota
 	dropped
+	releasing
 )
 
 type offset int64
@@ -30,13 +31,14 @@ func (o offset) CompareTo(o1 tree.Key) int {
 type processQueue struct {
 	sync.RWMutex
 
-	dropped         int32
+	state           int32
 	msgCount        int32
 	msgSize         int64
 	nextQueueOffset int64
 	messages        tree.LLRBTree // queue offset -> message
 
 	lastPullTime time.Time
+	releaseTime  int64 // unix nano
 }
 
 func newProcessQueue() *processQueue {
@@ -73,6 +75,24 @@ func (pq *processQueue) removeMessages(msgs []*message.MessageExt) {
 	return
 }
 
+// setConsumeStartTime sets the consume start time of the messages in millisecond,
+// it is read with the lock when clearing the expired messages
+func (pq *processQueue) setConsumeStartTime(msgs []*message.MessageExt, t time.Time) {
+	pq.Lock()
+	for _, m := range msgs {
+		m.SetConsumeStartTimestamp(t.UnixNano() / int64(time.Millisecond))
+	}
+	pq.Unlock()
+}
+
+func (pq *processQueue) messageCount() int32 {
+	return atomic.LoadInt32(&pq.msgCount)
+}
+
+func (pq *processQueue) messageSize() int64 {
+	return atomic.LoadInt64(&pq.msgSize)
+}
+
 func (pq *processQueue) queueOffsetToConsume() (of int64) {
 	pq.RLock()
 	if pq.messages.Size() > 0 {
@@ -86,11 +106,48 @@ func (pq *processQueue) queueOffsetToConsume() (of int64) {
 }
 
 func (pq *processQueue) drop() bool {
-	return atomic.CompareAndSwapInt32(&pq.dropped, normal, dropped)
+	for {
+		s := atomic.LoadInt32(&pq.state)
+		if s == dropped {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&pq.state, s, dropped) {
+			return true
+		}
+	}
 }
 
 func (pq *processQueue) isDropped() bool {
-	return atomic.LoadInt32(&pq.dropped) == dropped
+	return atomic.LoadInt32(&pq.state) == dropped
+}
+
+// release stops pulling the messages, the queue is dropped after the pulled messages are consumed
+func (pq *processQueue) release(now time.Time) bool {
+	if !atomic.CompareAndSwapInt32(&pq.state, normal, releasing) {
+		return false
+	}
+	atomic.StoreInt64(&pq.releaseTime, now.UnixNano())
+	return true
+}
+
+// cancelRelease restores the releasing queue, the pulling continues
+func (pq *processQueue) cancelRelease() bool {
+	return atomic.CompareAndSwapInt32(&pq.state, releasing, normal)
+}
+
+// finishRelease drops the releasing queue if its pulled messages are consumed
+func (pq *processQueue) finishRelease() bool {
+	return pq.messageCount() == 0 && atomic.CompareAndSwapInt32(&pq.state, releasing, dropped)
+}
+
+func (pq *processQueue) isReleasing() bool {
+	return atomic.LoadInt32(&pq.state) == releasing
+}
+
+// isReleased returns true if the pulled messages are consumed or the releasing is timeout
+func (pq *processQueue) isReleased(now time.Time, timeout time.Duration) bool {
+	return pq.messageCount() == 0 ||
+		now.Sub(time.Unix(0, atomic.LoadInt64(&pq.releaseTime))) >= timeout
 }
 
 func (pq *processQueue) updatePullTime(t time.Time) {
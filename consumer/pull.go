@@ -13,6 +13,8 @@ import (
 	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 )
 
+var errEmptyPullCallback = errors.New("empty pull callback")
+
 // PullConsumer consumes the messages using pulling method
 type PullConsumer struct {
 	*consumer
@@ -75,7 +77,7 @@ func (c *PullConsumer) reblance(topic string) {
 		return
 	}
 
-	c.offseter.updateQueues(newQueues...)
+	c.offseter.UpdateQueues(newQueues...)
 
 	if c.MessageQueueChanged != nil && messageQueueChanged(c.currentMessageQs, newQueues) {
 		c.MessageQueueChanged.Changed(topic, allQueues, newQueues)
@@ -113,49 +115,120 @@ func (c *PullConsumer) PullSyncBlockIfNotFound(
 ) (
 	*PullResult, error,
 ) {
-	return c.pullSync(q, expr, offset, maxCount, true)
+	return c.pullSync(q, ByTag(expr), offset, maxCount, true)
 }
 
 // PullSync pull the messages sync
 func (c *PullConsumer) PullSync(q *message.Queue, expr string, offset int64, maxCount int) (
 	*PullResult, error,
 ) {
-	return c.pullSync(q, expr, offset, maxCount, false)
+	return c.pullSync(q, ByTag(expr), offset, maxCount, false)
+}
+
+// PullSyncWithSelector pull the messages sync, filtered by the selector
+func (c *PullConsumer) PullSyncWithSelector(
+	q *message.Queue, selector MessageSelector, offset int64, maxCount int,
+) (
+	*PullResult, error,
+) {
+	return c.pullSync(q, selector, offset, maxCount, false)
+}
+
+// PullAsync pull the messages async and block when no message, the callback is called with the
+// result when the broker responses, or with the error when the request is failed
+//
+// the request is held by the broker at most BrokerSuspendMaxTime, and is timeout after
+// ConsumerTimeoutWhenSuspend, no goroutine is blocked during the waiting.
+// the callback is called in the goroutine reading the connection, it SHOULD NOT block.
+//
+// NOTE: the callback is not called if the returned error is not nil
+func (c *PullConsumer) PullAsync(
+	q *message.Queue, expr string, offset int64, maxCount int, callback func(*PullResult, error),
+) error {
+	if callback == nil {
+		return errEmptyPullCallback
+	}
+
+	filter, addr, header, err := c.buildPullRequest(q, ByTag(expr), offset, maxCount, true)
+	if err != nil {
+		return err
+	}
+
+	return c.rpc.PullMessageAsync(
+		addr, header, c.ConsumerTimeoutWhenSuspend,
+		func(resp *rpc.PullResponse, err error) {
+			c.updateBrokerReachable(addr, err)
+			if err != nil {
+				callback(nil, err)
+				return
+			}
+			callback(c.toPullResult(q, filter, resp), nil)
+		})
 }
 
 func (c *PullConsumer) pullSync(
-	q *message.Queue, expr string, offset int64, maxCount int, block bool,
+	q *message.Queue, selector MessageSelector, offset int64, maxCount int, block bool,
 ) (*PullResult, error) {
-	addr, err := c.client.FindBrokerAddr(q.BrokerName, c.selectBrokerID(q), false)
+	filter, addr, header, err := c.buildPullRequest(q, selector, offset, maxCount, block)
 	if err != nil {
-		c.client.UpdateTopicRouterInfoFromNamesrv(q.Topic)
-		addr, err = c.client.FindBrokerAddr(q.BrokerName, c.selectBrokerID(q), false)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 
-	resp, err := c.rpc.PullMessageSync(
-		addr.Addr,
-		&rpc.PullHeader{
-			ConsumerGroup:        c.GroupName,
-			Topic:                q.Topic,
-			QueueID:              q.QueueID,
-			QueueOffset:          offset,
-			MaxCount:             int32(maxCount),
-			SysFlag:              buildPull(false, block, true),
-			CommitOffset:         0,
-			SuspendTimeoutMillis: int64(c.BrokerSuspendMaxTime / time.Millisecond),
-			Subscription:         expr,
-			SubVersion:           0,
-			ExpressionType:       ExprTypeTag,
-		},
-		c.ConsumerPullTimeout)
+	// the broker holds the blocking request at most BrokerSuspendMaxTime
+	timeout := c.ConsumerPullTimeout
+	if block {
+		timeout = c.ConsumerTimeoutWhenSuspend
+	}
 
+	resp, err := c.rpc.PullMessageSync(addr, header, timeout)
+	c.updateBrokerReachable(addr, err)
 	if err != nil {
 		return nil, err
 	}
 
+	return c.toPullResult(q, filter, resp), nil
+}
+
+func (c *PullConsumer) buildPullRequest(
+	q *message.Queue, selector MessageSelector, offset int64, maxCount int, block bool,
+) (
+	filter MessageFilter, addr string, header *rpc.PullHeader, err error,
+) {
+	filter, err = NewMessageFilter(selector)
+	if err != nil {
+		return
+	}
+
+	exprType := selector.Type
+	if exprType == "" {
+		exprType = ExprTypeTag
+	}
+
+	broker, err := c.findPullBrokerAddr(q)
+	if err != nil {
+		return
+	}
+
+	addr = broker.Addr
+	header = &rpc.PullHeader{
+		ConsumerGroup:        c.GroupName,
+		Topic:                q.Topic,
+		QueueID:              q.QueueID,
+		QueueOffset:          offset,
+		MaxCount:             int32(maxCount),
+		SysFlag:              buildPull(false, block, true),
+		CommitOffset:         0,
+		SuspendTimeoutMillis: int64(c.BrokerSuspendMaxTime / time.Millisecond),
+		Subscription:         selector.Expr,
+		SubVersion:           0,
+		ExpressionType:       exprType,
+	}
+	return
+}
+
+func (c *PullConsumer) toPullResult(
+	q *message.Queue, filter MessageFilter, resp *rpc.PullResponse,
+) *PullResult {
 	c.brokerSuggester.put(q, int32(resp.SuggestBrokerID))
 	pr := &PullResult{
 		NextBeginOffset: resp.NextBeginOffset,
@@ -168,39 +241,19 @@ func (c *PullConsumer) pullSync(
 		pr.Status = Found
 	case rpc.PullNotFound:
 		pr.Status = NoNewMessage
-		return pr, nil
+		return pr
 	case rpc.PullRetryImmediately:
 		pr.Status = NoMatchedMessage
-		return pr, nil
+		return pr
 	case rpc.PullOffsetMoved:
 		pr.Status = OffsetIllegal
-		return pr, nil
+		return pr
 	default:
 		panic("BUG:unprocess code:" + strconv.Itoa(int(resp.Code)))
 	}
 
-	tags := ParseTags(expr)
-	if len(tags) == 0 {
-		return pr, nil
-	}
-
-	filterMsgs := make([]*message.MessageExt, 0, len(pr.Messages))
-	for _, m := range pr.Messages {
-		tag := m.GetTags()
-		if tag == "" {
-			continue
-		}
-
-		for _, t := range tags {
-			if tag == t {
-				filterMsgs = append(filterMsgs, m)
-				break
-			}
-		}
-	}
-
-	pr.Messages = filterMsgs
-	return pr, nil
+	pr.Messages = c.filterMessages(filter, pr.Messages)
+	return pr
 }
 
 // RunningInfo returns the consumter's running information
@@ -215,6 +268,7 @@ func (c *PullConsumer) RunningInfo() client.RunningInfo {
 		"registerTopics":                   strings.Join(c.subscribeData.Topics(), ", "),
 		"unitMode":                         strconv.FormatBool(c.IsUnitMode),
 		"maxReconsumeTimes":                strconv.FormatInt(int64(c.MaxReconsumeTimes), 10),
+		"filteredMessageCount":             strconv.FormatInt(c.FilteredMessageCount(), 10),
 		"PROP_CONSUMER_START_TIMESTAMP":    strconv.FormatInt(c.startTime.UnixNano()/int64(millis), 10),
 		"PROP_NAMESERVER_ADDR":             strings.Join(c.NameServerAddrs, ";"),
 		"PROP_CONSUME_TYPE":                c.Type(),
@@ -31,6 +31,11 @@ func TestPullConsumer(t *testing.T) {
 	t.Run("pullsync", func(t *testing.T) {
 		testPullSync(c, t)
 	})
+
+	t.Run("pullasync", func(t *testing.T) {
+		c.rpc = &mockConsumerRPC{}
+		testPullAsync(c, t)
+	})
 }
 
 type mockMQClient struct {
@@ -62,17 +67,35 @@ func (c *mockMQClient) UpdateTopicRouterInfoFromNamesrv(topic string) error {
 }
 
 type mockConsumerRPC struct {
-	sendBackAddr string
+	sendBackAddr   string
+	sendBackHeader *rpc.SendBackHeader
+	sendBackErr    error
+
 	pullCount    int
+	pullAddr     string
+	pullHeader   *rpc.PullHeader
+	pullTimeout  time.Duration
+	pullAsyncErr error
+
+	updateOffsetAddr string
 
 	maxOffset    int64
 	maxOffsetErr *remote.RPCError
 
+	minOffset    int64
+	minOffsetErr *remote.RPCError
+
 	searchOffsetByTimestampRet int64
 	searchOffsetByTimestampErr *remote.RPCError
 
 	getConsumerIDsErr error
 	clientIDs         []string
+
+	lockedQueues   []message.Queue
+	lockErr        error
+	lockCount      int
+	unlockedQueues []message.Queue
+	unlockErr      error
 }
 
 func (r *mockConsumerRPC) GetConsumerIDs(addr, group string, to time.Duration) ([]string, error) {
@@ -81,16 +104,17 @@ func (r *mockConsumerRPC) GetConsumerIDs(addr, group string, to time.Duration) (
 func (r *mockConsumerRPC) PullMessageSync(
 	addr string, header *rpc.PullHeader, to time.Duration,
 ) (*rpc.PullResponse, error) {
+	r.pullAddr, r.pullHeader = addr, header
 	pr := &rpc.PullResponse{
 		NextBeginOffset: 2,
 		MinOffset:       1,
 		MaxOffset:       3,
 		Messages: []*message.MessageExt{
 			&message.MessageExt{
-				Message: message.Message{Properties: map[string]string{message.PropertyTags: "t1"}},
+				Message: message.Message{Properties: map[string]string{message.PropertyTags: "t1", "a": "1"}},
 			},
 			&message.MessageExt{
-				Message: message.Message{Properties: map[string]string{message.PropertyTags: "t2"}},
+				Message: message.Message{Properties: map[string]string{message.PropertyTags: "t2", "a": "2"}},
 			},
 		},
 		SuggestBrokerID: 123,
@@ -109,20 +133,32 @@ func (r *mockConsumerRPC) PullMessageSync(
 	}
 	return pr, nil
 }
-func (r *mockConsumerRPC) SendBack(addr string, h *rpc.SendBackHeader, to time.Duration) error {
-	r.sendBackAddr = addr
+func (r *mockConsumerRPC) PullMessageAsync(
+	addr string, header *rpc.PullHeader, to time.Duration, callback func(*rpc.PullResponse, error),
+) error {
+	if r.pullAsyncErr != nil {
+		return r.pullAsyncErr
+	}
+	r.pullTimeout = to
+	go func() { callback(r.PullMessageSync(addr, header, to)) }()
 	return nil
 }
+func (r *mockConsumerRPC) SendBack(addr string, h *rpc.SendBackHeader, to time.Duration) error {
+	r.sendBackAddr, r.sendBackHeader = addr, h
+	return r.sendBackErr
+}
 
 func (r *mockConsumerRPC) UpdateConsumerOffset(
 	addr, topic, group string, queueID int, offset int64, to time.Duration,
 ) error {
+	r.updateOffsetAddr = addr
 	return nil
 }
 
 func (r *mockConsumerRPC) UpdateConsumerOffsetOneway(
 	addr, topic, group string, queueID int, offset int64,
 ) error {
+	r.updateOffsetAddr = addr
 	return nil
 }
 
@@ -139,12 +175,46 @@ func (r *mockConsumerRPC) MaxOffset(addr, topic string, queueID uint8, to time.D
 ) {
 	return r.maxOffset, r.maxOffsetErr
 }
+func (r *mockConsumerRPC) MinOffset(addr, topic string, queueID uint8, to time.Duration) (
+	int64, *remote.RPCError,
+) {
+	return r.minOffset, r.minOffsetErr
+}
+
 func (r *mockConsumerRPC) SearchOffsetByTimestamp(addr, broker, topic string, queueID uint8, timestamp time.Time, to time.Duration) (
 	int64, *remote.RPCError,
 ) {
 	return r.searchOffsetByTimestampRet, r.searchOffsetByTimestampErr
 }
 
+func (r *mockConsumerRPC) LockMessageQueues(
+	addr, group, clientID string, queues []message.Queue, to time.Duration,
+) (
+	[]message.Queue, error,
+) {
+	r.lockCount++
+	if r.lockErr != nil {
+		return nil, r.lockErr
+	}
+
+	var locked []message.Queue
+	for _, q := range queues {
+		for _, q1 := range r.lockedQueues {
+			if q == q1 {
+				locked = append(locked, q)
+			}
+		}
+	}
+	return locked, nil
+}
+
+func (r *mockConsumerRPC) UnlockMessageQueues(
+	addr, group, clientID string, queues []message.Queue, to time.Duration,
+) error {
+	r.unlockedQueues = append(r.unlockedQueues, queues...)
+	return r.unlockErr
+}
+
 func testSendback(c *PullConsumer, t *testing.T) {
 	msgID := "bad message"
 	assert.NotNil(t, c.SendBack(&message.MessageExt{MsgID: msgID}, -1, "", ""))
@@ -184,6 +254,54 @@ func testPullSync(c *PullConsumer, t *testing.T) {
 
 	pr, err = c.PullSync(q, "t1||t2", 0, 10)
 	assert.Equal(t, 2, len(pr.Messages))
+	assert.Equal(t, int64(2), c.FilteredMessageCount())
+	assert.Equal(t, ExprTypeTag, c.rpc.(*mockConsumerRPC).pullHeader.ExpressionType)
+
+	_, err = c.PullSyncWithSelector(q, BySQL92("a >"), 0, 10)
+	assert.NotNil(t, err)
+
+	pr, err = c.PullSyncWithSelector(q, BySQL92("a > 1"), 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pr.Messages))
+	assert.Equal(t, "2", pr.Messages[0].GetProperty("a"))
+	h := c.rpc.(*mockConsumerRPC).pullHeader
+	assert.Equal(t, ExprTypeSQL92, h.ExpressionType)
+	assert.Equal(t, "a > 1", h.Subscription)
+}
+
+func testPullAsync(c *PullConsumer, t *testing.T) {
+	type result struct {
+		pr  *PullResult
+		err error
+	}
+	results := make(chan result, 1)
+	callback := func(pr *PullResult, err error) { results <- result{pr, err} }
+	q := &message.Queue{}
+
+	assert.Equal(t, errEmptyPullCallback, c.PullAsync(q, "", 0, 10, nil))
+
+	r := c.rpc.(*mockConsumerRPC)
+	r.pullAsyncErr = errors.New("mock pull async error")
+	assert.Equal(t, r.pullAsyncErr, c.PullAsync(q, "", 0, 10, callback))
+	r.pullAsyncErr = nil
+
+	assert.Nil(t, c.PullAsync(q, "", 0, 10, callback))
+	res := <-results
+	assert.Nil(t, res.pr)
+	assert.Equal(t, "mock pull error", res.err.Error())
+
+	assert.Nil(t, c.PullAsync(q, "t1", 0, 10, callback))
+	res = <-results
+	assert.Nil(t, res.err)
+	assert.Equal(t, Found, res.pr.Status)
+	assert.Equal(t, 1, len(res.pr.Messages))
+	assert.Equal(t, c.ConsumerTimeoutWhenSuspend, r.pullTimeout)
+	assert.Equal(t, int64(c.BrokerSuspendMaxTime/time.Millisecond), r.pullHeader.SuspendTimeoutMillis)
+	assert.True(t, r.pullHeader.SysFlag&PullSuspend != 0)
+
+	assert.Nil(t, c.PullAsync(q, "", 0, 10, callback))
+	res = <-results
+	assert.Equal(t, NoNewMessage, res.pr.Status)
 }
 
 func TestMessageQueueChanged(t *testing.T) {
@@ -2,12 +2,15 @@ package consumer
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/zjykzk/rocketmq-client-go"
+	"github.com/zjykzk/rocketmq-client-go/client"
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 )
 
 var (
@@ -25,12 +28,27 @@ const (
 	defaultConsumeTimeout                           = 15 * time.Minute
 	defaultConsumeMessageBatchMaxSize               = 1
 	defaultPushMaxReconsumeTimes                    = -1
+
+	brokerSuspendMaxTime             = 15 * time.Second
+	pullTimeoutWhenSuspend           = 30 * time.Second
+	pullTimeDelayWhenException       = 3 * time.Second
+	pullTimeDelayWhenFlowControl     = 50 * time.Millisecond
+	pullTimeDelayWhenNoSubscription  = time.Second
+	pullTimeDelayWhenReleasing       = time.Second
+	pullTimeDelayWhenNotLocked       = 3 * time.Second
+	maxMessageSizeOfProcessQueueUnit = 1024 * 1024 // MaxSizeForQueue is in MiB
+	releaseQueueTimeout              = time.Minute
 )
 
 type consumerService interface {
+	start()
+	shutdown()
 	messageQueues() []message.Queue
+	processQueue(mq *message.Queue) (*processQueue, bool)
 	removeOldMessageQueue(mq *message.Queue) bool
 	insertNewMessageQueue(mq *message.Queue) (*processQueue, bool)
+	submitConsumeRequest(msgs []*message.MessageExt, pq *processQueue, mq *message.Queue)
+	consumeMessageDirectly(m *message.MessageExt, broker string) *rpc.ConsumeMessageDirectlyResult
 }
 
 // PushConsumer the consumer with push model
@@ -51,10 +69,17 @@ type PushConsumer struct {
 	PostSubscriptionWhenPull   bool
 	ConsumeMessageBatchMaxSize int
 
+	// StickyReblance assigns the queues by Sticky if the QueueAssigner is nil, and releases the queue
+	// assigned to the other client after the pulled messages are consumed
+	StickyReblance bool
+
 	consumerService        consumerService
 	consumerServiceBuilder func() (consumerService, error)
+	isQueueLocked          func(mq *message.Queue) bool // nil if consuming concurrently
 
 	pullService *pullService
+	retrySender retrySender
+	stats       *statsManager
 }
 
 func newPushConsumer(group string, namesrvAddrs []string, logger log.Logger) *PushConsumer {
@@ -78,6 +103,8 @@ func newPushConsumer(group string, namesrvAddrs []string, logger log.Logger) *Pu
 
 		PostSubscriptionWhenPull:   defaultPostSubscriptionWhenPull,
 		ConsumeMessageBatchMaxSize: defaultConsumeMessageBatchMaxSize,
+
+		stats: newStatsManager(group),
 	}
 	pc.NameServerAddrs = namesrvAddrs
 	pc.FromWhere = consumeFromLastOffset
@@ -86,6 +113,7 @@ func newPushConsumer(group string, namesrvAddrs []string, logger log.Logger) *Pu
 	pc.assigner = &Averagely{}
 	pc.reblancer = pc
 	pc.runnerInfo = pc.RunningInfo
+	pc.ownedQueues, pc.queueLocker = pc.processingQueues, pc
 	pc.GroupName = group
 
 	pc.StartFunc, pc.ShutdownFunc = pc.start, pc.shutdown
@@ -101,17 +129,57 @@ func NewConcurrentConsumer(
 	pc = newPushConsumer(group, namesrvAddrs, logger)
 
 	pc.consumerServiceBuilder = func() (consumerService, error) {
+		var locker queueLocker
+		if _, ok := pc.assigner.(StickyQueueAssigner); ok && pc.MessageModel == Clustering {
+			locker = pc
+		}
 		return newConsumeConcurrentlyService(concurrentlyServiceConfig{
 			consumeServiceConfig: consumeServiceConfig{
 				group:           group,
 				logger:          logger,
+				messageModel:    pc.MessageModel,
+				messageSendBack: pc,
+				offseter:        pc.offseter,
+				stats:           pc.stats,
+			},
+			consumeTimeout:    pc.ConsumeTimeout,
+			consumer:          userConsumer,
+			batchSize:         pc.BatchSize,
+			maxReconsumeTimes: pc.maxReconsumeTimes(),
+			queueLocker:       locker,
+		})
+	}
+	return
+}
+
+// NewOrderlyConsumer creates the push consumer consuming the message orderly
+// the message queue is locked in the broker before consuming when the message model is clustering
+func NewOrderlyConsumer(
+	group string, namesrvAddrs []string, userConsumer OrderlyConsumer, logger log.Logger,
+) (
+	pc *PushConsumer, err error,
+) {
+	pc = newPushConsumer(group, namesrvAddrs, logger)
+
+	pc.consumerServiceBuilder = func() (consumerService, error) {
+		cs, err := newConsumeOrderlyService(orderlyServiceConfig{
+			consumeServiceConfig: consumeServiceConfig{
+				group:           group,
+				logger:          logger,
+				messageModel:    pc.MessageModel,
 				messageSendBack: pc,
 				offseter:        pc.offseter,
+				stats:           pc.stats,
 			},
-			consumeTimeout: pc.ConsumeTimeout,
-			consumer:       userConsumer,
-			batchSize:      pc.BatchSize,
+			consumer:    userConsumer,
+			queueLocker: pc,
+			batchSize:   pc.ConsumeMessageBatchMaxSize,
 		})
+		if err != nil {
+			return nil, err
+		}
+		pc.isQueueLocked = cs.isQueueLocked
+		return cs, nil
 	}
 	return
 }
@@ -122,16 +190,27 @@ func (pc *PushConsumer) start() error {
 		return errors.New("start push consumer error:empty group")
 	}
 
+	if pc.StickyReblance && pc.QueueAssigner == nil {
+		pc.QueueAssigner = &Sticky{}
+	}
+
 	err := pc.consumer.start()
 	if err != nil {
 		return err
 	}
 
+	pc.retrySender, err = startInnerProducer(pc.consumer)
+	if err != nil {
+		pc.Logger.Errorf("start inner producer error:%s", err)
+		return err
+	}
+
 	pc.consumerService, err = pc.consumerServiceBuilder()
 	if err != nil {
 		pc.Logger.Errorf("build consumer service error:%s", err)
 		return err
 	}
+	pc.consumerService.start()
 
 	pc.pullService, err = newPullService(pullServiceConfig{
 		messagePuller: pc,
@@ -144,15 +223,27 @@ func (pc *PushConsumer) start() error {
 
 func (pc *PushConsumer) shutdown() {
 	pc.Logger.Info("shutdown push consumer ")
+	pc.consumerService.shutdown()
+	shutdownInnerProducer(pc.ClientID)
 	pc.consumer.shutdown()
 	pc.pullService.shutdown()
 	pc.Logger.Info("shutdown push consumer OK")
 }
 
-// SendBack sends the message to the broker, the message will be consumed again after the at
-// least time specified by the delayLevel
-func (pc *PushConsumer) SendBack(m *message.MessageExt, delayLevel int, broker string) error {
-	return nil //TODO
+func (pc *PushConsumer) lockQueues(broker string, mqs []message.Queue) ([]message.Queue, error) {
+	addr, err := pc.client.FindBrokerAddr(broker, rocketmq.MasterID, true)
+	if err != nil {
+		return nil, err
+	}
+	return pc.rpc.LockMessageQueues(addr.Addr, pc.GroupName, pc.ClientID, mqs, time.Second)
+}
+
+func (pc *PushConsumer) unlockQueues(broker string, mqs []message.Queue) error {
+	addr, err := pc.client.FindBrokerAddr(broker, rocketmq.MasterID, true)
+	if err != nil {
+		return err
+	}
+	return pc.rpc.UnlockMessageQueues(addr.Addr, pc.GroupName, pc.ClientID, mqs, time.Second)
 }
 
 func (pc *PushConsumer) reblance(topic string) {
@@ -166,22 +257,35 @@ func (pc *PushConsumer) reblance(topic string) {
 	}
 
 	if pc.updateProcessTable(topic, newQueues) {
+		pc.stats.incRebalance(topic)
 		pc.updateSubscribeVersion(topic)
 		pc.updateThresholdOfQueue()
 	}
 }
 
 func (pc *PushConsumer) updateProcessTable(topic string, mqs []*message.Queue) bool {
+	changed := false
+	if pc.StickyReblance {
+		changed = pc.removeReleasedQueues()
+	}
+
 	tmpMQs := pc.consumerService.messageQueues()
 	currentMQs := make([]*message.Queue, len(tmpMQs))
 	for i := range currentMQs {
 		currentMQs[i] = &tmpMQs[i]
 	}
 
-	changed := false
+	// restore the releasing mq processed by the node again
+	for _, mq := range mqs {
+		if pq, ok := pc.consumerService.processQueue(mq); ok && pq.cancelRelease() {
+			pc.Logger.Infof("reblance: %s, message queue %s is reassigned, continue pulling", pc.Group(), mq)
+			changed = true
+		}
+	}
+
 	// remove the mq not processed by the node
 	for _, mq := range sub(currentMQs, mqs) {
-		if pc.consumerService.removeOldMessageQueue(mq) {
+		if pc.releaseOldMessageQueue(mq) {
 			changed = true
 		}
 	}
@@ -189,7 +293,7 @@ func (pc *PushConsumer) updateProcessTable(topic string, mqs []*message.Queue) b
 	// insert new mq
 	var pullRequests []pullRequest
 	for _, mq := range sub(mqs, currentMQs) {
-		pc.offseter.removeOffset(mq)
+		pc.offseter.RemoveOffset(mq)
 		offset, err := pc.computeWhereToPull(mq)
 		if err != nil {
 			pc.Logger.Errorf("compute where to pull the message error:%s", err)
@@ -212,6 +316,58 @@ func (pc *PushConsumer) updateProcessTable(topic string, mqs []*message.Queue) b
 	return changed
 }
 
+// releaseOldMessageQueue removes the queue not processed by the node,
+// in the sticky mode, the queue with the pulled messages is removed after they are consumed
+func (pc *PushConsumer) releaseOldMessageQueue(mq *message.Queue) bool {
+	if !pc.StickyReblance {
+		return pc.consumerService.removeOldMessageQueue(mq)
+	}
+
+	pq, ok := pc.consumerService.processQueue(mq)
+	if !ok || pq.isReleasing() {
+		return false
+	}
+
+	if count := pq.messageCount(); count > 0 && pq.release(time.Now()) {
+		pc.Logger.Infof(
+			"reblance: %s, release message queue %s after consuming %d messages", pc.Group(), mq, count,
+		)
+		return false
+	}
+	return pc.consumerService.removeOldMessageQueue(mq)
+}
+
+// processingQueues returns the queues neither releasing nor dropped
+func (pc *PushConsumer) processingQueues() []message.Queue {
+	var r []message.Queue
+	for _, mq := range pc.consumerService.messageQueues() {
+		if pq, ok := pc.consumerService.processQueue(&mq); ok && !pq.isReleasing() && !pq.isDropped() {
+			r = append(r, mq)
+		}
+	}
+	return r
+}
+
+// removeReleasedQueues removes the releasing queues whose pulled messages are consumed,
+// and the dropped queues failed to remove
+func (pc *PushConsumer) removeReleasedQueues() bool {
+	changed, now := false, time.Now()
+	for _, mq := range pc.consumerService.messageQueues() {
+		pq, ok := pc.consumerService.processQueue(&mq)
+		if !ok {
+			continue
+		}
+
+		if (pq.isReleasing() && pq.isReleased(now, releaseQueueTimeout)) || pq.isDropped() {
+			if pc.consumerService.removeOldMessageQueue(&mq) {
+				pc.Logger.Infof("reblance: %s, message queue %s released", pc.Group(), &mq)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
 func (pc *PushConsumer) dispatchPullRequest(reqs []pullRequest) {
 	for i := range reqs {
 		pc.pullService.submitRequestImmediately(&reqs[i])
@@ -257,13 +413,13 @@ func (pc *PushConsumer) computeWhereToPull(mq *message.Queue) (offset int64, err
 }
 
 func (pc *PushConsumer) computeFromLastOffset(mq *message.Queue) (int64, error) {
-	offset, err := pc.offseter.readOffset(mq, ReadOffsetFromStore)
+	offset, err := pc.offseter.ReadOffset(mq, ReadOffsetFromStore)
 	if err == nil {
 		return offset, nil
 	}
 
 	pc.Logger.Errorf("read LAST offset of %s, from the store error:%s", mq, err)
-	if err != errOffsetNotExist {
+	if err != ErrOffsetNotExist {
 		return 0, err
 	}
 
@@ -275,13 +431,13 @@ func (pc *PushConsumer) computeFromLastOffset(mq *message.Queue) (int64, error)
 }
 
 func (pc *PushConsumer) computeFromFirstOffset(mq *message.Queue) (int64, error) {
-	offset, err := pc.offseter.readOffset(mq, ReadOffsetFromStore)
+	offset, err := pc.offseter.ReadOffset(mq, ReadOffsetFromStore)
 	if err == nil {
 		return offset, nil
 	}
 
 	pc.Logger.Errorf("read FIRST offset of %s, from the store error:%s", mq, err)
-	if err == errOffsetNotExist {
+	if err == ErrOffsetNotExist {
 		return 0, nil
 	}
 
@@ -289,13 +445,13 @@ func (pc *PushConsumer) computeFromFirstOffset(mq *message.Queue) (int64, error)
 }
 
 func (pc *PushConsumer) computeFromTimestamp(mq *message.Queue) (int64, error) {
-	offset, err := pc.offseter.readOffset(mq, ReadOffsetFromStore)
+	offset, err := pc.offseter.ReadOffset(mq, ReadOffsetFromStore)
 	if err == nil {
 		return offset, nil
 	}
 
 	pc.Logger.Errorf("read TIMESTAMP offset of %s, from the store error:%s", mq, err)
-	if err != errOffsetNotExist {
+	if err != ErrOffsetNotExist {
 		return 0, err
 	}
 
@@ -344,5 +500,271 @@ func (pc *PushConsumer) updateThresholdOfQueue() {
 }
 
 func (pc *PushConsumer) pull(r *pullRequest) {
-	// TODO
+	pq, mq := r.processQueue, r.messageQueue
+	if pq.isDropped() {
+		pc.Logger.Infof("pull request of the dropped queue:%s, ignore", mq)
+		return
+	}
+
+	if pq.isReleasing() {
+		pc.Logger.Debugf("pull request of the releasing queue:%s, pull later", mq)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenReleasing)
+		return
+	}
+
+	pq.updatePullTime(time.Now())
+
+	if count, size := pq.messageCount(), pq.messageSize(); int(count) > pc.MaxCountForQueue ||
+		size > int64(pc.MaxSizeForQueue)*maxMessageSizeOfProcessQueueUnit {
+		pc.Logger.Debugf("flow control, queue:%s, message count:%d, message size:%d", mq, count, size)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenFlowControl)
+		return
+	}
+
+	if !pc.checkQueueLocked(r) {
+		return
+	}
+
+	data := pc.subscribeData.Get(mq.Topic)
+	if data == nil {
+		pc.Logger.Warnf("no subscription of topic:%s, pull later", mq.Topic)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenNoSubscription)
+		return
+	}
+
+	begin := time.Now()
+	resp, err := pc.pullMessage(r, data)
+	pc.stats.incPullRT(mq.Topic, time.Since(begin))
+	pc.stats.incPull(mq.Topic, err)
+	if err != nil {
+		pc.Logger.Errorf("pull message of queue:%s, error:%s", mq, err)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenException)
+		return
+	}
+
+	pc.processPullResponse(r, data, resp)
+}
+
+// checkQueueLocked returns true if the queue is locked when consuming orderly, or pulls later,
+// the next offset is read from the store at the first pulling after locked,
+// in case of skipping the progress of the other consumer
+func (pc *PushConsumer) checkQueueLocked(r *pullRequest) bool {
+	if pc.isQueueLocked == nil {
+		return true
+	}
+
+	mq := r.messageQueue
+	if !pc.isQueueLocked(mq) {
+		pc.Logger.Debugf("queue:%s is not locked, pull later", mq)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenNotLocked)
+		return false
+	}
+
+	if r.isLockedFirst {
+		return true
+	}
+
+	offset, err := pc.computeWhereToPull(mq)
+	if err != nil {
+		pc.Logger.Errorf("compute where to pull the locked queue:%s error:%s, pull later", mq, err)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenException)
+		return false
+	}
+
+	if offset < r.nextOffset {
+		pc.Logger.Warnf("the offset of the locked queue:%s is back from %d to %d", mq, r.nextOffset, offset)
+	}
+	r.isLockedFirst, r.nextOffset = true, offset
+	return true
+}
+
+func (pc *PushConsumer) pullMessage(r *pullRequest, data *client.Data) (*rpc.PullResponse, error) {
+	mq := r.messageQueue
+	addr, err := pc.findPullBrokerAddr(mq)
+	if err != nil {
+		return nil, err
+	}
+
+	var commitOffset int64
+	if pc.MessageModel == Clustering {
+		if of, err := pc.offseter.ReadOffset(mq, ReadOffsetFromMemory); err == nil && of > 0 {
+			commitOffset = of
+		}
+	}
+
+	expr := ""
+	if pc.PostSubscriptionWhenPull {
+		expr = data.Expr
+	}
+
+	sysFlag := buildPull(commitOffset > 0, true, expr != "")
+	if addr.IsSlave {
+		sysFlag = ClearCommitOffset(sysFlag)
+	}
+
+	resp, err := pc.rpc.PullMessageSync(
+		addr.Addr,
+		&rpc.PullHeader{
+			ConsumerGroup:        pc.GroupName,
+			Topic:                mq.Topic,
+			QueueID:              mq.QueueID,
+			QueueOffset:          r.nextOffset,
+			MaxCount:             int32(pc.BatchSize),
+			SysFlag:              sysFlag,
+			CommitOffset:         commitOffset,
+			SuspendTimeoutMillis: int64(brokerSuspendMaxTime / time.Millisecond),
+			Subscription:         expr,
+			SubVersion:           data.Version,
+			ExpressionType:       data.Typ,
+		},
+		pullTimeoutWhenSuspend,
+	)
+	pc.updateBrokerReachable(addr.Addr, err)
+	return resp, err
+}
+
+func (pc *PushConsumer) processPullResponse(r *pullRequest, data *client.Data, resp *rpc.PullResponse) {
+	pq, mq := r.processQueue, r.messageQueue
+	if pq.isDropped() {
+		pc.Logger.Infof("pull response of the dropped queue:%s, ignore", mq)
+		return
+	}
+
+	pc.brokerSuggester.put(mq, int32(resp.SuggestBrokerID))
+	pc.updateLag(mq, resp.MaxOffset)
+
+	switch resp.Code {
+	case rpc.Success:
+		r.nextOffset = resp.NextBeginOffset
+		msgs := pc.filterMessages(newSubscriptionFilter(data), resp.Messages)
+		if len(msgs) == 0 {
+			pc.updateOffsetIfNoMessage(r)
+			pc.pullService.submitRequestImmediately(r)
+			return
+		}
+
+		pc.stats.incPullTPS(mq.Topic, len(msgs))
+		pq.putMessages(msgs)
+		pc.consumerService.submitConsumeRequest(msgs, pq, mq)
+		pc.pullService.submitRequestLater(r, pc.PullInterval)
+	case rpc.PullNotFound, rpc.PullRetryImmediately:
+		r.nextOffset = resp.NextBeginOffset
+		pc.updateOffsetIfNoMessage(r)
+		pc.pullService.submitRequestImmediately(r)
+	case rpc.PullOffsetMoved:
+		pc.Logger.Warnf(
+			"offset of queue:%s is illegal, from %d to %d", mq, r.nextOffset, resp.NextBeginOffset,
+		)
+		r.nextOffset = resp.NextBeginOffset
+		pq.drop()
+		pc.offseter.UpdateOffsetIfGreater(mq, r.nextOffset)
+		pc.offseter.PersistOne(mq)
+		pc.consumerService.removeOldMessageQueue(mq)
+	default:
+		pc.Logger.Errorf("unknown pull response code:%d, queue:%s", resp.Code, mq)
+		pc.pullService.submitRequestLater(r, pullTimeDelayWhenException)
+	}
+}
+
+// updateLag computes the lag of the queue by the max offset in the broker & the consume offset
+func (pc *PushConsumer) updateLag(mq *message.Queue, maxOffset int64) {
+	offset, err := pc.offseter.ReadOffset(mq, ReadOffsetFromMemory)
+	if err != nil || offset < 0 || maxOffset < offset {
+		return
+	}
+	pc.stats.setLag(mq, maxOffset-offset)
+}
+
+// ResetOffset drops the process queues of the topic reset by the broker, applies the new offsets,
+// then pulls the messages from the new offsets
+func (pc *PushConsumer) ResetOffset(topic string, offsets map[message.Queue]int64) {
+	var reqs []pullRequest
+	for _, mq := range pc.consumerService.messageQueues() {
+		offset, ok := offsets[mq]
+		if !ok || mq.Topic != topic {
+			continue
+		}
+
+		// the process queue is dropped first, so the consuming messages cannot update the offset
+		// after resetting
+		mq := mq
+		removed := pc.consumerService.removeOldMessageQueue(&mq)
+		pc.resetOffset(&mq, offset)
+		if !removed {
+			pc.Logger.Warnf("reset offset, the queue:%s is being consumed, pull it after removed & reblanced", mq)
+			continue
+		}
+
+		pq, ok := pc.consumerService.insertNewMessageQueue(&mq)
+		if !ok {
+			pc.Logger.Warnf("reset offset, insert the queue:%s failed, pull it after reblancing", mq)
+			continue
+		}
+
+		pc.offseter.UpdateOffsetIfGreater(&mq, offset)
+		pc.Logger.Infof("reset offset of the queue:%s to %d", mq, offset)
+		reqs = append(reqs, pullRequest{
+			group:        pc.Group(),
+			nextOffset:   offset,
+			messageQueue: &mq,
+			processQueue: pq,
+		})
+	}
+
+	pc.dispatchPullRequest(reqs)
+}
+
+// ConsumeMessageDirectly consumes the message sent by the broker, without the flow control
+func (pc *PushConsumer) ConsumeMessageDirectly(m *message.MessageExt, broker string) (
+	*rpc.ConsumeMessageDirectlyResult, error,
+) {
+	pc.Logger.Infof("consume message:%s of broker:%s directly", m.MsgID, broker)
+	return pc.consumerService.consumeMessageDirectly(m, broker), nil
+}
+
+// updateOffsetIfNoMessage updates the consume offset when no message is consuming,
+// so the offset is advanced even if the pulled messages are all filtered
+func (pc *PushConsumer) updateOffsetIfNoMessage(r *pullRequest) {
+	if r.processQueue.messageCount() == 0 {
+		pc.offseter.UpdateOffsetIfGreater(r.messageQueue, r.nextOffset)
+	}
+}
+
+// RunningInfo returns the consumter's running information
+func (pc *PushConsumer) RunningInfo() client.RunningInfo {
+	millis := time.Millisecond
+	prop := map[string]string{
+		"consumerGroup":                 pc.GroupName,
+		"messageModel":                  pc.MessageModel.String(),
+		"consumeFromWhere":              pc.FromWhere.String(),
+		"consumeTimeout":                strconv.FormatInt(int64(pc.ConsumeTimeout/time.Minute), 10),
+		"maxReconsumeTimes":             strconv.Itoa(pc.MaxReconsumeTimes),
+		"pullBatchSize":                 strconv.Itoa(pc.BatchSize),
+		"pullInterval":                  strconv.FormatInt(int64(pc.PullInterval/millis), 10),
+		"pullThresholdForQueue":         strconv.Itoa(pc.MaxCountForQueue),
+		"pullThresholdSizeForQueue":     strconv.Itoa(pc.MaxSizeForQueue),
+		"consumeMessageBatchMaxSize":    strconv.Itoa(pc.ConsumeMessageBatchMaxSize),
+		"postSubscriptionWhenPull":      strconv.FormatBool(pc.PostSubscriptionWhenPull),
+		"unitMode":                      strconv.FormatBool(pc.IsUnitMode),
+		"filteredMessageCount":          strconv.FormatInt(pc.FilteredMessageCount(), 10),
+		"PROP_CONSUMER_START_TIMESTAMP": strconv.FormatInt(pc.startTime.UnixNano()/int64(millis), 10),
+		"PROP_NAMESERVER_ADDR":          strings.Join(pc.NameServerAddrs, ";"),
+		"PROP_CONSUME_TYPE":             pc.Type(),
+		"PROP_CLIENT_VERSION":           rocketmq.CurrentVersion.String(),
+	}
+	subs := pc.Subscriptions()
+	topics := make([]string, len(subs))
+	for i, d := range subs {
+		topics[i] = d.Topic
+	}
+	return client.RunningInfo{
+		Properties:    prop,
+		Subscriptions: subs,
+		Statuses:      pc.stats.statuses(topics),
+	}
+}
+
+// ConsumeStatuses returns the statistics of pulling & consuming of the topics in the last minute
+func (pc *PushConsumer) ConsumeStatuses() map[string]client.ConsumeStatus {
+	return pc.stats.statuses(pc.stats.topicNames())
 }
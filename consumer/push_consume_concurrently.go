@@ -2,11 +2,16 @@ package consumer
 
 import (
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 )
 
+// the broker controls the retry frequency, see ConcurrentlyContext.DelayLevelWhenNextConsume
+const delayLevelByBroker = 0
+
 // ConsumeConcurrentlyStatus consume concurrently result
 type ConsumeConcurrentlyStatus int
 
@@ -44,11 +49,13 @@ type consumeConcurrentlyService struct {
 
 	cleanExpiredInterval time.Duration
 
-	consumer        ConcurrentlyConsumer
-	consumeTimeout  time.Duration
-	concurrentCount int
-	consumeQueue    chan *consumeConcurrentlyRequest
-	batchSize       int
+	consumer          ConcurrentlyConsumer
+	consumeTimeout    time.Duration
+	concurrentCount   int
+	consumeQueue      chan *consumeConcurrentlyRequest
+	batchSize         int
+	maxReconsumeTimes int
+	queueLocker       queueLocker
 
 	consumeLaterInterval time.Duration
 }
@@ -61,6 +68,8 @@ type concurrentlyServiceConfig struct {
 	concurrentCount      int
 	batchSize            int
 	cleanExpiredInterval time.Duration
+	maxReconsumeTimes    int         // the times retried locally when broadcasting
+	queueLocker          queueLocker // unlocks the queues locked by the sticky reblancing, nil if not
 }
 
 func newConsumeConcurrentlyService(conf concurrentlyServiceConfig) (
@@ -102,6 +111,8 @@ func newConsumeConcurrentlyService(conf concurrentlyServiceConfig) (
 		consumeQueue:         make(chan *consumeConcurrentlyRequest, conf.concurrentCount*3/2),
 		consumeTimeout:       conf.consumeTimeout,
 		batchSize:            conf.batchSize,
+		maxReconsumeTimes:    conf.maxReconsumeTimes,
+		queueLocker:          conf.queueLocker,
 		cleanExpiredInterval: conf.cleanExpiredInterval,
 		consumeLaterInterval: time.Second,
 	}
@@ -117,6 +128,38 @@ func (cs *consumeConcurrentlyService) start() {
 	cs.startConsume()
 }
 
+func (cs *consumeConcurrentlyService) shutdown() {
+	cs.consumeService.shutdown()
+	if cs.queueLocker == nil {
+		return
+	}
+
+	// the other clients lock the queues without waiting for the expiration
+	queuesOfBroker := make(map[string][]message.Queue)
+	for _, mq := range cs.messageQueues() {
+		queuesOfBroker[mq.BrokerName] = append(queuesOfBroker[mq.BrokerName], mq)
+	}
+	for b, mqs := range queuesOfBroker {
+		if err := cs.queueLocker.unlockQueues(b, mqs); err != nil {
+			cs.logger.Errorf("unlock queues %v of broker %s error:%s", mqs, b, err)
+		}
+	}
+}
+
+// removeOldMessageQueue removes the queue, and unlocks it if it is locked by the sticky reblancing
+func (cs *consumeConcurrentlyService) removeOldMessageQueue(mq *message.Queue) bool {
+	if !cs.consumeService.removeOldMessageQueue(mq) {
+		return false
+	}
+
+	if cs.queueLocker != nil {
+		if err := cs.queueLocker.unlockQueues(mq.BrokerName, []message.Queue{*mq}); err != nil {
+			cs.logger.Errorf("unlock queue %s error:%s", mq, err)
+		}
+	}
+	return true
+}
+
 func (cs *consumeConcurrentlyService) startConsume() {
 	for i := 0; i < cs.concurrentCount; i++ {
 		cs.wg.Add(1)
@@ -141,13 +184,16 @@ func (cs *consumeConcurrentlyService) consume(r *consumeConcurrentlyRequest) {
 		return
 	}
 
-	ctx := &ConcurrentlyContext{MessageQueue: r.messageQueue}
+	// all the messages are consumed successfully by default
+	ctx := &ConcurrentlyContext{MessageQueue: r.messageQueue, AckIndex: len(r.messages) - 1}
 	cs.resetRetryTopic(r.messages)
 	begin := time.Now()
+	processQueue.setConsumeStartTime(r.messages, begin)
 	status := cs.consumer.Consume(r.messages[:], ctx)
 	consumeRT := time.Since(begin)
+	cs.stats.incConsumeRT(r.messageQueue.Topic, consumeRT)
 	if consumeRT > cs.consumeTimeout {
-		cs.logger.Infof("consume timeout") // TODO
+		cs.logger.Warnf("consume timeout, cost:%s, messageQueue=%v", consumeRT, r.messageQueue)
 	}
 
 	if processQueue.isDropped() {
@@ -160,15 +206,42 @@ func (cs *consumeConcurrentlyService) consume(r *consumeConcurrentlyRequest) {
 	cs.processConsumeResult(status, ctx, r)
 }
 
+// consumeMessageDirectly consumes the message out of the process queue, the result is not processed
+func (cs *consumeConcurrentlyService) consumeMessageDirectly(
+	m *message.MessageExt, broker string,
+) *rpc.ConsumeMessageDirectlyResult {
+	msgs := []*message.MessageExt{m}
+	cs.resetRetryTopic(msgs)
+	ctx := &ConcurrentlyContext{
+		MessageQueue: &message.Queue{Topic: m.Topic, BrokerName: broker, QueueID: m.QueueID},
+	}
+
+	return consumeDirectly(func() string {
+		switch cs.consumer.Consume(msgs, ctx) {
+		case ConcurrentlySuccess:
+			return rpc.ConsumeSuccess
+		case ReconsumeLater:
+			return rpc.ConsumeLater
+		default:
+			return rpc.ConsumeReturnNull
+		}
+	}, false)
+}
+
 func (cs *consumeConcurrentlyService) processConsumeResult(
 	status ConsumeConcurrentlyStatus, ctx *ConcurrentlyContext, r *consumeConcurrentlyRequest,
 ) {
-	// TODO statistic
-
-	failedIndex := ctx.AckIndex + 1
-	if status == ReconsumeLater {
-		failedIndex = 0
+	ackIndex := ctx.AckIndex
+	switch {
+	case status == ReconsumeLater || ackIndex < -1:
+		ackIndex = -1
+	case ackIndex >= len(r.messages):
+		ackIndex = len(r.messages) - 1
 	}
+	failedIndex := ackIndex + 1
+
+	cs.stats.incConsumeOKTPS(r.messageQueue.Topic, failedIndex)
+	cs.stats.incConsumeFailedTPS(r.messageQueue.Topic, len(r.messages)-failedIndex)
 
 	var removedMsgs []*message.MessageExt
 	switch cs.messageModel {
@@ -184,8 +257,9 @@ func (cs *consumeConcurrentlyService) processConsumeResult(
 	r.processQueue.removeMessages(removedMsgs)
 
 	if !r.processQueue.isDropped() {
-		cs.offseter.updateOffsetIfGreater(r.messageQueue, r.processQueue.queueOffsetToConsume())
+		cs.offseter.UpdateOffsetIfGreater(r.messageQueue, r.processQueue.queueOffsetToConsume())
 	}
+	cs.removeReleasedQueue(r.messageQueue, r.processQueue)
 }
 
 func (cs *consumeConcurrentlyService) processBroadcasting(
@@ -193,10 +267,29 @@ func (cs *consumeConcurrentlyService) processBroadcasting(
 ) (
 	removedMsgs []*message.MessageExt,
 ) {
-	for _, m := range r.messages[failedIndex:] {
-		cs.logger.Warnf("broadcasting, the message consumed failed and drop it, %s", m.String())
+	failedIndex = min(failedIndex, len(r.messages))
+	removedMsgs = make([]*message.MessageExt, failedIndex, len(r.messages))
+	copy(removedMsgs, r.messages[:failedIndex])
+
+	consumeFailedMsgs := r.messages[failedIndex:]
+	retryMsgs := make([]*message.MessageExt, 0, len(consumeFailedMsgs))
+	for _, m := range consumeFailedMsgs {
+		if int(m.ReconsumeTimes) >= cs.maxReconsumeTimes {
+			cs.logger.Warnf(
+				"broadcasting, the message consumed failed %d times and drop it, %s", m.ReconsumeTimes+1, m.String(),
+			)
+			removedMsgs = append(removedMsgs, m)
+			continue
+		}
+
+		m.ReconsumeTimes++
+		retryMsgs = append(retryMsgs, m)
+	}
+
+	if len(retryMsgs) > 0 {
+		r.messages = retryMsgs
+		cs.submitConsumeRequestLater(r)
 	}
-	removedMsgs = r.messages
 	return
 }
 
@@ -278,35 +371,52 @@ func (cs *consumeConcurrentlyService) putNewMessageQueue(mq *message.Queue) (*pr
 	return &pq.(*concurrentProcessQueue).processQueue, true
 }
 
+// clearExpiredMessage sends back the messages consumed longer than the consume timeout,
+// so the hung consuming does not block the offset of the queue
 func (cs *consumeConcurrentlyService) clearExpiredMessage() {
-	queues := make([]*concurrentProcessQueue, 0, 32)
-	cs.processQueues.Range(func(_, v interface{}) bool {
-		queues = append(queues, v.(*concurrentProcessQueue))
+	type queue struct {
+		mq message.Queue
+		pq *concurrentProcessQueue
+	}
+	queues := make([]queue, 0, 32)
+	cs.processQueues.Range(func(k, v interface{}) bool {
+		queues = append(queues, queue{mq: k.(message.Queue), pq: v.(*concurrentProcessQueue)})
 		return true
 	})
 
-	for _, q := range queues {
-		for i := 0; i < 16; i++ {
-			m, ok := q.minOffsetMessage()
-			if !ok {
-				break
-			}
+	for i := range queues {
+		cs.clearExpiredMessageOfQueue(&queues[i].mq, queues[i].pq)
+	}
+}
 
-			startConsumeTime, _ := m.GetConsumeStartTimestamp()
-			if time.Now().UnixNano()-startConsumeTime < int64(cs.consumeTimeout) {
-				break
-			}
+func (cs *consumeConcurrentlyService) clearExpiredMessageOfQueue(
+	mq *message.Queue, q *concurrentProcessQueue,
+) {
+	removed := false
+	for i := 0; i < 16 && !q.isDropped(); i++ {
+		m, ok := q.expiredMinOffsetMessage(time.Now(), cs.consumeTimeout)
+		if !ok {
+			break
+		}
 
-			err := cs.messageSendBack.SendBack(m, 3, "") // broker is empty
-			if err != nil {
-				cs.logger.Errorf("send message:%v failed:%s", m.String(), err)
-				continue
-			}
+		// no retry topic when broadcasting, drop it
+		if cs.messageModel == BroadCasting {
+			cs.logger.Warnf("broadcasting, drop the expired message:%v of queue:%s", m.String(), mq)
+		} else if err := cs.messageSendBack.SendBack(m, delayLevelByBroker, mq.BrokerName); err != nil {
+			cs.logger.Errorf("send back expired message:%v failed:%s", m.String(), err)
+			break
+		}
 
-			if !q.removeIfMinOffset(m.QueueOffset) {
-				cs.logger.Errorf("remove message:%v from q failed", m.String())
-			}
+		if !q.removeIfMinOffset(m.QueueOffset) {
+			cs.logger.Errorf("remove expired message:%v from q failed", m.String())
+			continue
 		}
+		removed = true
+		cs.logger.Infof("clear expired message:%s of queue:%s", m.MsgID, mq)
+	}
+
+	if removed && !q.isDropped() {
+		cs.offseter.UpdateOffsetIfGreater(mq, q.queueOffsetToConsume())
 	}
 }
 
@@ -319,7 +429,7 @@ func (cs *consumeConcurrentlyService) insertNewMessageQueue(mq *message.Queue) (
 		cs.logger.Infof("message queue:%s exist", mq)
 		return nil, false
 	}
-	cs.offseter.removeOffset(mq)
+	cs.offseter.RemoveOffset(mq)
 	return &cpq.processQueue, true
 }
 
@@ -327,12 +437,19 @@ type concurrentProcessQueue struct {
 	processQueue
 }
 
-func (cpq *concurrentProcessQueue) minOffsetMessage() (m *message.MessageExt, ok bool) {
+// expiredMinOffsetMessage returns the copy of the message with the min offset,
+// if it is consumed longer than the timeout
+func (cpq *concurrentProcessQueue) expiredMinOffsetMessage(now time.Time, timeout time.Duration) (
+	m *message.MessageExt, ok bool,
+) {
 	cpq.RLock()
 	if cpq.messages.Size() > 0 {
 		_, v := cpq.messages.First()
-		m = v.(*message.MessageExt)
-		ok = true
+		min := v.(*message.MessageExt)
+		startTime, exist := min.GetConsumeStartTimestamp()
+		if exist && now.UnixNano()/int64(time.Millisecond)-startTime >= int64(timeout/time.Millisecond) {
+			m, ok = copyMessage(min), true
+		}
 	}
 	cpq.RUnlock()
 	return
@@ -342,11 +459,23 @@ func (cpq *concurrentProcessQueue) removeIfMinOffset(of int64) (ok bool) {
 	cpq.Lock()
 	if cpq.messages.Size() > 0 {
 		_, v := cpq.messages.First()
-		if of == v.(*message.MessageExt).QueueOffset {
+		if m := v.(*message.MessageExt); of == m.QueueOffset {
 			cpq.messages.Remove(offset(of))
+			atomic.AddInt64(&cpq.msgSize, -int64(len(m.Body)))
+			atomic.AddInt32(&cpq.msgCount, -1)
+			ok = true
 		}
-		ok = true
 	}
 	cpq.Unlock()
 	return
 }
+
+// copyMessage returns the copy of the message, whose properties can be read without the lock
+func copyMessage(m *message.MessageExt) *message.MessageExt {
+	c := *m
+	c.Properties = make(map[string]string, len(m.Properties))
+	for k, v := range m.Properties {
+		c.Properties[k] = v
+	}
+	return &c
+}
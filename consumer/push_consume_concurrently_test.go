@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 )
 
 type mockConcurrentlyConsumer struct {
@@ -29,44 +30,52 @@ func (m *mockConcurrentlyConsumer) Consume(
 type mockSendback struct {
 	runSendback bool
 	sendErr     error
+	delayLevel  int
 
 	msgs []*message.MessageExt
 }
 
 func (ms *mockSendback) SendBack(m *message.MessageExt, delayLevel int, broker string) error {
-	ms.runSendback = true
+	ms.runSendback, ms.delayLevel = true, delayLevel
 	ms.msgs = append(ms.msgs, m)
 	return ms.sendErr
 }
 
 type mockOffseter struct {
+	sync.Mutex
 	runUpdate     bool
 	offset        int64
 	readOffsetErr error
 }
 
-func (m *mockOffseter) persist() error {
+func (m *mockOffseter) Load() error {
 	return nil
 }
 
-func (m *mockOffseter) updateQueues(...*message.Queue) {
+func (m *mockOffseter) Persist() error {
+	return nil
+}
+
+func (m *mockOffseter) UpdateQueues(...*message.Queue) {
 	return
 }
 
-func (m *mockOffseter) updateOffsetIfGreater(_ *message.Queue, offset int64) {
+func (m *mockOffseter) UpdateOffsetIfGreater(_ *message.Queue, offset int64) {
+	m.Lock()
 	m.offset = offset
 	m.runUpdate = true
+	m.Unlock()
 }
 
-func (m *mockOffseter) persistOne(_ *message.Queue) {
+func (m *mockOffseter) PersistOne(_ *message.Queue) {
 }
 
-func (m *mockOffseter) removeOffset(_ *message.Queue) (offset int64, ok bool) {
+func (m *mockOffseter) RemoveOffset(_ *message.Queue) (offset int64, ok bool) {
 	offset = m.offset
 	return
 }
 
-func (m *mockOffseter) readOffset(_ *message.Queue, _ int) (offset int64, err error) {
+func (m *mockOffseter) ReadOffset(_ *message.Queue, _ int) (offset int64, err error) {
 	err = m.readOffsetErr
 	offset = m.offset
 	return
@@ -131,11 +140,12 @@ func TestNewConcurrentlyService(t *testing.T) {
 
 func TestStartShutdown(t *testing.T) {
 	cs := newTestConcurrentlyService(t)
+	cs.messageModel = Clustering
 	// expired message
 	pq := cs.newProcessQueue(&message.Queue{})
 	msgs := []*message.MessageExt{}
 	m := &message.MessageExt{}
-	m.SetConsumeStartTimestamp(time.Now().Add(-time.Hour).UnixNano())
+	m.SetConsumeStartTimestamp(time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond))
 	msgs = append(msgs, m)
 	pq.putMessages(msgs)
 
@@ -164,7 +174,7 @@ func TestSubmitRequestSuccess(t *testing.T) {
 
 	msgs := []*message.MessageExt{&message.MessageExt{}}
 	for i := 0; i < count; i++ {
-		go func() { cs.submitConsumeRequest(msgs, newProcessQueue(), nil) }()
+		go func() { cs.submitConsumeRequest(msgs, newProcessQueue(), &message.Queue{}) }()
 	}
 
 	mockConsumer.wg.Wait()
@@ -206,6 +216,31 @@ func TestConsumeConcurrentlyProcessResultConsumeLater(t *testing.T) {
 		assert.Equal(t, 0, pq.messages.Size())
 		assert.True(t, offsetUpdater.runUpdate)
 		assert.Equal(t, int64(3), offsetUpdater.offset)
+
+		// retry locally
+		cs.maxReconsumeTimes = 1
+		msgs = []*message.MessageExt{
+			&message.MessageExt{QueueOffset: 3}, &message.MessageExt{QueueOffset: 4},
+		}
+		pq = newProcessQueue()
+		pq.putMessages(msgs)
+
+		r := &consumeConcurrentlyRequest{messages: msgs, processQueue: pq, messageQueue: &message.Queue{}}
+		cs.processConsumeResult(ConcurrentlySuccess, &ConcurrentlyContext{AckIndex: 0}, r)
+		assert.Equal(t, 1, pq.messages.Size())
+		assert.Equal(t, int64(4), offsetUpdater.offset)
+		assert.Equal(t, []*message.MessageExt{msgs[1]}, r.messages)
+		assert.Equal(t, int32(1), msgs[1].ReconsumeTimes)
+		assert.False(t, cs.messageSendBack.(*mockSendback).runSendback)
+
+		// drop it when reaching the max reconsume times
+		cs.processConsumeResult(ReconsumeLater, &ConcurrentlyContext{}, r)
+		assert.Equal(t, 0, pq.messages.Size())
+		assert.Equal(t, int64(5), offsetUpdater.offset)
+
+		status := cs.stats.status("")
+		assert.Equal(t, int64(5), status.ConsumeFailedMsgs)
+		assert.True(t, status.ConsumeOKTPS > 0)
 	})
 
 	t.Run("clustering", func(t *testing.T) {
@@ -348,18 +383,107 @@ func TestConsumeConcurrentlyProcessResultSuc(t *testing.T) {
 	})
 }
 
+func TestConsumeConcurrentlyBatchSuc(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	cs.messageModel = Clustering
+	sendbacker, offseter := cs.messageSendBack.(*mockSendback), cs.offseter.(*mockOffseter)
+
+	mq := &message.Queue{BrokerName: "b"}
+	pq := cs.newProcessQueue(mq)
+	msgs := []*message.MessageExt{{QueueOffset: 1}, {QueueOffset: 2}, {QueueOffset: 3}}
+	pq.putMessages(msgs)
+
+	cs.consumer.(*mockConcurrentlyConsumer).wg.Add(1)
+	cs.consume(&consumeConcurrentlyRequest{messages: msgs, processQueue: pq, messageQueue: mq})
+	assert.False(t, sendbacker.runSendback)
+	assert.Equal(t, int32(0), pq.messageCount())
+	assert.Equal(t, int64(4), offseter.offset)
+
+	// the ack index out of range
+	pq.putMessages(msgs)
+	cs.processConsumeResult(
+		ConcurrentlySuccess,
+		&ConcurrentlyContext{MessageQueue: mq, AckIndex: len(msgs)},
+		&consumeConcurrentlyRequest{messages: msgs, processQueue: pq, messageQueue: mq},
+	)
+	assert.False(t, sendbacker.runSendback)
+	assert.Equal(t, int32(0), pq.messageCount())
+
+	pq.putMessages(msgs)
+	cs.processConsumeResult(
+		ConcurrentlySuccess,
+		&ConcurrentlyContext{MessageQueue: mq, AckIndex: -10},
+		&consumeConcurrentlyRequest{messages: msgs, processQueue: pq, messageQueue: mq},
+	)
+	assert.Equal(t, msgs, sendbacker.msgs)
+	assert.Equal(t, int32(0), pq.messageCount())
+}
+
+func TestConsumeConcurrentlyBroadcastingBatchSuc(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	offseter := cs.offseter.(*mockOffseter)
+
+	mq := &message.Queue{}
+	pq := cs.newProcessQueue(mq)
+	msgs := []*message.MessageExt{{QueueOffset: 1}, {QueueOffset: 2}, {QueueOffset: 3}}
+	pq.putMessages(msgs)
+
+	cs.consumer.(*mockConcurrentlyConsumer).wg.Add(1)
+	cs.consume(&consumeConcurrentlyRequest{messages: msgs, processQueue: pq, messageQueue: mq})
+	assert.Equal(t, int32(0), pq.messageCount())
+	assert.Equal(t, int64(4), offseter.offset)
+
+	// the failed index out of range
+	pq.putMessages(msgs)
+	r := &consumeConcurrentlyRequest{messages: msgs, processQueue: pq, messageQueue: mq}
+	assert.Equal(t, msgs, cs.processBroadcasting(len(msgs)+1, r))
+	assert.Equal(t, msgs, r.messages)
+}
+
+func TestConsumeConcurrentlyReleaseQueue(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	cs.messageModel = BroadCasting
+	mq := &message.Queue{}
+	pq := cs.newProcessQueue(mq)
+
+	msgs := []*message.MessageExt{&message.MessageExt{QueueOffset: 1}, &message.MessageExt{QueueOffset: 2}}
+	pq.putMessages(msgs)
+	assert.True(t, pq.release(time.Now()))
+
+	// not released with the pulled messages
+	cs.processConsumeResult(
+		ConcurrentlySuccess,
+		&ConcurrentlyContext{AckIndex: 0},
+		&consumeConcurrentlyRequest{messages: msgs[:1], processQueue: pq, messageQueue: mq},
+	)
+	assert.True(t, pq.isReleasing())
+	_, ok := cs.processQueue(mq)
+	assert.True(t, ok)
+
+	// released after consuming all the pulled messages
+	cs.processConsumeResult(
+		ConcurrentlySuccess,
+		&ConcurrentlyContext{AckIndex: 0},
+		&consumeConcurrentlyRequest{messages: msgs[1:], processQueue: pq, messageQueue: mq},
+	)
+	assert.True(t, pq.isDropped())
+	_, ok = cs.processQueue(mq)
+	assert.False(t, ok)
+}
+
 func TestConcurrentlyProcessqueue(t *testing.T) {
 	cs := newTestConcurrentlyService(t)
+	cs.messageModel = Clustering
 
 	// not over limit
 	pq := cs.newProcessQueue(&message.Queue{})
 	msgs := []*message.MessageExt{}
-	for i, t := 0, time.Now().Add(-time.Hour).UnixNano(); i < 10; i++ {
+	for i, t := 0, time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond); i < 10; i++ {
 		m := &message.MessageExt{QueueOffset: int64(i)}
 		m.SetConsumeStartTimestamp(t + int64(i))
 		msgs = append(msgs, m)
 	}
-	for i, t := 0, time.Now().UnixNano(); i < 10; i++ {
+	for i, t := 0, time.Now().UnixNano()/int64(time.Millisecond); i < 10; i++ {
 		m := &message.MessageExt{QueueOffset: int64(i + 100)}
 		m.SetConsumeStartTimestamp(t)
 		msgs = append(msgs, m)
@@ -376,7 +500,7 @@ func TestConcurrentlyProcessqueue(t *testing.T) {
 	// over the limit
 	sendbacker.msgs = nil
 	msgs = msgs[0:10]
-	for i, t := 0, time.Now().Add(-time.Hour).UnixNano(); i < 10; i++ {
+	for i, t := 0, time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond); i < 10; i++ {
 		m := &message.MessageExt{QueueOffset: int64(i + 1000)}
 		m.SetConsumeStartTimestamp(t + int64(i))
 		msgs = append(msgs, m)
@@ -391,6 +515,83 @@ func TestConcurrentlyProcessqueue(t *testing.T) {
 	assert.Equal(t, msgs[:16], expiredMsgs)
 }
 
+func TestClearExpiredMessage(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	cs.messageModel = Clustering
+	sendbacker, offseter := cs.messageSendBack.(*mockSendback), cs.offseter.(*mockOffseter)
+
+	mq := &message.Queue{BrokerName: "b"}
+	pq := cs.newProcessQueue(mq)
+	msgs := []*message.MessageExt{}
+	for i := 0; i < 5; i++ {
+		msgs = append(msgs, &message.MessageExt{QueueOffset: int64(i), Body: []byte("body")})
+	}
+	pq.putMessages(msgs)
+
+	// not consumed yet
+	cs.clearExpiredMessage()
+	assert.False(t, sendbacker.runSendback)
+
+	// the consume start time is set when consuming
+	cs.consumer.(*mockConcurrentlyConsumer).wg.Add(1)
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	cs.consume(&consumeConcurrentlyRequest{messages: msgs[3:], processQueue: pq, messageQueue: mq})
+	startTime, ok := msgs[3].GetConsumeStartTimestamp()
+	assert.True(t, ok)
+	assert.True(t, before <= startTime && startTime <= time.Now().UnixNano()/int64(time.Millisecond))
+	assert.Equal(t, int32(3), pq.messageCount())
+	sendbacker.runSendback, sendbacker.msgs, offseter.runUpdate = false, nil, false
+
+	// the messages with the min offset are expired
+	expired := time.Now().Add(-cs.consumeTimeout)
+	pq.setConsumeStartTime(msgs[:2], expired)
+	pq.setConsumeStartTime(msgs[2:3], time.Now())
+
+	sendbacker.sendErr = errors.New("mock send back error")
+	cs.clearExpiredMessage()
+	assert.Equal(t, 1, len(sendbacker.msgs))
+	assert.Equal(t, int32(3), pq.messageCount())
+	assert.False(t, offseter.runUpdate)
+
+	sendbacker.sendErr, sendbacker.msgs = nil, nil
+	cs.clearExpiredMessage()
+	assert.Equal(t, msgs[:2], sendbacker.msgs)
+	assert.False(t, sendbacker.msgs[0] == msgs[0]) // copied
+	assert.Equal(t, delayLevelByBroker, sendbacker.delayLevel)
+	assert.Equal(t, int32(1), pq.messageCount())
+	assert.Equal(t, int64(4), pq.messageSize())
+	assert.True(t, offseter.runUpdate)
+	assert.Equal(t, int64(2), offseter.offset)
+
+	// the dropped queue is ignored
+	sendbacker.msgs = nil
+	pq.setConsumeStartTime(msgs[2:3], expired)
+	pq.drop()
+	cs.clearExpiredMessage()
+	assert.Equal(t, 0, len(sendbacker.msgs))
+}
+
+func TestClearExpiredMessageBroadcasting(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	cs.messageModel = BroadCasting
+	sendbacker, offseter := cs.messageSendBack.(*mockSendback), cs.offseter.(*mockOffseter)
+	sendbacker.sendErr = errSendBackWhenBroadcasting
+
+	mq := &message.Queue{BrokerName: "b"}
+	pq := cs.newProcessQueue(mq)
+	msgs := []*message.MessageExt{{QueueOffset: 1}, {QueueOffset: 2}, {QueueOffset: 3}}
+	pq.putMessages(msgs)
+	pq.setConsumeStartTime(msgs[:2], time.Now().Add(-cs.consumeTimeout))
+	pq.setConsumeStartTime(msgs[2:], time.Now())
+
+	// dropped without sending back
+	cs.clearExpiredMessage()
+	assert.False(t, sendbacker.runSendback)
+	assert.Equal(t, int32(1), pq.messageCount())
+	assert.True(t, offseter.runUpdate)
+	assert.Equal(t, int64(3), offseter.offset)
+}
+
 func TestConcurrentSubmitLater(t *testing.T) {
 	cs := newTestConcurrentlyService(t)
 	cs.start()
@@ -442,3 +643,56 @@ func TestPutNewMessageQueue(t *testing.T) {
 	assert.False(t, ok)
 	assert.Nil(t, pq)
 }
+
+func TestConcurrentlyUnlockStickyQueues(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	locker := &mockQueueLocker{}
+	cs.queueLocker = locker
+	cs.start()
+
+	mqs := []message.Queue{{BrokerName: "b0"}, {BrokerName: "b0", QueueID: 1}, {BrokerName: "b1"}}
+	for i := range mqs {
+		cs.putNewMessageQueue(&mqs[i])
+	}
+
+	// unlocked after removed
+	assert.True(t, cs.removeOldMessageQueue(&mqs[0]))
+	assert.Equal(t, mqs[:1], locker.unlockedQueues)
+	assert.False(t, cs.removeOldMessageQueue(&mqs[0]))
+	assert.Equal(t, 1, len(locker.unlockedQueues))
+
+	// unlock all after shutdown
+	cs.shutdown()
+	assert.ElementsMatch(t, mqs, locker.unlockedQueues)
+}
+
+type panicConcurrentlyConsumer struct{}
+
+func (panicConcurrentlyConsumer) Consume(
+	msgs []*message.MessageExt, ctx *ConcurrentlyContext,
+) ConsumeConcurrentlyStatus {
+	panic("bad consumer")
+}
+
+func TestConsumeConcurrentlyDirectly(t *testing.T) {
+	cs := newTestConcurrentlyService(t)
+	consumer := cs.consumer.(*mockConcurrentlyConsumer)
+	m := &message.MessageExt{Message: message.Message{Topic: "direct"}, QueueID: 2}
+
+	consumer.wg.Add(1)
+	r := cs.consumeMessageDirectly(m, "b")
+	assert.Equal(t, rpc.ConsumeSuccess, r.ConsumeResult)
+	assert.False(t, r.Order)
+	assert.True(t, r.AutoCommit)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&consumer.consumeCount))
+
+	consumer.ret = ReconsumeLater
+	consumer.wg.Add(1)
+	r = cs.consumeMessageDirectly(m, "b")
+	assert.Equal(t, rpc.ConsumeLater, r.ConsumeResult)
+
+	cs.consumer = panicConcurrentlyConsumer{}
+	r = cs.consumeMessageDirectly(m, "b")
+	assert.Equal(t, rpc.ConsumeThrowException, r.ConsumeResult)
+	assert.Equal(t, "bad consumer", r.Remark)
+}
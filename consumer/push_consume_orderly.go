@@ -0,0 +1,567 @@
+package consumer
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/consumer/internel/tree"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+)
+
+const (
+	defaultLockInterval               = time.Second * 20
+	defaultLockMaxLiveTime            = time.Second * 30
+	defaultSuspendTime                = time.Second
+	defaultMaxConsumeContinuouslyTime = time.Minute
+	defaultUnlockDelay                = time.Second * 20
+	defaultTryLockConsumeTimeout      = time.Second
+	defaultRemoveRetryDelay           = time.Second
+)
+
+// ConsumeOrderlyStatus consume orderly result
+type ConsumeOrderlyStatus int
+
+// predefined consume orderly result
+const (
+	OrderlySuccess ConsumeOrderlyStatus = iota
+	SuspendCurrentQueueAMoment
+)
+
+// OrderlyContext consume orderly context
+type OrderlyContext struct {
+	MessageQueue *message.Queue
+	// the time suspending the queue when the consume result is SuspendCurrentQueueAMoment
+	// use the default value when it is not positive
+	SuspendTime time.Duration
+}
+
+// OrderlyConsumer consumer consumes the messages orderly
+// the messages in the same queue are consumed in one goroutine by the order of the queue offset
+type OrderlyConsumer interface {
+	Consume(messages []*message.MessageExt, ctx *OrderlyContext) ConsumeOrderlyStatus
+}
+
+// queueLocker locks the message queue in the broker, only the owner of the lock consumes the queue
+type queueLocker interface {
+	lockQueues(broker string, mqs []message.Queue) ([]message.Queue, error)
+	unlockQueues(broker string, mqs []message.Queue) error
+}
+
+type consumeOrderlyService struct {
+	*consumeService
+
+	consumer    OrderlyConsumer
+	queueLocker queueLocker
+	batchSize   int
+
+	lockInterval               time.Duration
+	lockMaxLiveTime            time.Duration
+	suspendTime                time.Duration
+	maxConsumeContinuouslyTime time.Duration
+	unlockDelayTime            time.Duration
+	removeRetryDelay           time.Duration
+}
+
+type orderlyServiceConfig struct {
+	consumeServiceConfig
+
+	consumer     OrderlyConsumer
+	queueLocker  queueLocker
+	batchSize    int
+	lockInterval time.Duration
+	suspendTime  time.Duration
+}
+
+func newConsumeOrderlyService(conf orderlyServiceConfig) (*consumeOrderlyService, error) {
+	if conf.consumer == nil {
+		return nil, errors.New("new consumer orderly service error:empty consumer")
+	}
+
+	if conf.queueLocker == nil {
+		return nil, errors.New("new consumer orderly service error:empty queue locker")
+	}
+
+	if conf.batchSize <= 0 {
+		conf.batchSize = 1
+	}
+
+	if conf.lockInterval <= 0 {
+		conf.lockInterval = defaultLockInterval
+	}
+
+	if conf.suspendTime <= 0 {
+		conf.suspendTime = defaultSuspendTime
+	}
+
+	c, err := newConsumeService(conf.consumeServiceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &consumeOrderlyService{
+		consumeService:             c,
+		consumer:                   conf.consumer,
+		queueLocker:                conf.queueLocker,
+		batchSize:                  conf.batchSize,
+		lockInterval:               conf.lockInterval,
+		lockMaxLiveTime:            defaultLockMaxLiveTime,
+		suspendTime:                conf.suspendTime,
+		maxConsumeContinuouslyTime: defaultMaxConsumeContinuouslyTime,
+		unlockDelayTime:            defaultUnlockDelay,
+		removeRetryDelay:           defaultRemoveRetryDelay,
+	}
+	cs.consumeService.oldMessageQueueRemover = cs.removeOldMessageQueue
+
+	return cs, nil
+}
+
+func (cs *consumeOrderlyService) start() {
+	cs.consumeService.start()
+	if cs.messageModel == Clustering {
+		cs.startFunc(cs.lockAll, cs.lockInterval)
+	}
+}
+
+func (cs *consumeOrderlyService) shutdown() {
+	cs.consumeService.shutdown()
+	if cs.messageModel == Clustering {
+		cs.unlockAll()
+	}
+}
+
+func (cs *consumeOrderlyService) processQueuesByBroker() map[string][]message.Queue {
+	mqs := make(map[string][]message.Queue)
+	cs.processQueues.Range(func(k, _ interface{}) bool {
+		mq := k.(message.Queue)
+		mqs[mq.BrokerName] = append(mqs[mq.BrokerName], mq)
+		return true
+	})
+	return mqs
+}
+
+// lockAll locks all the message queues consumed, unlocked ones are marked
+func (cs *consumeOrderlyService) lockAll() {
+	for broker, mqs := range cs.processQueuesByBroker() {
+		locked, err := cs.queueLocker.lockQueues(broker, mqs)
+		if err != nil {
+			cs.logger.Errorf("lock queues of broker %s error:%s", broker, err)
+			continue
+		}
+
+		now := time.Now()
+	NEXT:
+		for _, mq := range mqs {
+			q := cs.orderlyProcessQueue(&mq)
+			if q == nil {
+				continue
+			}
+
+			for _, lq := range locked {
+				if lq == mq {
+					q.markLocked(now)
+					continue NEXT
+				}
+			}
+
+			cs.logger.Warnf("lock message queue %s failed", &mq)
+			q.markUnlocked()
+		}
+	}
+}
+
+func (cs *consumeOrderlyService) unlockAll() {
+	for broker, mqs := range cs.processQueuesByBroker() {
+		if err := cs.queueLocker.unlockQueues(broker, mqs); err != nil {
+			cs.logger.Errorf("unlock queues of broker %s error:%s", broker, err)
+			continue
+		}
+
+		for _, mq := range mqs {
+			if q := cs.orderlyProcessQueue(&mq); q != nil {
+				q.markUnlocked()
+			}
+		}
+	}
+}
+
+func (cs *consumeOrderlyService) lockOne(mq *message.Queue) bool {
+	locked, err := cs.queueLocker.lockQueues(mq.BrokerName, []message.Queue{*mq})
+	if err != nil {
+		cs.logger.Errorf("lock message queue %s error:%s", mq, err)
+		return false
+	}
+
+	for _, lq := range locked {
+		if lq == *mq {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *consumeOrderlyService) orderlyProcessQueue(mq *message.Queue) *orderlyProcessQueue {
+	v, ok := cs.processQueues.Load(*mq)
+	if !ok {
+		return nil
+	}
+	return v.(*orderlyProcessQueue)
+}
+
+func (cs *consumeOrderlyService) insertNewMessageQueue(mq *message.Queue) (
+	pq *processQueue, ok bool,
+) {
+	if _, ok = cs.processQueues.Load(*mq); ok {
+		cs.logger.Infof("message queue:%s exist", mq)
+		return nil, false
+	}
+
+	opq := newOrderlyProcessQueue()
+	if cs.messageModel == Clustering {
+		if !cs.lockOne(mq) {
+			cs.logger.Warnf("lock message queue %s failed, consume it later", mq)
+			return nil, false
+		}
+		opq.markLocked(time.Now())
+	}
+
+	if _, ok = cs.processQueues.LoadOrStore(*mq, opq); ok {
+		cs.logger.Infof("message queue:%s exist", mq)
+		return nil, false
+	}
+	cs.offseter.RemoveOffset(mq)
+	return &opq.processQueue, true
+}
+
+// removeOldMessageQueue drops the queue, and unlocks it in the broker
+// returns false if the queue is being consumed, which is removed later
+func (cs *consumeOrderlyService) removeOldMessageQueue(mq *message.Queue) bool {
+	q := cs.orderlyProcessQueue(mq)
+	if q == nil {
+		return false
+	}
+	q.drop()
+
+	if cs.messageModel == Clustering {
+		if !q.tryLockConsume(defaultTryLockConsumeTimeout) {
+			cs.logger.Warnf("message queue %s is being consumed, remove it later", mq)
+			cs.removeLater(mq, q)
+			return false
+		}
+		cs.unlockDelay(mq, q)
+		q.unlockConsume()
+	}
+
+	cs.offseter.PersistOne(mq)
+	cs.offseter.RemoveOffset(mq)
+	cs.processQueues.Delete(*mq)
+	cs.stats.removeLag(mq)
+	return true
+}
+
+// removeLater retries removing the dropped queue, so that it can be added again by the next reblancing
+func (cs *consumeOrderlyService) removeLater(mq *message.Queue, q *orderlyProcessQueue) {
+	retry := *mq
+	cs.scheduler.scheduleFuncAfter(func() {
+		if cs.orderlyProcessQueue(&retry) == q {
+			cs.removeOldMessageQueue(&retry)
+		}
+	}, cs.removeRetryDelay)
+}
+
+// unlockDelay unlocks the queue in the broker, it is delayed when some messages are not consumed
+// in case of consuming by another consumer at the same time
+func (cs *consumeOrderlyService) unlockDelay(mq *message.Queue, q *orderlyProcessQueue) {
+	unlock := func() {
+		if err := cs.queueLocker.unlockQueues(mq.BrokerName, []message.Queue{*mq}); err != nil {
+			cs.logger.Errorf("unlock message queue %s error:%s", mq, err)
+		}
+	}
+
+	if q.messageCount() > 0 {
+		cs.logger.Infof("message queue %s has messages, unlock it later", mq)
+		cs.scheduler.scheduleFuncAfter(func() {
+			if cs.orderlyProcessQueue(mq) != nil {
+				cs.logger.Infof("message queue %s is processed again, skip unlocking", mq)
+				return
+			}
+			unlock()
+		}, cs.unlockDelayTime)
+		return
+	}
+	unlock()
+}
+
+func (cs *consumeOrderlyService) submitConsumeRequest(
+	messages []*message.MessageExt, processQueue *processQueue, messageQueue *message.Queue,
+) {
+	q := cs.orderlyProcessQueue(messageQueue)
+	if q == nil || &q.processQueue != processQueue {
+		cs.logger.Warnf("submit consume request of removed message queue %s", messageQueue)
+		return
+	}
+
+	if q.startConsuming() {
+		cs.startConsume(q, messageQueue)
+	}
+}
+
+func (cs *consumeOrderlyService) startConsume(q *orderlyProcessQueue, mq *message.Queue) {
+	cs.wg.Add(1)
+	go func() {
+		cs.consume(q, mq)
+		cs.wg.Done()
+	}()
+}
+
+func (cs *consumeOrderlyService) submitConsumeRequestLater(
+	q *orderlyProcessQueue, mq *message.Queue, delay time.Duration,
+) {
+	cs.scheduler.scheduleFuncAfter(func() { cs.startConsume(q, mq) }, delay)
+}
+
+func (cs *consumeOrderlyService) tryLockLaterAndReconsume(
+	q *orderlyProcessQueue, mq *message.Queue, delay time.Duration,
+) {
+	cs.scheduler.scheduleFuncAfter(func() {
+		if cs.lockOne(mq) {
+			q.markLocked(time.Now())
+			cs.submitConsumeRequestLater(q, mq, time.Millisecond*10)
+			return
+		}
+		cs.submitConsumeRequestLater(q, mq, time.Second*3)
+	}, delay)
+}
+
+// isQueueLocked returns true if the queue is locked in the broker, or the message model is not clustering
+func (cs *consumeOrderlyService) isQueueLocked(mq *message.Queue) bool {
+	q := cs.orderlyProcessQueue(mq)
+	return q != nil && cs.isLocked(q)
+}
+
+func (cs *consumeOrderlyService) isLocked(q *orderlyProcessQueue) bool {
+	return cs.messageModel != Clustering || q.isLocked(cs.lockMaxLiveTime)
+}
+
+// consume consumes the messages of the queue until no message, only one goroutine runs it
+// for a queue at any time
+func (cs *consumeOrderlyService) consume(q *orderlyProcessQueue, mq *message.Queue) {
+	begin := time.Now()
+	for {
+		select {
+		case <-cs.exitChan:
+			return
+		default:
+		}
+
+		if q.isDropped() {
+			cs.logger.Infof("process queue is dropped:%s", mq)
+			return
+		}
+
+		if !cs.isLocked(q) {
+			cs.logger.Warnf("message queue %s is not locked or lock expired, consume it later", mq)
+			cs.tryLockLaterAndReconsume(q, mq, time.Millisecond*10)
+			return
+		}
+
+		if time.Since(begin) > cs.maxConsumeContinuouslyTime {
+			cs.submitConsumeRequestLater(q, mq, time.Millisecond*10)
+			return
+		}
+
+		msgs := q.takeMessages(cs.batchSize)
+		if len(msgs) == 0 {
+			return
+		}
+
+		cs.resetRetryTopic(msgs)
+		ctx := &OrderlyContext{MessageQueue: mq}
+
+		q.lockConsume()
+		if q.isDropped() {
+			q.unlockConsume()
+			cs.logger.Warnf("process queue is dropped without consuming. messageQueue=%v", mq)
+			return
+		}
+		consumeBegin := time.Now()
+		status := cs.consumer.Consume(msgs, ctx)
+		cs.stats.incConsumeRT(mq.Topic, time.Since(consumeBegin))
+		q.unlockConsume()
+
+		if !cs.processConsumeResult(msgs, status, ctx, q) {
+			return
+		}
+	}
+}
+
+// consumeMessageDirectly consumes the message out of the process queue, the result is not processed
+func (cs *consumeOrderlyService) consumeMessageDirectly(
+	m *message.MessageExt, broker string,
+) *rpc.ConsumeMessageDirectlyResult {
+	msgs := []*message.MessageExt{m}
+	cs.resetRetryTopic(msgs)
+	ctx := &OrderlyContext{
+		MessageQueue: &message.Queue{Topic: m.Topic, BrokerName: broker, QueueID: m.QueueID},
+	}
+
+	return consumeDirectly(func() string {
+		switch cs.consumer.Consume(msgs, ctx) {
+		case OrderlySuccess:
+			return rpc.ConsumeSuccess
+		case SuspendCurrentQueueAMoment:
+			return rpc.ConsumeLater
+		default:
+			return rpc.ConsumeReturnNull
+		}
+	}, true)
+}
+
+// processConsumeResult returns true if the consuming continues
+func (cs *consumeOrderlyService) processConsumeResult(
+	msgs []*message.MessageExt, status ConsumeOrderlyStatus, ctx *OrderlyContext,
+	q *orderlyProcessQueue,
+) bool {
+	switch status {
+	case OrderlySuccess:
+		cs.stats.incConsumeOKTPS(ctx.MessageQueue.Topic, len(msgs))
+		offset := q.commit()
+		if offset >= 0 && !q.isDropped() {
+			cs.offseter.UpdateOffsetIfGreater(ctx.MessageQueue, offset)
+		}
+		cs.removeReleasedQueue(ctx.MessageQueue, &q.processQueue)
+		return true
+	default:
+		cs.logger.Errorf("unknow consume orderly status:%d, suspend the queue %s a moment", status, ctx.MessageQueue)
+		fallthrough
+	case SuspendCurrentQueueAMoment:
+		cs.stats.incConsumeFailedTPS(ctx.MessageQueue.Topic, len(msgs))
+		for _, m := range msgs {
+			m.ReconsumeTimes++
+		}
+		q.makeMessagesToConsumeAgain(msgs)
+
+		suspendTime := ctx.SuspendTime
+		if suspendTime <= 0 {
+			suspendTime = cs.suspendTime
+		}
+		cs.submitConsumeRequestLater(q, ctx.MessageQueue, suspendTime)
+		return false
+	}
+}
+
+type orderlyProcessQueue struct {
+	processQueue
+
+	locked       int32
+	lastLockTime int64 // unix nano
+
+	consuming         bool          // guarded by the lock of processQueue
+	consumingMessages tree.LLRBTree // queue offset -> message, taken but not committed
+	consumeLock       chan struct{}
+}
+
+func newOrderlyProcessQueue() *orderlyProcessQueue {
+	return &orderlyProcessQueue{consumeLock: make(chan struct{}, 1)}
+}
+
+func (q *orderlyProcessQueue) markLocked(t time.Time) {
+	atomic.StoreInt64(&q.lastLockTime, t.UnixNano())
+	atomic.StoreInt32(&q.locked, 1)
+}
+
+func (q *orderlyProcessQueue) markUnlocked() {
+	atomic.StoreInt32(&q.locked, 0)
+}
+
+// isLocked returns true if the queue is locked, and the lock is not expired
+func (q *orderlyProcessQueue) isLocked(maxLiveTime time.Duration) bool {
+	if atomic.LoadInt32(&q.locked) == 0 {
+		return false
+	}
+	return time.Now().UnixNano()-atomic.LoadInt64(&q.lastLockTime) <= int64(maxLiveTime)
+}
+
+func (q *orderlyProcessQueue) lockConsume() {
+	q.consumeLock <- struct{}{}
+}
+
+func (q *orderlyProcessQueue) tryLockConsume(timeout time.Duration) bool {
+	select {
+	case q.consumeLock <- struct{}{}:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (q *orderlyProcessQueue) unlockConsume() {
+	<-q.consumeLock
+}
+
+// startConsuming returns true if there are messages and nobody is consuming
+func (q *orderlyProcessQueue) startConsuming() (ok bool) {
+	q.Lock()
+	if !q.consuming && q.messages.Size() > 0 {
+		q.consuming, ok = true, true
+	}
+	q.Unlock()
+	return
+}
+
+// takeMessages takes at most n messages to consume by the order of the queue offset
+// stops consuming if no message
+func (q *orderlyProcessQueue) takeMessages(n int) []*message.MessageExt {
+	msgs := make([]*message.MessageExt, 0, n)
+	q.Lock()
+	for i := 0; i < n && q.messages.Size() > 0; i++ {
+		k, v := q.messages.First()
+		q.messages.Remove(k)
+		q.consumingMessages.Put(k, v)
+		msgs = append(msgs, v.(*message.MessageExt))
+	}
+
+	if len(msgs) == 0 {
+		q.consuming = false
+	}
+	q.Unlock()
+	return msgs
+}
+
+// commit removes the consuming messages, returns the next offset to consume,
+// or -1 if no consuming message
+func (q *orderlyProcessQueue) commit() int64 {
+	q.Lock()
+	defer q.Unlock()
+
+	n := q.consumingMessages.Size()
+	if n == 0 {
+		return -1
+	}
+
+	k, _ := q.consumingMessages.Last()
+	size := int64(0)
+	for q.consumingMessages.Size() > 0 {
+		k, v := q.consumingMessages.First()
+		q.consumingMessages.Remove(k)
+		size += int64(len(v.(*message.MessageExt).Body))
+	}
+	atomic.AddInt32(&q.msgCount, -int32(n))
+	atomic.AddInt64(&q.msgSize, -size)
+	return int64(k.(offset)) + 1
+}
+
+// makeMessagesToConsumeAgain puts the consuming messages back
+func (q *orderlyProcessQueue) makeMessagesToConsumeAgain(msgs []*message.MessageExt) {
+	q.Lock()
+	for _, m := range msgs {
+		q.consumingMessages.Remove(offset(m.QueueOffset))
+		q.messages.Put(offset(m.QueueOffset), m)
+	}
+	q.Unlock()
+}
+
+func (q *orderlyProcessQueue) messageCount() int32 {
+	return atomic.LoadInt32(&q.msgCount)
+}
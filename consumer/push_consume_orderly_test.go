@@ -0,0 +1,398 @@
+package consumer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+)
+
+type mockOrderlyConsumer struct {
+	sync.Mutex
+	offsets []int64
+	rets    []ConsumeOrderlyStatus
+	done    chan struct{}
+}
+
+func (m *mockOrderlyConsumer) Consume(
+	msgs []*message.MessageExt, ctx *OrderlyContext,
+) ConsumeOrderlyStatus {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, msg := range msgs {
+		m.offsets = append(m.offsets, msg.QueueOffset)
+	}
+
+	ret := OrderlySuccess
+	if len(m.rets) > 0 {
+		ret, m.rets = m.rets[0], m.rets[1:]
+	}
+
+	if ret == SuspendCurrentQueueAMoment {
+		ctx.SuspendTime = time.Millisecond
+	}
+
+	m.done <- struct{}{}
+	return ret
+}
+
+func (m *mockOrderlyConsumer) reset(rets ...ConsumeOrderlyStatus) {
+	m.Lock()
+	m.offsets, m.rets = nil, rets
+	m.Unlock()
+}
+
+func (m *mockOrderlyConsumer) consumedOffsets() []int64 {
+	m.Lock()
+	defer m.Unlock()
+	return append([]int64(nil), m.offsets...)
+}
+
+type syncOffseter struct {
+	sync.Mutex
+	mockOffseter
+}
+
+func (o *syncOffseter) UpdateOffsetIfGreater(mq *message.Queue, offset int64) {
+	o.Lock()
+	o.mockOffseter.UpdateOffsetIfGreater(mq, offset)
+	o.Unlock()
+}
+
+func (o *syncOffseter) RemoveOffset(mq *message.Queue) (int64, bool) {
+	o.Lock()
+	defer o.Unlock()
+	return o.mockOffseter.RemoveOffset(mq)
+}
+
+func (o *syncOffseter) getOffset() int64 {
+	o.Lock()
+	defer o.Unlock()
+	return o.offset
+}
+
+type mockQueueLocker struct {
+	sync.Mutex
+	lockedQueues   []message.Queue
+	lockErr        error
+	unlockedQueues []message.Queue
+}
+
+func (m *mockQueueLocker) lockQueues(broker string, mqs []message.Queue) ([]message.Queue, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.lockErr != nil {
+		return nil, m.lockErr
+	}
+
+	var locked []message.Queue
+	for _, q := range mqs {
+		for _, q1 := range m.lockedQueues {
+			if q == q1 {
+				locked = append(locked, q)
+			}
+		}
+	}
+	return locked, nil
+}
+
+func (m *mockQueueLocker) unlockQueues(broker string, mqs []message.Queue) error {
+	m.Lock()
+	m.unlockedQueues = append(m.unlockedQueues, mqs...)
+	m.Unlock()
+	return nil
+}
+
+func newTestOrderlyService(
+	t *testing.T, consumer OrderlyConsumer, locker queueLocker,
+) *consumeOrderlyService {
+	cs, err := newConsumeOrderlyService(orderlyServiceConfig{
+		consumeServiceConfig: consumeServiceConfig{
+			group:           "test orderly consume service",
+			messageModel:    Clustering,
+			messageSendBack: &mockSendback{},
+			offseter:        &syncOffseter{},
+			logger:          &log.MockLogger{},
+		},
+		consumer:    consumer,
+		queueLocker: locker,
+		batchSize:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cs
+}
+
+func TestNewOrderlyService(t *testing.T) {
+	_, err := newConsumeOrderlyService(orderlyServiceConfig{})
+	assert.NotNil(t, err)
+
+	_, err = newConsumeOrderlyService(orderlyServiceConfig{consumer: &mockOrderlyConsumer{}})
+	assert.NotNil(t, err)
+
+	_, err = newConsumeOrderlyService(orderlyServiceConfig{
+		consumer: &mockOrderlyConsumer{}, queueLocker: &mockQueueLocker{},
+	})
+	assert.NotNil(t, err)
+
+	cs, err := newConsumeOrderlyService(orderlyServiceConfig{
+		consumeServiceConfig: consumeServiceConfig{
+			group:           "test orderly consume service",
+			messageSendBack: &mockSendback{},
+			offseter:        &mockOffseter{},
+			logger:          &log.MockLogger{},
+		},
+		consumer:    &mockOrderlyConsumer{},
+		queueLocker: &mockQueueLocker{},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cs.batchSize)
+	assert.Equal(t, defaultLockInterval, cs.lockInterval)
+	assert.Equal(t, defaultSuspendTime, cs.suspendTime)
+}
+
+func TestOrderlyProcessQueue(t *testing.T) {
+	q := newOrderlyProcessQueue()
+
+	// lock
+	assert.False(t, q.isLocked(time.Second))
+	q.markLocked(time.Now())
+	assert.True(t, q.isLocked(time.Second))
+	q.markLocked(time.Now().Add(-time.Second * 2))
+	assert.False(t, q.isLocked(time.Second))
+	q.markLocked(time.Now())
+	q.markUnlocked()
+	assert.False(t, q.isLocked(time.Second))
+
+	// consume lock
+	assert.True(t, q.tryLockConsume(time.Millisecond))
+	assert.False(t, q.tryLockConsume(time.Millisecond))
+	q.unlockConsume()
+	assert.True(t, q.tryLockConsume(time.Millisecond))
+	q.unlockConsume()
+
+	// take & commit
+	assert.False(t, q.startConsuming())
+	assert.Equal(t, int64(-1), q.commit())
+	q.putMessages([]*message.MessageExt{
+		{QueueOffset: 3, Message: message.Message{Body: []byte("3")}},
+		{QueueOffset: 1, Message: message.Message{Body: []byte("1")}},
+		{QueueOffset: 2, Message: message.Message{Body: []byte("2")}},
+	})
+	assert.Equal(t, int32(3), q.messageCount())
+	assert.True(t, q.startConsuming())
+	assert.False(t, q.startConsuming())
+
+	msgs := q.takeMessages(2)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, int64(1), msgs[0].QueueOffset)
+	assert.Equal(t, int64(2), msgs[1].QueueOffset)
+
+	q.makeMessagesToConsumeAgain(msgs)
+	msgs = q.takeMessages(2)
+	assert.Equal(t, int64(1), msgs[0].QueueOffset)
+	assert.Equal(t, int64(3), q.commit())
+	assert.Equal(t, int32(1), q.messageCount())
+	assert.Equal(t, int64(1), q.msgSize)
+
+	msgs = q.takeMessages(2)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, int64(4), q.commit())
+	assert.Equal(t, int32(0), q.messageCount())
+
+	// stop consuming
+	assert.Equal(t, 0, len(q.takeMessages(2)))
+	q.putMessages([]*message.MessageExt{{QueueOffset: 4}})
+	assert.True(t, q.startConsuming())
+}
+
+func TestConsumeOrderly(t *testing.T) {
+	consumer := &mockOrderlyConsumer{done: make(chan struct{}, 10)}
+	mq := &message.Queue{Topic: "orderly", BrokerName: "b", QueueID: 1}
+	locker := &mockQueueLocker{}
+	cs := newTestOrderlyService(t, consumer, locker)
+	offseter := cs.offseter.(*syncOffseter)
+
+	// lock failed
+	pq, ok := cs.insertNewMessageQueue(mq)
+	assert.False(t, ok)
+	assert.Nil(t, pq)
+
+	locker.lockedQueues = []message.Queue{*mq}
+	pq, ok = cs.insertNewMessageQueue(mq)
+	assert.True(t, ok)
+	_, ok = cs.insertNewMessageQueue(mq)
+	assert.False(t, ok)
+
+	wait := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case <-consumer.done:
+			case <-time.After(time.Second):
+				t.Fatal("consume timeout")
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// consume by the order
+	msgs := []*message.MessageExt{{QueueOffset: 2}, {QueueOffset: 0}, {QueueOffset: 1}}
+	pq.putMessages(msgs)
+	cs.submitConsumeRequest(msgs, pq, mq)
+	wait(2)
+	assert.Equal(t, []int64{0, 1, 2}, consumer.consumedOffsets())
+	assert.Equal(t, int64(3), offseter.getOffset())
+
+	// suspend
+	consumer.reset(SuspendCurrentQueueAMoment)
+	msgs = []*message.MessageExt{{QueueOffset: 3}}
+	pq.putMessages(msgs)
+	cs.submitConsumeRequest(msgs, pq, mq)
+	wait(2)
+	assert.Equal(t, []int64{3, 3}, consumer.consumedOffsets())
+	assert.Equal(t, int32(1), msgs[0].ReconsumeTimes)
+	assert.Equal(t, int64(4), offseter.getOffset())
+
+	// lock expired, relock then consume
+	consumer.reset()
+	cs.orderlyProcessQueue(mq).markUnlocked()
+	msgs = []*message.MessageExt{{QueueOffset: 4}}
+	pq.putMessages(msgs)
+	cs.submitConsumeRequest(msgs, pq, mq)
+	wait(1)
+	assert.Equal(t, []int64{4}, consumer.consumedOffsets())
+	assert.True(t, cs.orderlyProcessQueue(mq).isLocked(cs.lockMaxLiveTime))
+
+	// lock all
+	locker.lockErr = errors.New("bad lock")
+	cs.lockAll()
+	assert.True(t, cs.orderlyProcessQueue(mq).isLocked(cs.lockMaxLiveTime))
+	locker.lockErr, locker.lockedQueues = nil, nil
+	cs.lockAll()
+	assert.False(t, cs.orderlyProcessQueue(mq).isLocked(cs.lockMaxLiveTime))
+	locker.lockedQueues = []message.Queue{*mq}
+	cs.lockAll()
+	assert.True(t, cs.orderlyProcessQueue(mq).isLocked(cs.lockMaxLiveTime))
+
+	// remove
+	assert.True(t, cs.removeOldMessageQueue(mq))
+	assert.True(t, pq.isDropped())
+	assert.Equal(t, []message.Queue{*mq}, locker.unlockedQueues)
+	assert.False(t, cs.removeOldMessageQueue(mq))
+	cs.submitConsumeRequest(msgs, pq, mq)
+
+	cs.shutdown()
+}
+
+func TestConsumeOrderlyUnknownStatus(t *testing.T) {
+	consumer := &mockOrderlyConsumer{done: make(chan struct{}, 10)}
+	mq := &message.Queue{Topic: "orderly", BrokerName: "b", QueueID: 1}
+	cs := newTestOrderlyService(t, consumer, &mockQueueLocker{lockedQueues: []message.Queue{*mq}})
+	offseter := cs.offseter.(*syncOffseter)
+	cs.suspendTime = time.Millisecond
+
+	pq, ok := cs.insertNewMessageQueue(mq)
+	assert.True(t, ok)
+
+	// suspended, then consumed again
+	consumer.reset(ConsumeOrderlyStatus(100))
+	msgs := []*message.MessageExt{{QueueOffset: 0}}
+	pq.putMessages(msgs)
+	cs.submitConsumeRequest(msgs, pq, mq)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-consumer.done:
+		case <-time.After(time.Second):
+			t.Fatal("consume timeout")
+		}
+	}
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, []int64{0, 0}, consumer.consumedOffsets())
+	assert.Equal(t, int32(1), msgs[0].ReconsumeTimes)
+	assert.Equal(t, int64(1), offseter.getOffset())
+	assert.Equal(t, int32(0), pq.messageCount())
+
+	cs.shutdown()
+}
+
+func TestRemoveOrderlyQueueBeingConsumed(t *testing.T) {
+	mq := &message.Queue{Topic: "orderly", BrokerName: "b", QueueID: 1}
+	locker := &mockQueueLocker{lockedQueues: []message.Queue{*mq}}
+	cs := newTestOrderlyService(t, &mockOrderlyConsumer{}, locker)
+
+	cs.removeRetryDelay = time.Millisecond * 10
+
+	cs.insertNewMessageQueue(mq)
+	q := cs.orderlyProcessQueue(mq)
+	q.lockConsume()
+	assert.False(t, cs.removeOldMessageQueue(mq))
+	assert.True(t, q.isDropped())
+	assert.NotNil(t, cs.orderlyProcessQueue(mq))
+	q.unlockConsume()
+
+	// removed by retrying
+	time.Sleep(time.Millisecond * 100)
+	assert.Nil(t, cs.orderlyProcessQueue(mq))
+	assert.Equal(t, []message.Queue{*mq}, locker.unlockedQueues)
+
+	// the queue added again is not unlocked by the delayed unlocking
+	cs.unlockDelayTime, locker.unlockedQueues = time.Millisecond*10, nil
+	cs.insertNewMessageQueue(mq)
+	cs.orderlyProcessQueue(mq).putMessages([]*message.MessageExt{{}})
+	assert.True(t, cs.removeOldMessageQueue(mq))
+	cs.insertNewMessageQueue(mq)
+	time.Sleep(time.Millisecond * 100)
+	assert.Nil(t, locker.unlockedQueues)
+	assert.NotNil(t, cs.orderlyProcessQueue(mq))
+
+	cs.shutdown()
+}
+
+func TestIsOrderlyQueueLocked(t *testing.T) {
+	mq := &message.Queue{Topic: "orderly", BrokerName: "b", QueueID: 1}
+	locker := &mockQueueLocker{lockedQueues: []message.Queue{*mq}}
+	cs := newTestOrderlyService(t, &mockOrderlyConsumer{}, locker)
+	assert.False(t, cs.isQueueLocked(mq))
+
+	cs.insertNewMessageQueue(mq)
+	assert.True(t, cs.isQueueLocked(mq))
+
+	cs.orderlyProcessQueue(mq).markUnlocked()
+	assert.False(t, cs.isQueueLocked(mq))
+	cs.messageModel = BroadCasting
+	assert.True(t, cs.isQueueLocked(mq))
+}
+
+func TestConsumeOrderlyDirectly(t *testing.T) {
+	consumer := &mockOrderlyConsumer{done: make(chan struct{}, 2)}
+	cs, err := newConsumeOrderlyService(orderlyServiceConfig{
+		consumeServiceConfig: consumeServiceConfig{
+			group:           "test orderly consume directly",
+			messageSendBack: &mockSendback{},
+			offseter:        &mockOffseter{},
+			logger:          &log.MockLogger{},
+		},
+		consumer:    consumer,
+		queueLocker: &mockQueueLocker{},
+	})
+	assert.Nil(t, err)
+
+	m := &message.MessageExt{Message: message.Message{Topic: "direct"}, QueueOffset: 3}
+	consumer.reset(OrderlySuccess, SuspendCurrentQueueAMoment)
+	r := cs.consumeMessageDirectly(m, "b")
+	assert.Equal(t, rpc.ConsumeSuccess, r.ConsumeResult)
+	assert.True(t, r.Order)
+
+	r = cs.consumeMessageDirectly(m, "b")
+	assert.Equal(t, rpc.ConsumeLater, r.ConsumeResult)
+	assert.Equal(t, []int64{3, 3}, consumer.consumedOffsets())
+}
@@ -2,6 +2,7 @@ package consumer
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"sync"
 	"time"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 )
 
 const (
@@ -23,8 +25,9 @@ type consumeService struct {
 	group                  string
 	messageModel           Model
 	messageSendBack        messageSendBack
-	offseter               offseter
+	offseter               OffsetStore
 	oldMessageQueueRemover func(*message.Queue) bool
+	stats                  *statsManager
 
 	processQueues       sync.Map
 	pullExpiredInterval time.Duration
@@ -41,8 +44,9 @@ type consumeServiceConfig struct {
 	schedWorkerCount       int
 	messageModel           Model
 	messageSendBack        messageSendBack
-	offseter               offseter
+	offseter               OffsetStore
 	oldMessageQueueRemover func(*message.Queue) bool
+	stats                  *statsManager
 	logger                 log.Logger
 }
 
@@ -67,6 +71,10 @@ func newConsumeService(conf consumeServiceConfig) (*consumeService, error) {
 		conf.schedWorkerCount = 2
 	}
 
+	if conf.stats == nil {
+		conf.stats = newStatsManager(conf.group)
+	}
+
 	c := &consumeService{
 		group:                  conf.group,
 		messageModel:           conf.messageModel,
@@ -75,6 +83,7 @@ func newConsumeService(conf consumeServiceConfig) (*consumeService, error) {
 		offseter:               conf.offseter,
 		oldMessageQueueRemover: conf.oldMessageQueueRemover,
 		pullExpiredInterval:    defaultPullExpiredInterval,
+		stats:                  conf.stats,
 
 		exitChan: make(chan struct{}),
 		logger:   conf.logger,
@@ -133,20 +142,36 @@ func (cs *consumeService) messageQueues() (mqs []message.Queue) {
 	return
 }
 
+func (cs *consumeService) processQueue(mq *message.Queue) (*processQueue, bool) {
+	v, ok := cs.processQueues.Load(*mq)
+	if !ok {
+		return nil, false
+	}
+	return (*processQueue)(unsafe.Pointer(reflect.ValueOf(v).Pointer())), true
+}
+
 func (cs *consumeService) removeOldMessageQueue(mq *message.Queue) bool {
 	v, ok := cs.processQueues.Load(*mq)
 	if !ok {
 		return false
 	}
-	cs.offseter.persistOne(mq)
-	cs.offseter.removeOffset(mq)
+	cs.offseter.PersistOne(mq)
+	cs.offseter.RemoveOffset(mq)
 
 	pq := (*processQueue)(unsafe.Pointer(reflect.ValueOf(v).Pointer()))
 	pq.drop()
 	cs.processQueues.Delete(*mq)
+	cs.stats.removeLag(mq)
 	return true
 }
 
+// removeReleasedQueue removes the releasing queue at once after its pulled messages are consumed
+func (cs *consumeService) removeReleasedQueue(mq *message.Queue, pq *processQueue) {
+	if pq.finishRelease() && cs.oldMessageQueueRemover(mq) {
+		cs.logger.Infof("message queue %s released", mq)
+	}
+}
+
 func (cs *consumeService) dropExpiredProcessQueues() {
 	cs.processQueues.Range(func(k, v interface{}) bool {
 		pq := (*processQueue)(unsafe.Pointer(reflect.ValueOf(v).Pointer()))
@@ -161,3 +186,20 @@ func (cs *consumeService) dropExpiredProcessQueues() {
 		return true
 	})
 }
+
+// consumeDirectly runs the consuming function which returns the consume result,
+// the panic of it is returned as the exception
+func consumeDirectly(consume func() string, order bool) *rpc.ConsumeMessageDirectlyResult {
+	r := &rpc.ConsumeMessageDirectlyResult{Order: order, AutoCommit: true}
+	begin := time.Now()
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				r.ConsumeResult, r.Remark = rpc.ConsumeThrowException, fmt.Sprint(e)
+			}
+		}()
+		r.ConsumeResult = consume()
+	}()
+	r.SpentTimeMills = int64(time.Since(begin) / time.Millisecond)
+	return r
+}
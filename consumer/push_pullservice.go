@@ -3,6 +3,7 @@ package consumer
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
@@ -34,8 +35,6 @@ type pullService struct {
 	pullServiceConfig
 	queuesOfMessageQueue sync.Map
 
-	logger log.Logger
-
 	exitChan chan struct{}
 }
 
@@ -70,15 +69,30 @@ func (ps *pullService) submitRequestImmediately(r *pullRequest) {
 	}
 }
 
+func (ps *pullService) submitRequestLater(r *pullRequest, delay time.Duration) {
+	if delay <= 0 {
+		ps.submitRequestImmediately(r)
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		select {
+		case <-ps.exitChan:
+		default:
+			ps.submitRequestImmediately(r)
+		}
+	})
+}
+
 func (ps *pullService) getOrCreateRequestQueue(q *message.Queue) (chan *pullRequest, bool) {
 	key := q.HashKey()
 	qr, ok := ps.queuesOfMessageQueue.Load(key)
 	if ok {
-		return qr.(chan *pullRequest), true
+		return qr.(chan *pullRequest), false
 	}
 
-	qr, _ = ps.queuesOfMessageQueue.LoadOrStore(key, make(chan *pullRequest, 10))
-	return qr.(chan *pullRequest), false
+	qr, loaded := ps.queuesOfMessageQueue.LoadOrStore(key, make(chan *pullRequest, ps.requestBufferSize))
+	return qr.(chan *pullRequest), !loaded
 }
 
 func (ps *pullService) startPulling(q chan *pullRequest) {
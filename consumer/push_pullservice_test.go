@@ -1,7 +1,9 @@
 package consumer
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zjykzk/rocketmq-client-go/log"
@@ -9,10 +11,10 @@ import (
 )
 
 type mockMessagePuller struct {
-	runPull bool
+	pullCount int32
 }
 
-func (p *mockMessagePuller) pull(r *pullRequest) { p.runPull = true }
+func (p *mockMessagePuller) pull(r *pullRequest) { atomic.AddInt32(&p.pullCount, 1) }
 
 func TestNewPullService(t *testing.T) {
 	_, err := newPullService(pullServiceConfig{})
@@ -29,8 +31,9 @@ func TestNewPullService(t *testing.T) {
 }
 
 func TestPullService(t *testing.T) {
+	puller := &mockMessagePuller{}
 	ps, err := newPullService(pullServiceConfig{
-		messagePuller: &mockMessagePuller{},
+		messagePuller: puller,
 		logger:        log.MockLogger{},
 	})
 	if err != nil {
@@ -54,5 +57,11 @@ func TestPullService(t *testing.T) {
 	ps.submitRequestImmediately(r)
 	assert.Equal(t, 1, count())
 
+	ps.submitRequestLater(r, time.Millisecond)
+	for i := 0; i < 100 && atomic.LoadInt32(&puller.pullCount) < 3; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&puller.pullCount))
+
 	ps.shutdown()
 }
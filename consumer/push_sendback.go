@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/producer"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+)
+
+const (
+	maxReconsumeTimesWhenUnset  = 16
+	defaultDelayLevelWhenResend = 3
+	defaultSendBackTimeout      = 5 * time.Second
+)
+
+var (
+	errEmptyStoreHost           = errors.New("empty store host")
+	errNoRetrySender            = errors.New("no retry sender")
+	errSendBackWhenBroadcasting = errors.New("send back when broadcasting")
+)
+
+type retrySender interface {
+	SendSync(m *message.Message) (*producer.SendResult, error)
+}
+
+// innerProducer the producer sending the message to the retry topic
+// it is shared by the consumers with the same client id
+type innerProducer struct {
+	*producer.Producer
+	refCount int
+}
+
+var innerProducers = struct {
+	sync.Mutex
+	eles map[string]*innerProducer
+}{eles: make(map[string]*innerProducer)}
+
+func startInnerProducer(c *consumer) (*producer.Producer, error) {
+	innerProducers.Lock()
+	defer innerProducers.Unlock()
+
+	p, ok := innerProducers.eles[c.ClientID]
+	if !ok {
+		pr := producer.NewProducer(rocketmq.ClientInnerProducerGroup, c.NameServerAddrs, c.Logger)
+		pr.InstanceName, pr.UnitName = c.InstanceName, c.UnitName
+		if err := pr.Start(); err != nil {
+			return nil, err
+		}
+		p = &innerProducer{Producer: pr}
+		innerProducers.eles[c.ClientID] = p
+	}
+	p.refCount++
+	return p.Producer, nil
+}
+
+func shutdownInnerProducer(clientID string) {
+	innerProducers.Lock()
+	p, ok := innerProducers.eles[clientID]
+	if ok {
+		p.refCount--
+		if p.refCount <= 0 {
+			delete(innerProducers.eles, clientID)
+			p.Shutdown()
+		}
+	}
+	innerProducers.Unlock()
+}
+
+// SendBack sends the message to the broker, the message will be consumed again after the at
+// least time specified by the delayLevel
+// it resends the message to the retry topic if the broker failed to accept it
+func (pc *PushConsumer) SendBack(m *message.MessageExt, delayLevel int, broker string) error {
+	if pc.MessageModel == BroadCasting {
+		return errSendBackWhenBroadcasting
+	}
+
+	err := pc.sendBackToBroker(m, delayLevel, broker)
+	if err == nil {
+		return nil
+	}
+
+	pc.Logger.Errorf("send back message:%s error:%s, resend it to the retry topic", m.MsgID, err)
+	return pc.sendToRetryTopic(m, delayLevel)
+}
+
+func (pc *PushConsumer) sendBackToBroker(m *message.MessageExt, delayLevel int, broker string) error {
+	addr := ""
+	if broker != "" {
+		if r, err := pc.client.FindBrokerAddr(broker, rocketmq.MasterID, false); err == nil {
+			if !r.IsSlave {
+				addr = r.Addr
+			}
+		}
+	}
+
+	if addr == "" {
+		if len(m.StoreHost.Host) == 0 {
+			return errEmptyStoreHost
+		}
+		addr = m.StoreHost.String()
+	}
+
+	return pc.rpc.SendBack(addr, &rpc.SendBackHeader{
+		CommitOffset:      m.CommitLogOffset,
+		Group:             pc.GroupName,
+		DelayLevel:        int32(delayLevel),
+		MessageID:         m.MsgID,
+		Topic:             m.Topic,
+		IsUnitMode:        pc.IsUnitMode,
+		MaxReconsumeTimes: int32(pc.maxReconsumeTimes()),
+	}, defaultSendBackTimeout)
+}
+
+// sendToRetryTopic sends the message to the retry topic of the group
+// the broker puts the message into the DLQ when its reconsume times reaches the max reconsume times
+// so the message goes to the DLQ directly if the delay level is negative
+func (pc *PushConsumer) sendToRetryTopic(m *message.MessageExt, delayLevel int) error {
+	if pc.retrySender == nil {
+		return errNoRetrySender
+	}
+
+	nm := &message.Message{Topic: retryTopic(pc.GroupName), Body: m.Body, Flag: m.Flag}
+	for k, v := range m.Properties {
+		nm.PutProperty(k, v)
+	}
+
+	originID := m.GetProperty(message.PropertyOriginMessageID)
+	if originID == "" {
+		originID = m.MsgID
+	}
+	nm.PutProperty(message.PropertyOriginMessageID, originID)
+	nm.PutProperty(message.PropertyRetryTopic, m.Topic)
+
+	maxReconsumeTimes, reconsumeTimes := pc.maxReconsumeTimes(), int(m.ReconsumeTimes)+1
+	switch {
+	case delayLevel < 0:
+		reconsumeTimes = maxReconsumeTimes
+		nm.ClearProperty(message.PropertyDelayTimeLevel)
+	case delayLevel > 0:
+		nm.SetDelayTimeLevel(delayLevel)
+	default:
+		nm.SetDelayTimeLevel(defaultDelayLevelWhenResend + int(m.ReconsumeTimes))
+	}
+	nm.PutProperty(message.PropertyReconsumeTime, strconv.Itoa(reconsumeTimes))
+	nm.PutProperty(message.PropertyMaxReconsumeTimes, strconv.Itoa(maxReconsumeTimes))
+
+	_, err := pc.retrySender.SendSync(nm)
+	if err != nil {
+		pc.Logger.Errorf("send message:%s to the retry topic error:%s", m.MsgID, err)
+	}
+	return err
+}
+
+func (pc *PushConsumer) maxReconsumeTimes() int {
+	if pc.MaxReconsumeTimes == -1 {
+		return maxReconsumeTimesWhenUnset
+	}
+	return pc.MaxReconsumeTimes
+}
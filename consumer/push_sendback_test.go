@@ -0,0 +1,110 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/producer"
+)
+
+type mockRetrySender struct {
+	msgs []*message.Message
+	err  error
+}
+
+func (s *mockRetrySender) SendSync(m *message.Message) (*producer.SendResult, error) {
+	s.msgs = append(s.msgs, m)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &producer.SendResult{Status: producer.OK}, nil
+}
+
+func TestPushSendBack(t *testing.T) {
+	pc := newTestConcurrentConsumer()
+	rpc, mc, sender := &mockConsumerRPC{}, &mockMQClient{}, &mockRetrySender{}
+	pc.rpc, pc.client, pc.retrySender = rpc, mc, sender
+
+	m := &message.MessageExt{
+		Message: message.Message{
+			Topic:      "sendback",
+			Body:       []byte("sendback"),
+			Flag:       11,
+			Properties: map[string]string{message.PropertyTags: "tag"},
+		},
+		MsgID:           "msgid",
+		CommitLogOffset: 1024,
+		ReconsumeTimes:  2,
+		StoreHost:       message.Addr{Host: []byte{127, 0, 0, 1}, Port: 10911},
+	}
+
+	// to the store host, since the broker is not found
+	assert.Nil(t, pc.SendBack(m, 0, "b"))
+	assert.Equal(t, "127.0.0.1:10911", rpc.sendBackAddr)
+	h := rpc.sendBackHeader
+	assert.Equal(t, int64(1024), h.CommitOffset)
+	assert.Equal(t, pc.GroupName, h.Group)
+	assert.Equal(t, int32(0), h.DelayLevel)
+	assert.Equal(t, "msgid", h.MessageID)
+	assert.Equal(t, "sendback", h.Topic)
+	assert.Equal(t, int32(maxReconsumeTimesWhenUnset), h.MaxReconsumeTimes)
+	assert.Equal(t, 0, len(sender.msgs))
+
+	// slave broker
+	mc.brokderAddr = "slave"
+	assert.Nil(t, pc.SendBack(m, 2, "b"))
+	assert.Equal(t, "127.0.0.1:10911", rpc.sendBackAddr)
+	assert.Equal(t, int32(2), rpc.sendBackHeader.DelayLevel)
+
+	// max reconsume times
+	pc.MaxReconsumeTimes = 3
+	assert.Nil(t, pc.SendBack(m, 2, ""))
+	assert.Equal(t, int32(3), rpc.sendBackHeader.MaxReconsumeTimes)
+
+	// broker failed, resend to the retry topic
+	rpc.sendBackErr = errors.New("bad sendback")
+	assert.Nil(t, pc.SendBack(m, 0, ""))
+	assert.Equal(t, 1, len(sender.msgs))
+	nm := sender.msgs[0]
+	assert.Equal(t, rocketmq.RetryGroupTopicPrefix+pc.GroupName, nm.Topic)
+	assert.Equal(t, m.Body, nm.Body)
+	assert.Equal(t, m.Flag, nm.Flag)
+	assert.Equal(t, "tag", nm.GetTags())
+	assert.Equal(t, "msgid", nm.GetProperty(message.PropertyOriginMessageID))
+	assert.Equal(t, "sendback", nm.GetProperty(message.PropertyRetryTopic))
+	assert.Equal(t, "3", nm.GetProperty(message.PropertyReconsumeTime))
+	assert.Equal(t, "3", nm.GetProperty(message.PropertyMaxReconsumeTimes))
+	assert.Equal(t, defaultDelayLevelWhenResend+2, nm.GetDelayTimeLevel())
+	assert.Equal(t, 1, len(m.Properties))
+
+	// keep the origin message id, delay level specified by the user
+	m.PutProperty(message.PropertyOriginMessageID, "origin")
+	assert.Nil(t, pc.SendBack(m, 5, ""))
+	nm = sender.msgs[1]
+	assert.Equal(t, "origin", nm.GetProperty(message.PropertyOriginMessageID))
+	assert.Equal(t, 5, nm.GetDelayTimeLevel())
+
+	// to DLQ directly
+	m.SetDelayTimeLevel(4)
+	assert.Nil(t, pc.SendBack(m, -1, ""))
+	nm = sender.msgs[2]
+	assert.Equal(t, "3", nm.GetProperty(message.PropertyReconsumeTime))
+	assert.Equal(t, 0, nm.GetDelayTimeLevel())
+
+	// no store host
+	rpc.sendBackErr = nil
+	m.StoreHost = message.Addr{}
+	assert.Nil(t, pc.SendBack(m, 0, ""))
+	assert.Equal(t, 4, len(sender.msgs))
+
+	// retry failed
+	sender.err = errors.New("bad retry")
+	assert.Equal(t, sender.err, pc.SendBack(m, 0, ""))
+
+	pc.retrySender = nil
+	assert.Equal(t, errNoRetrySender, pc.SendBack(m, 0, ""))
+}
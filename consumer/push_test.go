@@ -2,6 +2,9 @@ package consumer
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
 	"github.com/zjykzk/rocketmq-client-go/remote"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 	"github.com/zjykzk/rocketmq-client-go/route"
 )
 
@@ -21,14 +25,29 @@ type mockConsumerService struct {
 
 	insertRet bool
 	pt        *processQueue
+	pqs       map[message.Queue]*processQueue
 
 	removeRet bool
+	onRemove  func(*message.Queue)
+
+	submittedMessages []*message.MessageExt
 }
 
+func (m *mockConsumerService) start()    {}
+func (m *mockConsumerService) shutdown() {}
+
 func (m *mockConsumerService) messageQueues() []message.Queue {
 	return m.queues
 }
 
+func (m *mockConsumerService) processQueue(mq *message.Queue) (*processQueue, bool) {
+	if m.pqs != nil {
+		pq, ok := m.pqs[*mq]
+		return pq, ok
+	}
+	return m.pt, m.pt != nil
+}
+
 func (m *mockConsumerService) removeOldMessageQueue(mq *message.Queue) bool {
 	nqs := make([]message.Queue, 0, len(m.queues))
 	for _, q := range m.queues {
@@ -37,6 +56,9 @@ func (m *mockConsumerService) removeOldMessageQueue(mq *message.Queue) bool {
 		}
 	}
 	m.queues = nqs
+	if m.onRemove != nil {
+		m.onRemove(mq)
+	}
 	return m.removeRet
 }
 
@@ -46,6 +68,18 @@ func (m *mockConsumerService) insertNewMessageQueue(mq *message.Queue) (*process
 	return m.pt, m.insertRet
 }
 
+func (m *mockConsumerService) submitConsumeRequest(
+	msgs []*message.MessageExt, pq *processQueue, mq *message.Queue,
+) {
+	m.submittedMessages = append(m.submittedMessages, msgs...)
+}
+
+func (m *mockConsumerService) consumeMessageDirectly(
+	msg *message.MessageExt, broker string,
+) *rpc.ConsumeMessageDirectlyResult {
+	return &rpc.ConsumeMessageDirectlyResult{ConsumeResult: rpc.ConsumeSuccess}
+}
+
 func newTestConcurrentConsumer() *PushConsumer {
 	pc, err := NewConcurrentConsumer(
 		"test push consumer", []string{"dummy"}, &mockConcurrentlyConsumer{}, &log.MockLogger{},
@@ -125,6 +159,96 @@ func TestUpdateProcessTable(t *testing.T) {
 	test(newMQs, newMQs, true)
 }
 
+func TestStickyUpdateProcessTable(t *testing.T) {
+	pc := newTestConcurrentConsumer()
+	pc.StickyReblance = true
+	q0, q1, q2 := message.Queue{}, message.Queue{QueueID: 1}, message.Queue{QueueID: 2}
+	pq0, pq1, pq2 := newProcessQueue(), newProcessQueue(), newProcessQueue()
+	mockConsumerService := &mockConsumerService{
+		queues:    []message.Queue{q0, q1, q2},
+		pqs:       map[message.Queue]*processQueue{q0: pq0, q1: pq1, q2: pq2},
+		removeRet: true,
+	}
+	pc.offseter, pc.consumerService = &mockOffseter{}, mockConsumerService
+
+	mmp := &mockMessagePuller{}
+	pc.pullService, _ = newPullService(pullServiceConfig{messagePuller: mmp, logger: pc.Logger})
+	defer pc.pullService.shutdown()
+
+	topic := "TestStickyUpdateProcessTable"
+	test := func(newMQs, expected []*message.Queue, expectedChanged bool) {
+		changed := pc.updateProcessTable(topic, newMQs)
+		assert.Equal(t, expectedChanged, changed)
+		assertMQs(t, expected, pc.consumerService.messageQueues())
+	}
+
+	// the queue without the pulled messages is removed at once
+	msg := &message.MessageExt{QueueOffset: 1}
+	pq0.putMessages([]*message.MessageExt{msg})
+	test([]*message.Queue{&q1}, []*message.Queue{&q0, &q1}, true)
+	assert.True(t, pq0.isReleasing())
+
+	// stop pulling the releasing queue
+	pc.pull(&pullRequest{processQueue: pq0, messageQueue: &q0})
+	assert.True(t, pq0.lastPullTime.IsZero())
+
+	// reassigned, continue pulling
+	test([]*message.Queue{&q0, &q1}, []*message.Queue{&q0, &q1}, true)
+	assert.False(t, pq0.isReleasing())
+	time.Sleep(pullTimeDelayWhenReleasing + time.Millisecond*100)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mmp.pullCount))
+
+	// released after consuming the pulled messages
+	test([]*message.Queue{&q1}, []*message.Queue{&q0, &q1}, false)
+	assert.True(t, pq0.isReleasing())
+	pq0.removeMessages([]*message.MessageExt{msg})
+	test([]*message.Queue{&q1}, []*message.Queue{&q1}, true)
+
+	// released when timeout
+	pq1.putMessages([]*message.MessageExt{msg})
+	test(nil, []*message.Queue{&q1}, false)
+	assert.True(t, pq1.isReleasing())
+	pq1.releaseTime = time.Now().Add(-releaseQueueTimeout).UnixNano()
+	test(nil, nil, true)
+}
+
+func TestPullLockedQueue(t *testing.T) {
+	pc := newTestConcurrentConsumer()
+	offseter := &mockOffseter{}
+	pc.offseter = offseter
+	mmp := &mockMessagePuller{}
+	pc.pullService, _ = newPullService(pullServiceConfig{messagePuller: mmp, logger: pc.Logger})
+	defer pc.pullService.shutdown()
+
+	r := &pullRequest{messageQueue: &message.Queue{}, processQueue: newProcessQueue(), nextOffset: 10}
+
+	// consuming concurrently
+	assert.True(t, pc.checkQueueLocked(r))
+	assert.False(t, r.isLockedFirst)
+
+	// not locked
+	locked := false
+	pc.isQueueLocked = func(*message.Queue) bool { return locked }
+	assert.False(t, pc.checkQueueLocked(r))
+	assert.Equal(t, int64(10), r.nextOffset)
+
+	// read the offset from the store failed
+	locked, offseter.readOffsetErr = true, errors.New("mock read offset error")
+	assert.False(t, pc.checkQueueLocked(r))
+	assert.False(t, r.isLockedFirst)
+	offseter.readOffsetErr = nil
+
+	// read the offset from the store at the first time
+	offseter.offset = 5
+	assert.True(t, pc.checkQueueLocked(r))
+	assert.True(t, r.isLockedFirst)
+	assert.Equal(t, int64(5), r.nextOffset)
+
+	offseter.offset = 7
+	assert.True(t, pc.checkQueueLocked(r))
+	assert.Equal(t, int64(5), r.nextOffset)
+}
+
 func assertMQs(t *testing.T, mqs1 []*message.Queue, mqs2 []message.Queue) {
 	assert.Equal(t, len(mqs1), len(mqs2))
 	for _, mq1 := range mqs1 {
@@ -223,7 +347,7 @@ func TestComputeFromLastOffset(t *testing.T) {
 	assert.Equal(t, int64(2), offset)
 
 	// from remote
-	mockOffseter.readOffsetErr = errOffsetNotExist
+	mockOffseter.readOffsetErr = ErrOffsetNotExist
 	mockRPC.maxOffset = 22
 	offset, err = pc.computeWhereToPull(q)
 	assert.Nil(t, err)
@@ -236,7 +360,7 @@ func TestComputeFromLastOffset(t *testing.T) {
 
 	// retry topic
 	q.Topic = rocketmq.RetryGroupTopicPrefix + "t"
-	mockOffseter.readOffsetErr = errOffsetNotExist
+	mockOffseter.readOffsetErr = ErrOffsetNotExist
 	offset, err = pc.computeWhereToPull(q)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(0), offset)
@@ -272,7 +396,7 @@ func TestComputeFromFirstOffset(t *testing.T) {
 	assert.Equal(t, int64(2), offset)
 
 	// not exist
-	mockOffseter.readOffsetErr = errOffsetNotExist
+	mockOffseter.readOffsetErr = ErrOffsetNotExist
 	offset, err = pc.computeFromFirstOffset(q)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(0), offset)
@@ -308,7 +432,7 @@ func TestComputeFromTimestamp(t *testing.T) {
 	// not exist and retry topic
 	mockRPC.maxOffset = 100
 	q.Topic = rocketmq.RetryGroupTopicPrefix
-	mockOffseter.readOffsetErr = errOffsetNotExist
+	mockOffseter.readOffsetErr = ErrOffsetNotExist
 	offset, err = pc.computeFromTimestamp(q)
 	assert.Nil(t, err)
 	assert.Equal(t, int64(100), offset)
@@ -326,3 +450,191 @@ func TestComputeFromTimestamp(t *testing.T) {
 	assert.Equal(t, mockRPC.searchOffsetByTimestampErr, err)
 	mockRPC.searchOffsetByTimestampErr = nil
 }
+
+func TestPushFilterMessagesByTags(t *testing.T) {
+	pc := newTestConcurrentConsumer()
+	consumerService, offseter := &mockConsumerService{}, &mockOffseter{}
+	pc.consumerService, pc.offseter = consumerService, offseter
+	pc.subscribeData = client.NewDataTable()
+	pc.brokerSuggester.table = make(map[string]int32)
+	pc.pullService, _ = newPullService(pullServiceConfig{
+		messagePuller: &mockMessagePuller{},
+		logger:        pc.Logger,
+	})
+	defer pc.pullService.shutdown()
+
+	topic := "TestPushFilterMessagesByTags"
+	assert.Nil(t, pc.SubscribeWithSelector(topic, ByTag("t1")))
+	data := pc.subscribeData.Get(topic)
+
+	newMessage := func(offset int64, tag string) *message.MessageExt {
+		m := &message.MessageExt{Message: message.Message{Topic: topic}, QueueOffset: offset}
+		if tag != "" {
+			m.SetTags(tag)
+		}
+		return m
+	}
+
+	r := &pullRequest{messageQueue: &message.Queue{Topic: topic}, processQueue: newProcessQueue()}
+	pc.processPullResponse(r, data, &rpc.PullResponse{
+		Code:            rpc.Success,
+		NextBeginOffset: 3,
+		Messages:        []*message.MessageExt{newMessage(0, "t1"), newMessage(1, "t2"), newMessage(2, "")},
+	})
+	assert.Equal(t, int64(3), r.nextOffset)
+	assert.Equal(t, 1, len(consumerService.submittedMessages))
+	assert.Equal(t, "t1", consumerService.submittedMessages[0].GetTags())
+	assert.Equal(t, int32(1), r.processQueue.messageCount())
+	assert.Equal(t, int64(2), pc.FilteredMessageCount())
+	assert.False(t, offseter.runUpdate)
+
+	// all filtered, the offset is advanced
+	r = &pullRequest{messageQueue: &message.Queue{Topic: topic, QueueID: 1}, processQueue: newProcessQueue()}
+	pc.processPullResponse(r, data, &rpc.PullResponse{
+		Code:            rpc.Success,
+		NextBeginOffset: 4,
+		Messages:        []*message.MessageExt{newMessage(3, "t2")},
+	})
+	assert.Equal(t, int64(4), r.nextOffset)
+	assert.Equal(t, 1, len(consumerService.submittedMessages))
+	assert.True(t, offseter.runUpdate)
+	assert.Equal(t, int64(4), offseter.offset)
+	assert.Equal(t, "3", pc.RunningInfo().Properties["filteredMessageCount"])
+
+	// subscribe all
+	pc.Subscribe(topic + "all")
+	pc.processPullResponse(r, pc.subscribeData.Get(topic+"all"), &rpc.PullResponse{
+		Code:            rpc.Success,
+		NextBeginOffset: 6,
+		Messages:        []*message.MessageExt{newMessage(4, "t2"), newMessage(5, "")},
+	})
+	assert.Equal(t, 3, len(consumerService.submittedMessages))
+	assert.Equal(t, int64(3), pc.FilteredMessageCount())
+
+	// the pull tps counts the matched messages
+	statuses := pc.RunningInfo().Statuses
+	assert.Equal(t, 2, len(statuses))
+	assert.True(t, statuses[topic].PullTPS > 0)
+	assert.Equal(t, float64(0), statuses[topic+"all"].PullTPS)
+	assert.Equal(t, 1, len(pc.ConsumeStatuses()))
+}
+
+func TestPushBroadcasting(t *testing.T) {
+	root, err := ioutil.TempDir("", "broadcasting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	pc := newTestConcurrentConsumer()
+	pc.MessageModel = BroadCasting
+	pc.offseter, err = newLocalStore(localStoreConfig{rootPath: root, clientID: "a", group: pc.GroupName})
+	assert.Nil(t, err)
+
+	consumerService := &mockConsumerService{insertRet: true, pt: newProcessQueue()}
+	pc.consumerService = consumerService
+	pc.client = &mockMQClient{brokderAddr: "mock"}
+	pc.rpc = &mockConsumerRPC{clientIDs: []string{"a", "b"}, maxOffset: 10}
+	pc.pullService, _ = newPullService(pullServiceConfig{
+		messagePuller: &mockMessagePuller{},
+		logger:        pc.Logger,
+	})
+	defer pc.pullService.shutdown()
+
+	topic := "TestPushBroadcasting"
+	pc.subscribeData = client.NewDataTable()
+	pc.subscribeQueues = client.NewQueueTable()
+	pc.topicRouters = route.NewTopicRouterTable()
+	pc.Subscribe(topic)
+	qs := []*message.Queue{{Topic: topic}, {Topic: topic, QueueID: 1}}
+	pc.subscribeQueues.Put(topic, qs)
+
+	// all the queues
+	pc.reblance(topic)
+	assertMQs(t, qs, consumerService.messageQueues())
+
+	// offset from the local store
+	offset, err := pc.computeWhereToPull(qs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), offset)
+
+	pc.offseter.UpdateOffsetIfGreater(qs[0], 5)
+	assert.Nil(t, pc.offseter.Persist())
+	pc.offseter, _ = newLocalStore(localStoreConfig{rootPath: root, clientID: "a", group: pc.GroupName})
+	assert.Nil(t, pc.offseter.Load())
+	offset, err = pc.computeWhereToPull(qs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), offset)
+
+	// no send back
+	assert.Equal(t, errSendBackWhenBroadcasting, pc.SendBack(&message.MessageExt{}, 0, ""))
+
+	assert.Equal(t, "BROADCASTING", pc.RunningInfo().Properties["messageModel"])
+}
+
+func TestPushResetOffset(t *testing.T) {
+	pc := newTestConcurrentConsumer()
+	topic := "TestPushResetOffset"
+	q0, q1 := message.Queue{Topic: topic}, message.Queue{Topic: topic, QueueID: 1}
+	consumerService := &mockConsumerService{
+		queues:    []message.Queue{q0, q1},
+		removeRet: true,
+		insertRet: true,
+		pt:        newProcessQueue(),
+	}
+	puller := &mockMessagePuller{}
+	pc.consumerService, pc.offseter = consumerService, NewMemoryOffsetStore()
+	pc.pullService, _ = newPullService(pullServiceConfig{messagePuller: puller, logger: pc.Logger})
+	defer pc.pullService.shutdown()
+	pc.subscribeQueues = client.NewQueueTable()
+	pc.subscribeQueues.Put(topic, []*message.Queue{&q0, &q1})
+
+	pc.offseter.UpdateOffsetIfGreater(&q0, 10)
+	pc.offseter.UpdateOffsetIfGreater(&q1, 20)
+	assert.Equal(t, map[message.Queue]int64{q0: 10, q1: 20}, pc.ConsumeOffsets(topic))
+	assert.Equal(t, 0, len(pc.ConsumeOffsets("not exist")))
+
+	// reset to the smaller one
+	pc.ResetOffset(topic, map[message.Queue]int64{q0: 5, {Topic: "other"}: 1})
+	assert.Equal(t, map[message.Queue]int64{q0: 5, q1: 20}, pc.ConsumeOffsets(topic))
+	assertMQs(t, []*message.Queue{&q0, &q1}, consumerService.messageQueues())
+	for atomic.LoadInt32(&puller.pullCount) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the response of the dropped queue is ignored
+	pq := newProcessQueue()
+	pq.drop()
+	pc.processPullResponse(
+		&pullRequest{messageQueue: &q1, processQueue: pq, nextOffset: 20},
+		&client.Data{Topic: topic, Expr: "*"},
+		&rpc.PullResponse{Code: rpc.PullNotFound, NextBeginOffset: 30},
+	)
+	assert.Equal(t, int64(20), pc.ConsumeOffsets(topic)[q1])
+
+	// the offset updated by the consuming messages before dropping the queue is overwritten
+	consumerService.onRemove = func(mq *message.Queue) { pc.offseter.UpdateOffsetIfGreater(mq, 100) }
+	pc.ResetOffset(topic, map[message.Queue]int64{q0: 3})
+	assert.Equal(t, int64(3), pc.ConsumeOffsets(topic)[q0])
+	for atomic.LoadInt32(&puller.pullCount) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	consumerService.onRemove = nil
+
+	// remove failed
+	consumerService.removeRet = false
+	pc.ResetOffset(topic, map[message.Queue]int64{q1: 1})
+	assert.Equal(t, map[message.Queue]int64{q0: 3, q1: 1}, pc.ConsumeOffsets(topic))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&puller.pullCount))
+}
+
+func TestPushConsumeMessageDirectly(t *testing.T) {
+	pc := newTestConcurrentConsumer()
+	pc.consumerService = &mockConsumerService{}
+	r, err := pc.ConsumeMessageDirectly(&message.MessageExt{}, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, rpc.ConsumeSuccess, r.ConsumeResult)
+
+	_, err = NewPullConsumer("g", []string{"dummy"}, &log.MockLogger{}).ConsumeMessageDirectly(nil, "b")
+	assert.Equal(t, errConsumeDirectlyNotSupported, err)
+}
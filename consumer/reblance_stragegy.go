@@ -1,11 +1,23 @@
 package consumer
 
 import (
+	"crypto/md5"
+	"encoding/binary"
 	"errors"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/zjykzk/rocketmq-client-go/message"
 )
 
+// QueueAssigner assigns the queues to the clients of the group, the clients & queues are sorted
+// it returns the queues of the current client
+type QueueAssigner interface {
+	Assign(group, clientID string, clientIDs []string, qs []*message.Queue) ([]*message.Queue, error)
+	Name() string
+}
+
 // Averagely reblance average
 type Averagely struct{}
 
@@ -13,6 +25,9 @@ var errEmptyCurrentClientID = errors.New("empty current client id")
 var errEmptyClientIDs = errors.New("empty client ids")
 var errEmptyQueues = errors.New("empty queues")
 var errNotFoundCurrentClientID = errors.New("not found current id")
+var errEmptyMachineRoom = errors.New("empty machine room")
+var errEmptyMachineRoomResolver = errors.New("empty machine room resolver")
+var errEmptyAssigner = errors.New("empty assigner")
 
 func clientIndex(clientID string, clientIDs []string) int {
 	for i, c := range clientIDs {
@@ -27,27 +42,18 @@ func clientIndex(clientID string, clientIDs []string) int {
 func (a *Averagely) Assign(group, curClientID string, clientIDs []string, queues []*message.Queue) (
 	[]*message.Queue, error,
 ) {
-	if curClientID == "" {
-		return nil, errEmptyCurrentClientID
-	}
-
-	if len(clientIDs) == 0 {
-		return nil, errEmptyClientIDs
-	}
-
-	if len(queues) == 0 {
-		return nil, errEmptyQueues
-	}
-
-	idx := clientIndex(curClientID, clientIDs)
-	if -1 == idx {
-		return nil, errNotFoundCurrentClientID
+	idx, err := checkAssign(curClientID, clientIDs, queues)
+	if err != nil {
+		return nil, err
 	}
 
 	queueCount, clientCount := len(queues), len(clientIDs)
 
+	// the same as the java client, no queue is assigned to the client out of the queues
 	if clientCount >= queueCount {
-		idx %= queueCount
+		if idx >= queueCount {
+			return nil, nil
+		}
 		return queues[idx : idx+1], nil
 	}
 
@@ -65,5 +71,445 @@ func (a *Averagely) Assign(group, curClientID string, clientIDs []string, queues
 
 // Name return reblance's name
 func (a *Averagely) Name() string {
-	return "AVERAGE"
+	return "AVG"
+}
+
+// checkAssign checks the arguments of the assigning, returns the index of the current client
+func checkAssign(curClientID string, clientIDs []string, queues []*message.Queue) (int, error) {
+	if curClientID == "" {
+		return -1, errEmptyCurrentClientID
+	}
+
+	if len(clientIDs) == 0 {
+		return -1, errEmptyClientIDs
+	}
+
+	if len(queues) == 0 {
+		return -1, errEmptyQueues
+	}
+
+	idx := clientIndex(curClientID, clientIDs)
+	if -1 == idx {
+		return -1, errNotFoundCurrentClientID
+	}
+	return idx, nil
+}
+
+// AveragelyByCircle assigns the queues to the clients one by one, like dealing the cards
+type AveragelyByCircle struct{}
+
+// Assign assign by circle
+func (a *AveragelyByCircle) Assign(
+	group, curClientID string, clientIDs []string, queues []*message.Queue,
+) (
+	[]*message.Queue, error,
+) {
+	idx, err := checkAssign(curClientID, clientIDs, queues)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*message.Queue
+	for i := idx; i < len(queues); i += len(clientIDs) {
+		r = append(r, queues[i])
+	}
+	return r, nil
+}
+
+// Name return reblance's name
+func (a *AveragelyByCircle) Name() string {
+	return "AVG_BY_CIRCLE"
+}
+
+const defaultVirtualNodeCount = 10
+
+// ConsistentHash assigns the queue to the client whose virtual node is the first one
+// not less than the hash of the queue on the hash ring
+// the hash function & the key of the node are the same as the java client
+type ConsistentHash struct {
+	VirtualNodeCount int // defaultVirtualNodeCount if it's not positive
+}
+
+type virtualNode struct {
+	hash     int64
+	clientID string
+}
+
+// Assign assign by the consistent hash
+func (a *ConsistentHash) Assign(
+	group, curClientID string, clientIDs []string, queues []*message.Queue,
+) (
+	[]*message.Queue, error,
+) {
+	if _, err := checkAssign(curClientID, clientIDs, queues); err != nil {
+		return nil, err
+	}
+
+	ring := a.buildRing(clientIDs)
+	var r []*message.Queue
+	for _, q := range queues {
+		h := md5Hash(javaQueueKey(q))
+		i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		if i == len(ring) {
+			i = 0
+		}
+		if ring[i].clientID == curClientID {
+			r = append(r, q)
+		}
+	}
+	return r, nil
+}
+
+// buildRing returns the virtual nodes sorted by the hash,
+// the later node overwrites the former one with the same hash like the java client
+func (a *ConsistentHash) buildRing(clientIDs []string) []virtualNode {
+	count := a.VirtualNodeCount
+	if count <= 0 {
+		count = defaultVirtualNodeCount
+	}
+
+	nodes := make(map[int64]string, len(clientIDs)*count)
+	for _, c := range clientIDs {
+		for i := 0; i < count; i++ {
+			nodes[md5Hash(c+"-"+strconv.Itoa(i))] = c
+		}
+	}
+
+	ring := make([]virtualNode, 0, len(nodes))
+	for h, c := range nodes {
+		ring = append(ring, virtualNode{hash: h, clientID: c})
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+// Name return reblance's name
+func (a *ConsistentHash) Name() string {
+	return "CONSISTENT_HASH"
+}
+
+// md5Hash returns the first 4 bytes of the md5 digest as the unsigned integer
+func md5Hash(key string) int64 {
+	d := md5.Sum([]byte(key))
+	return int64(d[0])<<24 | int64(d[1])<<16 | int64(d[2])<<8 | int64(d[3])
+}
+
+// javaQueueKey returns the string of the queue in the java client
+func javaQueueKey(q *message.Queue) string {
+	return "MessageQueue [topic=" + q.Topic +
+		", brokerName=" + q.BrokerName +
+		", queueId=" + strconv.Itoa(int(q.QueueID)) + "]"
+}
+
+// ByConfig assigns the configured queues to the client, regardless of the other clients
+type ByConfig struct {
+	Queues []*message.Queue
+}
+
+// Assign assign by the configuration
+func (a *ByConfig) Assign(group, curClientID string, clientIDs []string, queues []*message.Queue) (
+	[]*message.Queue, error,
+) {
+	return a.Queues, nil
+}
+
+// Name return reblance's name
+func (a *ByConfig) Name() string {
+	return "CONFIG"
+}
+
+// ByMachineRoom assigns the queues of the brokers in the consuming machine rooms averagely,
+// the broker name is formatted as "machine room@broker name"
+type ByMachineRoom struct {
+	ConsumeIDCs []string
+}
+
+// Assign assign by the machine room
+func (a *ByMachineRoom) Assign(
+	group, curClientID string, clientIDs []string, queues []*message.Queue,
+) (
+	[]*message.Queue, error,
+) {
+	idx, err := checkAssign(curClientID, clientIDs, queues)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*message.Queue
+	for _, q := range queues {
+		rs := strings.Split(q.BrokerName, "@")
+		if len(rs) == 2 && a.consumeIn(rs[0]) {
+			candidates = append(candidates, q)
+		}
+	}
+
+	clientCount := len(clientIDs)
+	size, rem := len(candidates)/clientCount, len(candidates)%clientCount
+	start := size * idx
+
+	r := make([]*message.Queue, 0, size+1)
+	r = append(r, candidates[start:start+size]...)
+	if rem > idx {
+		r = append(r, candidates[idx+size*clientCount])
+	}
+	return r, nil
+}
+
+func (a *ByMachineRoom) consumeIn(idc string) bool {
+	for _, c := range a.ConsumeIDCs {
+		if c == idc {
+			return true
+		}
+	}
+	return false
+}
+
+// Name return reblance's name
+func (a *ByMachineRoom) Name() string {
+	return "MACHINE_ROOM"
+}
+
+// MachineRoomResolver resolves the machine room of the broker & the client
+type MachineRoomResolver interface {
+	BrokerDeployIn(q *message.Queue) string
+	ConsumerDeployIn(clientID string) string
+}
+
+// MachineRoomNearby assigns the queues to the clients in the same machine room with the assigner,
+// the queues of the machine room without any client are assigned to all the clients
+type MachineRoomNearby struct {
+	Assigner QueueAssigner
+	Resolver MachineRoomResolver
+}
+
+// Assign assign the nearby queues
+func (a *MachineRoomNearby) Assign(
+	group, curClientID string, clientIDs []string, queues []*message.Queue,
+) (
+	[]*message.Queue, error,
+) {
+	if a.Assigner == nil {
+		return nil, errEmptyAssigner
+	}
+
+	if a.Resolver == nil {
+		return nil, errEmptyMachineRoomResolver
+	}
+
+	if _, err := checkAssign(curClientID, clientIDs, queues); err != nil {
+		return nil, err
+	}
+
+	roomQueues := make(map[string][]*message.Queue)
+	for _, q := range queues {
+		room := a.Resolver.BrokerDeployIn(q)
+		if room == "" {
+			return nil, errEmptyMachineRoom
+		}
+		roomQueues[room] = append(roomQueues[room], q)
+	}
+
+	roomClients := make(map[string][]string)
+	for _, c := range clientIDs {
+		room := a.Resolver.ConsumerDeployIn(c)
+		if room == "" {
+			return nil, errEmptyMachineRoom
+		}
+		roomClients[room] = append(roomClients[room], c)
+	}
+
+	curRoom := a.Resolver.ConsumerDeployIn(curClientID)
+	r, err := a.assign(group, curClientID, roomClients[curRoom], roomQueues[curRoom])
+	if err != nil {
+		return nil, err
+	}
+	delete(roomQueues, curRoom)
+
+	rooms := make([]string, 0, len(roomQueues))
+	for room := range roomQueues {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	for _, room := range rooms {
+		if _, ok := roomClients[room]; ok {
+			continue
+		}
+
+		qs, err := a.assign(group, curClientID, clientIDs, roomQueues[room])
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, qs...)
+	}
+	return r, nil
+}
+
+func (a *MachineRoomNearby) assign(
+	group, curClientID string, clientIDs []string, queues []*message.Queue,
+) (
+	[]*message.Queue, error,
+) {
+	if len(queues) == 0 {
+		return nil, nil
+	}
+	return a.Assigner.Assign(group, curClientID, clientIDs, queues)
+}
+
+// Name return reblance's name
+func (a *MachineRoomNearby) Name() string {
+	if a.Assigner == nil {
+		return "MACHINE_ROOM_NEARBY-"
+	}
+	return "MACHINE_ROOM_NEARBY-" + a.Assigner.Name()
+}
+
+// QueueLocker locks the queues in the broker for the client, returns the locked ones, the queue locked
+// by the other client cannot be locked until the other one unlocks it, or the lock expires
+type QueueLocker func(qs []*message.Queue) []*message.Queue
+
+// StickyQueueAssigner assigns the queues with the ones held by the client, the owner of the queue is
+// the client locking it in the broker, which is read by all the clients
+type StickyQueueAssigner interface {
+	QueueAssigner
+	AssignSticky(curClientID string, clientIDs []string, queues, held []*message.Queue, lock QueueLocker) (
+		[]*message.Queue, error,
+	)
+}
+
+// Sticky assigns the queues evenly, and keeps the queues with their current owners when the clients
+// or the queues change, so that the moved queues are the minimum
+//
+// the quota of each client is decided by the hash of the client, the client keeps its queues locked
+// in the broker up to the quota, and locks the others preferring the higher hash of the queue & client
+// until reaching the quota. without the locks, it assigns by the hash only
+type Sticky struct{}
+
+// Assign assigns by the hash, since the current owners are unknown
+func (a *Sticky) Assign(group, curClientID string, clientIDs []string, queues []*message.Queue) (
+	[]*message.Queue, error,
+) {
+	if _, err := checkAssign(curClientID, clientIDs, queues); err != nil {
+		return nil, err
+	}
+
+	owners := stickyAssign(clientIDs, queues)
+	var r []*message.Queue
+	for _, q := range queues {
+		if owners[*q] == curClientID {
+			r = append(r, q)
+		}
+	}
+	return r, nil
+}
+
+// AssignSticky keeps the held queues which are still locked up to the quota, then locks the others
+func (a *Sticky) AssignSticky(
+	curClientID string, clientIDs []string, queues, held []*message.Queue, lock QueueLocker,
+) (
+	[]*message.Queue, error,
+) {
+	idx, err := checkAssign(curClientID, clientIDs, queues)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[message.Queue]int, len(queues))
+	for i, q := range queues {
+		index[*q] = i
+	}
+	hash := func(q *message.Queue) uint64 { return stickyHash(curClientID + "@" + q.HashKey()) }
+	byHash := func(qs []*message.Queue) {
+		sort.Slice(qs, func(i, j int) bool { return hash(qs[i]) > hash(qs[j]) })
+	}
+
+	isHeld := make(map[message.Queue]bool, len(held))
+	var kept []*message.Queue
+	for _, q := range held {
+		if i, ok := index[*q]; ok && !isHeld[*q] {
+			isHeld[*q] = true
+			kept = append(kept, queues[i])
+		}
+	}
+
+	quota := stickyQuotas(clientIDs, queues)[idx]
+	if len(kept) > 0 {
+		kept = lock(kept)
+	}
+	byHash(kept)
+	if len(kept) > quota {
+		kept = kept[:quota]
+	}
+
+	var candidates []*message.Queue
+	for _, q := range queues {
+		if !isHeld[*q] {
+			candidates = append(candidates, q)
+		}
+	}
+	byHash(candidates)
+
+	r := kept
+	for need := quota - len(r); need > 0 && len(candidates) > 0; need = quota - len(r) {
+		if need > len(candidates) {
+			need = len(candidates)
+		}
+		r = append(r, lock(candidates[:need])...)
+		candidates = candidates[need:]
+	}
+
+	sort.Slice(r, func(i, j int) bool { return index[*r[i]] < index[*r[j]] })
+	return r, nil
+}
+
+// stickyQuotas returns the count of the queues of each client,
+// the clients with the higher hash take the ceil when the queues cannot be divided evenly
+func stickyQuotas(clientIDs []string, queues []*message.Queue) []int {
+	order := make([]int, len(clientIDs))
+	hashes := make([]uint64, len(clientIDs))
+	for i, c := range clientIDs {
+		order[i], hashes[i] = i, stickyHash(c+"@"+queues[0].Topic)
+	}
+	sort.Slice(order, func(i, j int) bool { return hashes[order[i]] > hashes[order[j]] })
+
+	base, extra := len(queues)/len(clientIDs), len(queues)%len(clientIDs)
+	quotas := make([]int, len(clientIDs))
+	for rank, ci := range order {
+		quotas[ci] = base
+		if rank < extra {
+			quotas[ci]++
+		}
+	}
+	return quotas
+}
+
+// stickyAssign returns the owners of the queues, the queue prefers the client with the higher hash
+// of the queue & client, whose count of the queues is less than the quota
+func stickyAssign(clientIDs []string, queues []*message.Queue) map[message.Queue]string {
+	quotas := stickyQuotas(clientIDs, queues)
+	r, counts := make(map[message.Queue]string, len(queues)), make([]int, len(clientIDs))
+	for _, q := range queues {
+		owner, ownerHash := -1, uint64(0)
+		for ci, c := range clientIDs {
+			if counts[ci] >= quotas[ci] {
+				continue
+			}
+			if h := stickyHash(c + "@" + q.HashKey()); owner == -1 || h > ownerHash {
+				owner, ownerHash = ci, h
+			}
+		}
+		r[*q] = clientIDs[owner]
+		counts[owner]++
+	}
+	return r
+}
+
+func stickyHash(key string) uint64 {
+	d := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint64(d[:8])
+}
+
+// Name return reblance's name
+func (a *Sticky) Name() string {
+	return "STICKY"
 }
@@ -1,6 +1,9 @@
 package consumer
 
 import (
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -79,7 +82,7 @@ func TestAvg(t *testing.T) {
 		{
 			clientID:     "7",
 			allClientIDs: []string{"1", "2", "3", "4", "5", "6", "7"},
-			expectedQIDs: []int{1},
+			expectedQIDs: []int{},
 		},
 	}
 
@@ -112,7 +115,7 @@ func TestAvg(t *testing.T) {
 		{
 			clientID:     "7",
 			allClientIDs: []string{"1", "2", "3", "4", "5", "6", "7"},
-			expectedQIDs: []int{1},
+			expectedQIDs: []int{},
 		},
 		{
 			clientID:     "3",
@@ -131,8 +134,488 @@ func TestAvg(t *testing.T) {
 		{
 			clientID:     "7",
 			allClientIDs: []string{"1", "2", "3", "4", "5", "6", "7"},
-			expectedQIDs: []int{1},
+			expectedQIDs: []int{},
 		},
 	}
 	run()
 }
+
+type fakeMachineRoomResolver struct{}
+
+func (fakeMachineRoomResolver) BrokerDeployIn(q *message.Queue) string {
+	return strings.Split(q.BrokerName, "@")[0]
+}
+
+func (fakeMachineRoomResolver) ConsumerDeployIn(clientID string) string {
+	return strings.Split(clientID, "@")[0]
+}
+
+func buildAssignQueues(rooms []string, brokerCount, queueCount int) []*message.Queue {
+	var queues []*message.Queue
+	for _, r := range rooms {
+		for b := 0; b < brokerCount; b++ {
+			for i := 0; i < queueCount; i++ {
+				queues = append(queues, &message.Queue{
+					Topic:      "topic",
+					BrokerName: r + "@broker" + strconv.Itoa(b),
+					QueueID:    uint8(i),
+				})
+			}
+		}
+	}
+	message.SortQueue(queues)
+	return queues
+}
+
+func buildAssignClients(rooms []string, count int) []string {
+	var clientIDs []string
+	for i := 0; i < count; i++ {
+		clientIDs = append(clientIDs, rooms[i%len(rooms)]+"@10.0.0."+strconv.Itoa(i))
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
+}
+
+func TestAssignDisjointCover(t *testing.T) {
+	assigners := []QueueAssigner{
+		&Averagely{},
+		&AveragelyByCircle{},
+		&ConsistentHash{},
+		&ConsistentHash{VirtualNodeCount: 3},
+		&ByMachineRoom{ConsumeIDCs: []string{"room1", "room2"}},
+		&MachineRoomNearby{Assigner: &Averagely{}, Resolver: fakeMachineRoomResolver{}},
+		&MachineRoomNearby{Assigner: &AveragelyByCircle{}, Resolver: fakeMachineRoomResolver{}},
+		&Sticky{},
+	}
+
+	cases := []struct {
+		clientRooms []string
+		clientCount int
+		queueRooms  []string
+		brokerCount int
+		queueCount  int
+	}{
+		{[]string{"room1"}, 1, []string{"room1"}, 1, 1},
+		{[]string{"room1"}, 3, []string{"room1"}, 2, 4},
+		{[]string{"room1", "room2"}, 8, []string{"room1", "room2"}, 1, 3},
+		{[]string{"room1", "room2"}, 4, []string{"room1", "room2", "room3"}, 2, 8},
+		{[]string{"room2"}, 5, []string{"room1", "room2", "room3"}, 3, 16},
+		{[]string{"room1", "room2", "room3"}, 16, []string{"room1", "room2"}, 1, 4},
+	}
+
+	for _, a := range assigners {
+		for i, c := range cases {
+			queues := buildAssignQueues(c.queueRooms, c.brokerCount, c.queueCount)
+			clientIDs := buildAssignClients(c.clientRooms, c.clientCount)
+
+			expected := queues
+			if a.Name() == "MACHINE_ROOM" {
+				expected = buildAssignQueues(intersect(c.queueRooms, []string{"room1", "room2"}), c.brokerCount, c.queueCount)
+			}
+
+			assigned := make(map[message.Queue]string, len(queues))
+			for _, clientID := range clientIDs {
+				qs, err := a.Assign("group", clientID, clientIDs, queues)
+				assert.Nil(t, err)
+				for _, q := range qs {
+					prev, ok := assigned[*q]
+					assert.False(t, ok, "%s case %d: %s assigned to %s & %s", a.Name(), i, q, prev, clientID)
+					assigned[*q] = clientID
+				}
+			}
+			assert.Equal(t, len(expected), len(assigned), "%s case %d", a.Name(), i)
+			for _, q := range expected {
+				_, ok := assigned[*q]
+				assert.True(t, ok, "%s case %d: %s not assigned", a.Name(), i, q)
+			}
+		}
+	}
+}
+
+func intersect(s1, s2 []string) (r []string) {
+	for _, s := range s1 {
+		for _, ss := range s2 {
+			if s == ss {
+				r = append(r, s)
+			}
+		}
+	}
+	return
+}
+
+func TestAssignErrors(t *testing.T) {
+	queues := buildAssignQueues([]string{"room1"}, 1, 2)
+	for _, a := range []QueueAssigner{
+		&AveragelyByCircle{},
+		&ConsistentHash{},
+		&ByMachineRoom{},
+		&MachineRoomNearby{Assigner: &Averagely{}, Resolver: fakeMachineRoomResolver{}},
+		&Sticky{},
+	} {
+		_, err := a.Assign("", "", []string{"1"}, queues)
+		assert.Equal(t, errEmptyCurrentClientID, err)
+		_, err = a.Assign("", "1", nil, queues)
+		assert.Equal(t, errEmptyClientIDs, err)
+		_, err = a.Assign("", "1", []string{"1"}, nil)
+		assert.Equal(t, errEmptyQueues, err)
+		_, err = a.Assign("", "1", []string{"2"}, queues)
+		assert.Equal(t, errNotFoundCurrentClientID, err)
+	}
+
+	_, err := (&MachineRoomNearby{Resolver: fakeMachineRoomResolver{}}).Assign("", "1", []string{"1"}, queues)
+	assert.Equal(t, errEmptyAssigner, err)
+	assert.Equal(t, "MACHINE_ROOM_NEARBY-", (&MachineRoomNearby{}).Name())
+	_, err = (&MachineRoomNearby{Assigner: &Averagely{}}).Assign("", "1", []string{"1"}, queues)
+	assert.Equal(t, errEmptyMachineRoomResolver, err)
+	_, err = (&MachineRoomNearby{Assigner: &Averagely{}, Resolver: fakeMachineRoomResolver{}}).Assign(
+		"", "@1", []string{"@1"}, queues,
+	)
+	assert.Equal(t, errEmptyMachineRoom, err)
+}
+
+func TestByConfig(t *testing.T) {
+	queues := buildAssignQueues([]string{"room1"}, 2, 4)
+	clientIDs := []string{"1", "2", "3"}
+	configs := map[string]*ByConfig{
+		"1": &ByConfig{Queues: queues[:3]},
+		"2": &ByConfig{Queues: queues[3:5]},
+		"3": &ByConfig{Queues: queues[5:]},
+	}
+
+	var all []*message.Queue
+	for _, c := range clientIDs {
+		qs, err := configs[c].Assign("group", c, clientIDs, queues)
+		assert.Nil(t, err)
+		assert.Equal(t, configs[c].Queues, qs)
+		all = append(all, qs...)
+	}
+	assert.Equal(t, queues, all)
+	assert.Equal(t, "CONFIG", configs["1"].Name())
+}
+
+func TestConsistentHash(t *testing.T) {
+	// the first 4 bytes of md5("a") 0cc175b9c0f1b6a831c399e269772661
+	assert.Equal(t, int64(0x0cc175b9), md5Hash("a"))
+	assert.Equal(
+		t, "MessageQueue [topic=t, brokerName=b, queueId=1]",
+		javaQueueKey(&message.Queue{Topic: "t", BrokerName: "b", QueueID: 1}),
+	)
+
+	// adding one client only moves the queues to the new client
+	queues := buildAssignQueues([]string{"room1"}, 4, 8)
+	a := &ConsistentHash{}
+	clientIDs := []string{"c1", "c2", "c3"}
+	before := make(map[message.Queue]string)
+	for _, c := range clientIDs {
+		qs, err := a.Assign("group", c, clientIDs, queues)
+		assert.Nil(t, err)
+		for _, q := range qs {
+			before[*q] = c
+		}
+	}
+
+	clientIDs = append(clientIDs, "c4")
+	for _, c := range clientIDs {
+		qs, err := a.Assign("group", c, clientIDs, queues)
+		assert.Nil(t, err)
+		for _, q := range qs {
+			if c != "c4" {
+				assert.Equal(t, before[*q], c)
+			}
+		}
+	}
+}
+
+func TestMachineRoomNearby(t *testing.T) {
+	queues := buildAssignQueues([]string{"room1", "room2", "room3"}, 1, 2)
+	clientIDs := []string{"room1@1", "room2@1", "room2@2"}
+	a := &MachineRoomNearby{Assigner: &AveragelyByCircle{}, Resolver: fakeMachineRoomResolver{}}
+	assert.Equal(t, "MACHINE_ROOM_NEARBY-AVG_BY_CIRCLE", a.Name())
+
+	type testCase struct {
+		clientID string
+		brokers  []string
+	}
+	for _, c := range []testCase{
+		// the queues in room3 are shared by all the clients
+		{"room1@1", []string{"room1@broker0", "room1@broker0", "room3@broker0"}},
+		{"room2@1", []string{"room2@broker0", "room3@broker0"}},
+		{"room2@2", []string{"room2@broker0"}},
+	} {
+		qs, err := a.Assign("group", c.clientID, clientIDs, queues)
+		assert.Nil(t, err)
+		var brokers []string
+		for _, q := range qs {
+			brokers = append(brokers, q.BrokerName)
+		}
+		assert.Equal(t, c.brokers, brokers, c.clientID)
+	}
+}
+
+func TestByMachineRoom(t *testing.T) {
+	queues := buildAssignQueues([]string{"room1", "room2"}, 1, 3)
+	queues = append(queues, &message.Queue{Topic: "topic", BrokerName: "broker"})
+	a := &ByMachineRoom{ConsumeIDCs: []string{"room2"}}
+	assert.Equal(t, "MACHINE_ROOM", a.Name())
+
+	clientIDs := []string{"1", "2"}
+	qs, err := a.Assign("group", "1", clientIDs, queues)
+	assert.Nil(t, err)
+	assert.Equal(t, []*message.Queue{queues[3], queues[5]}, qs)
+	qs, err = a.Assign("group", "2", clientIDs, queues)
+	assert.Nil(t, err)
+	assert.Equal(t, []*message.Queue{queues[4]}, qs)
+}
+
+// assignAll returns the client of each queue
+func assignAll(t *testing.T, a QueueAssigner, clientIDs []string, queues []*message.Queue) map[message.Queue]string {
+	owners := make(map[message.Queue]string, len(queues))
+	for _, c := range clientIDs {
+		qs, err := a.Assign("group", c, clientIDs, queues)
+		assert.Nil(t, err)
+		for _, q := range qs {
+			_, ok := owners[*q]
+			assert.False(t, ok, "%s assigned twice", q)
+			owners[*q] = c
+		}
+	}
+	assert.Equal(t, len(queues), len(owners))
+	return owners
+}
+
+// minMoved returns the count of the queues which must be moved when the assignment changes
+// from the old owners to the new clients, i.e. the queues cannot be kept by the alive clients,
+// whose count is limited by the quota
+func minMoved(owners map[message.Queue]string, clientIDs []string, queues []*message.Queue) int {
+	counts := make(map[string]int)
+	for _, c := range owners {
+		counts[c]++
+	}
+
+	kept := 0
+	for i, quota := range stickyQuotas(clientIDs, queues) {
+		if n := counts[clientIDs[i]]; n < quota {
+			kept += n
+		} else {
+			kept += quota
+		}
+	}
+	return len(queues) - kept
+}
+
+// stickySimulation simulates the clients assigning by the sticky assigner with their own queues,
+// the locks of the queues are kept by the broker
+type stickySimulation struct {
+	t      *testing.T
+	queues []*message.Queue
+	locks  map[message.Queue]string
+	held   map[string]map[message.Queue]bool
+}
+
+func newStickySimulation(t *testing.T, queues []*message.Queue) *stickySimulation {
+	return &stickySimulation{
+		t:      t,
+		queues: queues,
+		locks:  make(map[message.Queue]string),
+		held:   make(map[string]map[message.Queue]bool),
+	}
+}
+
+func (s *stickySimulation) lock(clientID string) QueueLocker {
+	return func(qs []*message.Queue) (r []*message.Queue) {
+		for _, q := range qs {
+			if o, ok := s.locks[*q]; !ok || o == clientID {
+				s.locks[*q] = clientID
+				r = append(r, q)
+			}
+		}
+		return
+	}
+}
+
+// reblance runs the reblancing of the clients one by one, the released queues are unlocked at once
+func (s *stickySimulation) reblance(order, clientIDs []string) {
+	for _, c := range order {
+		var held []*message.Queue
+		for _, q := range s.queues {
+			if s.held[c][*q] {
+				held = append(held, q)
+			}
+		}
+
+		qs, err := (&Sticky{}).AssignSticky(c, clientIDs, s.queues, held, s.lock(c))
+		assert.Nil(s.t, err)
+		cur := make(map[message.Queue]bool, len(qs))
+		for _, q := range qs {
+			cur[*q] = true
+		}
+		for q := range s.held[c] {
+			if !cur[q] && s.locks[q] == c {
+				delete(s.locks, q)
+			}
+		}
+		s.held[c] = cur
+		s.owners() // no queue is processed by two clients at any time
+	}
+}
+
+// leave removes the left clients, which unlock their queues
+func (s *stickySimulation) leave(clientIDs []string) {
+NEXT:
+	for c := range s.held {
+		for _, id := range clientIDs {
+			if c == id {
+				continue NEXT
+			}
+		}
+		for q := range s.held[c] {
+			delete(s.locks, q)
+		}
+		delete(s.held, c)
+	}
+}
+
+// owners returns the client of each queue processing it
+func (s *stickySimulation) owners() map[message.Queue]string {
+	owners := make(map[message.Queue]string)
+	for c, qs := range s.held {
+		for q := range qs {
+			o, ok := owners[q]
+			assert.False(s.t, ok, "%s is processed by %s & %s", &q, o, c)
+			owners[q] = c
+		}
+	}
+	return owners
+}
+
+// converge reblances until the assignment is stable, asserts that all the queues are assigned evenly
+func (s *stickySimulation) converge(clientIDs []string) map[message.Queue]string {
+	reversed := make([]string, len(clientIDs))
+	for i, c := range clientIDs {
+		reversed[len(clientIDs)-1-i] = c
+	}
+	s.leave(clientIDs)
+	s.reblance(reversed, clientIDs)
+	s.reblance(clientIDs, clientIDs)
+	s.reblance(reversed, clientIDs)
+
+	owners := s.owners()
+	assert.Equal(s.t, len(s.queues), len(owners), "clients:%v", clientIDs)
+	counts := make(map[string]int)
+	for _, c := range owners {
+		counts[c]++
+	}
+	for i, quota := range stickyQuotas(clientIDs, s.queues) {
+		assert.Equal(s.t, quota, counts[clientIDs[i]], "clients:%v", clientIDs)
+	}
+	return owners
+}
+
+// TestStickyReblanceSimulation counts the moved queues when the clients join & leave
+func TestStickyReblanceSimulation(t *testing.T) {
+	queues := buildAssignQueues([]string{"room1"}, 4, 8)
+	clients := func(ids ...int) (r []string) {
+		for _, id := range ids {
+			r = append(r, "10.0.0."+strconv.Itoa(id)+"@"+strconv.Itoa(id))
+		}
+		sort.Strings(r)
+		return
+	}
+
+	steps := [][]string{
+		clients(1),
+		clients(1, 2),
+		clients(1, 2, 3),
+		clients(1, 2, 3, 4),
+		clients(1, 2, 3, 4, 5),
+		clients(1, 2, 3, 4, 5, 6, 7),
+		clients(1, 2, 4, 5, 6, 7),
+		clients(2, 4, 5, 6, 7),
+		clients(2, 4, 5, 6, 7, 8),
+		clients(4, 5),
+		clients(4, 5, 9),
+	}
+
+	moved := func(prev, cur map[message.Queue]string) (n int) {
+		for q, c := range cur {
+			if prev[q] != c {
+				n++
+			}
+		}
+		return
+	}
+
+	// sticky, moves the minimum on every step
+	sim, stickyMoved := newStickySimulation(t, queues), 0
+	prev := sim.converge(steps[0])
+	for _, clientIDs := range steps[1:] {
+		cur := sim.converge(clientIDs)
+		n := moved(prev, cur)
+		assert.Equal(t, minMoved(prev, clientIDs, queues), n, "clients:%v", clientIDs)
+		stickyMoved += n
+		prev = cur
+	}
+
+	// averagely
+	avgMoved := 0
+	prev = assignAll(t, &Averagely{}, steps[0], queues)
+	for _, clientIDs := range steps[1:] {
+		cur := assignAll(t, &Averagely{}, clientIDs, queues)
+		avgMoved += moved(prev, cur)
+		prev = cur
+	}
+	assert.True(t, stickyMoved < avgMoved, "sticky:%d, averagely:%d", stickyMoved, avgMoved)
+}
+
+// TestStickyReblanceJoinOneByOne the clients join one by one, each one knows nothing of the others
+func TestStickyReblanceJoinOneByOne(t *testing.T) {
+	for queueCount := 3; queueCount <= 16; queueCount++ {
+		queues := buildAssignQueues([]string{"room1"}, 1, queueCount)
+		sim := newStickySimulation(t, queues)
+		var clientIDs []string
+		for i := 0; i < 4; i++ {
+			clientIDs = append(clientIDs, "10.0.0."+strconv.Itoa(i)+"@"+strconv.Itoa(i))
+			sim.converge(clientIDs)
+		}
+	}
+}
+
+func TestAssignStickyLocked(t *testing.T) {
+	queues := buildAssignQueues([]string{"room1"}, 1, 4)
+	clientIDs := []string{"a", "b"}
+	locks := map[message.Queue]string{*queues[0]: "b", *queues[1]: "b"}
+	lock := func(qs []*message.Queue) (r []*message.Queue) {
+		for _, q := range qs {
+			if o, ok := locks[*q]; !ok || o == "a" {
+				locks[*q] = "a"
+				r = append(r, q)
+			}
+		}
+		return
+	}
+
+	// the held queue locked by the other is not kept
+	qs, err := (&Sticky{}).AssignSticky("a", clientIDs, queues, queues[:2], lock)
+	assert.Nil(t, err)
+	assert.Equal(t, queues[2:], qs)
+
+	// over the quota
+	locks = map[message.Queue]string{}
+	qs, err = (&Sticky{}).AssignSticky("a", clientIDs, queues, queues, lock)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(qs))
+	assert.Equal(t, 4, len(locks)) // unlocked after released
+
+	// the held queue not in the topic is ignored
+	other := &message.Queue{Topic: "other"}
+	qs, err = (&Sticky{}).AssignSticky("a", []string{"a"}, queues, []*message.Queue{other}, lock)
+	assert.Nil(t, err)
+	assert.Equal(t, queues, qs)
+
+	_, err = (&Sticky{}).AssignSticky("a", nil, queues, nil, lock)
+	assert.Equal(t, errEmptyClientIDs, err)
+	_, err = (&Sticky{}).AssignSticky("a", clientIDs, nil, nil, lock)
+	assert.Equal(t, errEmptyQueues, err)
+	_, err = (&Sticky{}).AssignSticky("c", clientIDs, queues, nil, lock)
+	assert.Equal(t, errNotFoundCurrentClientID, err)
+}
@@ -3,6 +3,7 @@ package consumer
 import (
 	"time"
 
+	"github.com/zjykzk/rocketmq-client-go/message"
 	"github.com/zjykzk/rocketmq-client-go/remote"
 	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 )
@@ -10,10 +11,14 @@ import (
 type rpcI interface {
 	GetConsumerIDs(addr, group string, to time.Duration) ([]string, error)
 	PullMessageSync(addr string, header *rpc.PullHeader, to time.Duration) (*rpc.PullResponse, error)
+	PullMessageAsync(addr string, header *rpc.PullHeader, to time.Duration, callback func(*rpc.PullResponse, error)) error
 	SendBack(addr string, h *rpc.SendBackHeader, to time.Duration) error
 	UpdateConsumerOffset(addr, topic, group string, queueID int, offset int64, to time.Duration) error
 	UpdateConsumerOffsetOneway(addr, topic, group string, queueID int, offset int64) error
 	QueryConsumerOffset(addr, topic, group string, queueID int, to time.Duration) (int64, *remote.RPCError)
 	MaxOffset(addr, topic string, queueID uint8, to time.Duration) (int64, *remote.RPCError)
+	MinOffset(addr, topic string, queueID uint8, to time.Duration) (int64, *remote.RPCError)
 	SearchOffsetByTimestamp(addr, broker, topic string, queueID uint8, timestamp time.Time, to time.Duration) (int64, *remote.RPCError)
+	LockMessageQueues(addr, group, clientID string, queues []message.Queue, to time.Duration) ([]message.Queue, error)
+	UnlockMessageQueues(addr, group, clientID string, queues []message.Queue, to time.Duration) error
 }
@@ -0,0 +1,257 @@
+package consumer
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/client"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/metrics"
+)
+
+const (
+	statsBucketCount = 60
+)
+
+type bucket struct {
+	index int64
+	count int64
+	sum   int64
+}
+
+// window sums the count & value in the sliding window, which is divided into the buckets
+// the expired bucket is reset when it's reused
+type window struct {
+	sync.Mutex
+	bucketSize time.Duration
+	buckets    [statsBucketCount]bucket
+	start      time.Time
+	now        func() time.Time
+}
+
+func newWindow(bucketSize time.Duration, now func() time.Time) *window {
+	return &window{bucketSize: bucketSize, start: now(), now: now}
+}
+
+func (w *window) add(count, value int64) {
+	i := w.now().UnixNano() / int64(w.bucketSize)
+	w.Lock()
+	b := &w.buckets[i%statsBucketCount]
+	if b.index != i {
+		*b = bucket{index: i}
+	}
+	b.count += count
+	b.sum += value
+	w.Unlock()
+}
+
+// sum returns the sum of the count & value in the window, and the elapsed time
+// which is shorter than the window when the window is just created
+func (w *window) sum() (count, value int64, elapsed time.Duration) {
+	now := w.now()
+	i := now.UnixNano() / int64(w.bucketSize)
+	w.Lock()
+	for _, b := range w.buckets {
+		if i-b.index < statsBucketCount {
+			count += b.count
+			value += b.sum
+		}
+	}
+	w.Unlock()
+
+	elapsed = w.bucketSize * statsBucketCount
+	if d := now.Sub(w.start); d < elapsed {
+		elapsed = d
+	}
+	return
+}
+
+// tps returns the count per second in the window
+func (w *window) tps() float64 {
+	count, _, elapsed := w.sum()
+	if elapsed < time.Second {
+		elapsed = time.Second
+	}
+	return float64(count) / elapsed.Seconds()
+}
+
+// avg returns the average value in the window
+func (w *window) avg() float64 {
+	count, value, _ := w.sum()
+	if count == 0 {
+		return 0
+	}
+	return float64(value) / float64(count)
+}
+
+type topicStats struct {
+	pullRT            *window
+	pullTPS           *window
+	consumeRT         *window
+	consumeOKTPS      *window
+	consumeFailedTPS  *window
+	consumeFailedMsgs *window
+}
+
+func newTopicStats(now func() time.Time) *topicStats {
+	return &topicStats{
+		pullRT:            newWindow(time.Second, now),
+		pullTPS:           newWindow(time.Second, now),
+		consumeRT:         newWindow(time.Second, now),
+		consumeOKTPS:      newWindow(time.Second, now),
+		consumeFailedTPS:  newWindow(time.Second, now),
+		consumeFailedMsgs: newWindow(time.Minute, now),
+	}
+}
+
+func (s *topicStats) status() client.ConsumeStatus {
+	failedCount, _, _ := s.consumeFailedMsgs.sum()
+	return client.ConsumeStatus{
+		PullRT:            s.pullRT.avg(),
+		PullTPS:           s.pullTPS.tps(),
+		ConsumeRT:         s.consumeRT.avg(),
+		ConsumeOKTPS:      s.consumeOKTPS.tps(),
+		ConsumeFailedTPS:  s.consumeFailedTPS.tps(),
+		ConsumeFailedMsgs: failedCount,
+	}
+}
+
+// statsManager stats the pulling & consuming of the topics in the last minute,
+// and emits the metrics of the group
+type statsManager struct {
+	sync.RWMutex
+	group  string
+	topics map[string]*topicStats
+
+	now func() time.Time
+}
+
+func newStatsManager(group string) *statsManager {
+	return &statsManager{group: group, topics: make(map[string]*topicStats), now: time.Now}
+}
+
+func (m *statsManager) labels(topic string) metrics.Labels {
+	return metrics.Labels{"group": m.group, "topic": topic}
+}
+
+func (m *statsManager) topicStats(topic string) *topicStats {
+	m.RLock()
+	s, ok := m.topics[topic]
+	m.RUnlock()
+	if ok {
+		return s
+	}
+
+	m.Lock()
+	s, ok = m.topics[topic]
+	if !ok {
+		s = newTopicStats(m.now)
+		m.topics[topic] = s
+	}
+	m.Unlock()
+	return s
+}
+
+func millis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func (m *statsManager) incPullRT(topic string, rt time.Duration) {
+	m.topicStats(topic).pullRT.add(1, millis(rt))
+	metrics.ObserveHistogram(metrics.PullLatency, m.labels(topic), rt.Seconds())
+}
+
+func (m *statsManager) incPullTPS(topic string, msgCount int) {
+	m.topicStats(topic).pullTPS.add(int64(msgCount), 0)
+	metrics.IncCounter(metrics.PullMessages, m.labels(topic), float64(msgCount))
+}
+
+func (m *statsManager) incConsumeRT(topic string, rt time.Duration) {
+	m.topicStats(topic).consumeRT.add(1, millis(rt))
+	metrics.ObserveHistogram(metrics.ConsumeLatency, m.labels(topic), rt.Seconds())
+}
+
+func (m *statsManager) incConsumeOKTPS(topic string, msgCount int) {
+	m.topicStats(topic).consumeOKTPS.add(int64(msgCount), 0)
+	m.incConsumeMessages(topic, metrics.StatusOK, msgCount)
+}
+
+func (m *statsManager) incConsumeFailedTPS(topic string, msgCount int) {
+	s := m.topicStats(topic)
+	s.consumeFailedTPS.add(int64(msgCount), 0)
+	s.consumeFailedMsgs.add(int64(msgCount), 0)
+	m.incConsumeMessages(topic, metrics.StatusFailed, msgCount)
+}
+
+func (m *statsManager) incConsumeMessages(topic, status string, msgCount int) {
+	if msgCount <= 0 {
+		return
+	}
+	labels := m.labels(topic)
+	labels["status"] = status
+	metrics.IncCounter(metrics.ConsumeMessages, labels, float64(msgCount))
+}
+
+// incPull counts the pulling request
+func (m *statsManager) incPull(topic string, err error) {
+	labels := m.labels(topic)
+	labels["status"] = metrics.StatusOK
+	if err != nil {
+		labels["status"] = metrics.StatusFailed
+	}
+	metrics.IncCounter(metrics.PullTotal, labels, 1)
+}
+
+// incRebalance counts the rebalancing changed the queues of the topic
+func (m *statsManager) incRebalance(topic string) {
+	metrics.IncCounter(metrics.RebalanceTotal, m.labels(topic), 1)
+}
+
+// setLag sets the count of the messages not consumed in the queue
+func (m *statsManager) setLag(q *message.Queue, lag int64) {
+	metrics.SetGauge(metrics.ConsumerLag, m.lagLabels(q), float64(lag))
+}
+
+// removeLag removes the lag of the queue not consumed by the client
+func (m *statsManager) removeLag(q *message.Queue) {
+	metrics.DeleteGauge(metrics.ConsumerLag, m.lagLabels(q))
+}
+
+func (m *statsManager) lagLabels(q *message.Queue) metrics.Labels {
+	labels := m.labels(q.Topic)
+	labels["broker"] = q.BrokerName
+	labels["queue"] = strconv.Itoa(int(q.QueueID))
+	return labels
+}
+
+// status returns the statistics of the topic
+func (m *statsManager) status(topic string) client.ConsumeStatus {
+	m.RLock()
+	s, ok := m.topics[topic]
+	m.RUnlock()
+	if !ok {
+		return client.ConsumeStatus{}
+	}
+	return s.status()
+}
+
+// topicNames returns the topics with the statistics
+func (m *statsManager) topicNames() []string {
+	m.RLock()
+	topics := make([]string, 0, len(m.topics))
+	for t := range m.topics {
+		topics = append(topics, t)
+	}
+	m.RUnlock()
+	return topics
+}
+
+// statuses returns the statistics of the topics
+func (m *statsManager) statuses(topics []string) map[string]client.ConsumeStatus {
+	r := make(map[string]client.ConsumeStatus, len(topics))
+	for _, t := range topics {
+		r[t] = m.status(t)
+	}
+	return r
+}
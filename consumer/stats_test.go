@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/client"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/metrics"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestWindow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	w := newWindow(time.Second, clock.now)
+	assert.Equal(t, float64(0), w.tps())
+	assert.Equal(t, float64(0), w.avg())
+
+	w.add(10, 100)
+	clock.add(500 * time.Millisecond)
+	w.add(10, 300)
+	assert.Equal(t, float64(20), w.tps()) // less than one second
+	assert.Equal(t, float64(20), w.avg())
+
+	clock.add(1500 * time.Millisecond)
+	w.add(20, 0)
+	assert.Equal(t, float64(20), w.tps()) // 40 in 2 seconds
+	assert.Equal(t, float64(10), w.avg())
+
+	// the last bucket of the window
+	clock.add(time.Minute - 3*time.Second)
+	w.add(20, 0)
+	count, _, elapsed := w.sum()
+	assert.Equal(t, int64(60), count)
+	assert.Equal(t, time.Minute-time.Second, elapsed)
+
+	// the first bucket expired
+	clock.add(time.Second)
+	count, _, elapsed = w.sum()
+	assert.Equal(t, int64(40), count)
+	assert.Equal(t, time.Minute, elapsed)
+	assert.Equal(t, float64(40)/60, w.tps())
+
+	// the reused bucket is reset
+	w.add(1, 1)
+	count, value, _ := w.sum()
+	assert.Equal(t, int64(41), count)
+	assert.Equal(t, int64(1), value)
+
+	// all expired
+	clock.add(time.Minute)
+	count, value, _ = w.sum()
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(0), value)
+}
+
+func TestStatsManager(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	m := newStatsManager("g")
+	m.now = clock.now
+
+	assert.Equal(t, client.ConsumeStatus{}, m.status("not exist"))
+
+	clock.add(time.Minute)
+	m.incPullRT("t", 10*time.Millisecond)
+	m.incPullRT("t", 30*time.Millisecond)
+	m.incPullTPS("t", 60)
+	m.incConsumeRT("t", 4*time.Millisecond)
+	m.incConsumeOKTPS("t", 30)
+	m.incConsumeFailedTPS("t", 6)
+	m.incPullTPS("t1", 1)
+	clock.add(2 * time.Second)
+
+	assert.Equal(t, client.ConsumeStatus{
+		PullRT:            20,
+		PullTPS:           30,
+		ConsumeRT:         4,
+		ConsumeOKTPS:      15,
+		ConsumeFailedTPS:  3,
+		ConsumeFailedMsgs: 6,
+	}, m.status("t"))
+
+	// the failed messages is kept in one hour
+	clock.add(time.Minute)
+	assert.Equal(t, client.ConsumeStatus{ConsumeFailedMsgs: 6}, m.status("t"))
+	clock.add(time.Hour)
+	assert.Equal(t, client.ConsumeStatus{}, m.status("t"))
+
+	assert.ElementsMatch(t, []string{"t", "t1"}, m.topicNames())
+	statuses := m.statuses([]string{"t", "not exist"})
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, client.ConsumeStatus{}, statuses["not exist"])
+}
+
+func TestStatsMetrics(t *testing.T) {
+	r := metrics.NewRegistry(0.01)
+	metrics.SetSink(r)
+	defer metrics.SetSink(nil)
+
+	m := newStatsManager("g")
+	m.incPullRT("t", 5*time.Millisecond)
+	m.incPull("t", nil)
+	m.incPull("t", errors.New("pull failed"))
+	m.incPullTPS("t", 3)
+	m.incConsumeRT("t", 20*time.Millisecond)
+	m.incConsumeOKTPS("t", 2)
+	m.incConsumeFailedTPS("t", 1)
+	m.incConsumeFailedTPS("t", 0)
+	m.incRebalance("t")
+	m.setLag(&message.Queue{Topic: "t", BrokerName: "b", QueueID: 1}, 7)
+
+	buf := &bytes.Buffer{}
+	r.WriteTo(buf)
+	out := buf.String()
+	for _, l := range []string{
+		`rocketmq_pull_latency_seconds_bucket{group="g",topic="t",le="0.01"} 1`,
+		`rocketmq_pull_total{group="g",status="ok",topic="t"} 1`,
+		`rocketmq_pull_total{group="g",status="failed",topic="t"} 1`,
+		`rocketmq_pull_messages_total{group="g",topic="t"} 3`,
+		`rocketmq_consume_latency_seconds_bucket{group="g",topic="t",le="0.01"} 0`,
+		`rocketmq_consume_messages_total{group="g",status="ok",topic="t"} 2`,
+		`rocketmq_consume_messages_total{group="g",status="failed",topic="t"} 1`,
+		`rocketmq_rebalance_total{group="g",topic="t"} 1`,
+		`rocketmq_consumer_lag{broker="b",group="g",queue="1",topic="t"} 7`,
+	} {
+		assert.True(t, strings.Contains(out, l+"\n"), l)
+	}
+}
+
+func TestRemoveLagOfRemovedQueue(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.SetSink(r)
+	defer metrics.SetSink(nil)
+
+	lag := func() string {
+		buf := &bytes.Buffer{}
+		r.WriteTo(buf)
+		return buf.String()
+	}
+
+	cs := newTestConcurrentlyService(t)
+	mq1, mq2 := &message.Queue{Topic: "t", QueueID: 1}, &message.Queue{Topic: "t", QueueID: 2}
+	cs.insertNewMessageQueue(mq1)
+	cs.insertNewMessageQueue(mq2)
+	cs.stats.setLag(mq1, 1)
+	cs.stats.setLag(mq2, 2)
+
+	assert.True(t, cs.removeOldMessageQueue(mq1))
+	assert.False(t, strings.Contains(lag(), `queue="1"`))
+	assert.True(t, strings.Contains(lag(), `queue="2"`))
+
+	mq := &message.Queue{Topic: "orderly", BrokerName: "b", QueueID: 3}
+	ocs := newTestOrderlyService(t, &mockOrderlyConsumer{}, &mockQueueLocker{lockedQueues: []message.Queue{*mq}})
+	ocs.insertNewMessageQueue(mq)
+	ocs.stats.setLag(mq, 3)
+	assert.True(t, strings.Contains(lag(), `queue="3"`))
+	assert.True(t, ocs.removeOldMessageQueue(mq))
+	assert.False(t, strings.Contains(lag(), `queue="3"`))
+}
@@ -2,13 +2,18 @@ package consumer
 
 import (
 	"sync"
+	"time"
 
 	"github.com/zjykzk/rocketmq-client-go/message"
 )
 
+// the broker failed to pull is not selected during this time, unless all the brokers are unreachable
+const brokerUnreachableDuration = 30 * time.Second
+
 type brokerSuggester struct {
 	sync.RWMutex
-	table map[string]int32 // key: message queue's hask key, value: broker id
+	table       map[string]int32     // key: message queue's hask key, value: broker id
+	unreachable map[string]time.Time // key: broker address, value: the time of failure
 }
 
 func (s *brokerSuggester) get(q *message.Queue) (id int32, exist bool) {
@@ -26,3 +31,25 @@ func (s *brokerSuggester) put(q *message.Queue, brokerID int32) (prev int32) {
 	s.Unlock()
 	return prev
 }
+
+func (s *brokerSuggester) markUnreachable(addr string, now time.Time) {
+	s.Lock()
+	if s.unreachable == nil {
+		s.unreachable = make(map[string]time.Time)
+	}
+	s.unreachable[addr] = now
+	s.Unlock()
+}
+
+func (s *brokerSuggester) markReachable(addr string) {
+	s.Lock()
+	delete(s.unreachable, addr)
+	s.Unlock()
+}
+
+func (s *brokerSuggester) isUnreachable(addr string, now time.Time) bool {
+	s.RLock()
+	t, ok := s.unreachable[addr]
+	s.RUnlock()
+	return ok && now.Sub(t) < brokerUnreachableDuration
+}
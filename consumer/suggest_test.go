@@ -2,6 +2,7 @@ package consumer
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -21,3 +22,18 @@ func TestSuggester(t *testing.T) {
 	_, exist = bs.get(&message.Queue{Topic: "t"})
 	assert.False(t, exist)
 }
+
+func TestSuggesterUnreachable(t *testing.T) {
+	bs := brokerSuggester{}
+	now := time.Now()
+	assert.False(t, bs.isUnreachable("a", now))
+
+	bs.markUnreachable("a", now)
+	assert.True(t, bs.isUnreachable("a", now))
+	assert.True(t, bs.isUnreachable("a", now.Add(brokerUnreachableDuration-1)))
+	assert.False(t, bs.isUnreachable("a", now.Add(brokerUnreachableDuration)))
+	assert.False(t, bs.isUnreachable("b", now))
+
+	bs.markReachable("a")
+	assert.False(t, bs.isUnreachable("a", now))
+}
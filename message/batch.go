@@ -0,0 +1,47 @@
+package message
+
+import (
+	"encoding/binary"
+
+	"github.com/zjykzk/rocketmq-client-go/buf"
+)
+
+// EncodedSize returns the size of the message encoded in the batch body
+func (m *Message) EncodedSize() int {
+	return 4 /* TOTALSIZE */ +
+		4 /* MAGICCODE */ +
+		4 /* BODYCRC */ +
+		4 /* FLAG */ +
+		4 + len(m.Body) /* BODY */ +
+		2 + len(Properties2String(m.Properties)) /* PROPERTIES */
+}
+
+// Encode encodes the message as one element of the batch body
+func (m *Message) Encode() []byte {
+	properties := Properties2String(m.Properties)
+	size := m.EncodedSize()
+	bb := buf.NewByteBufferWithSize(binary.BigEndian, size)
+	bb.PutInt32(int32(size))
+	bb.PutInt32(0) // MagicCode
+	bb.PutInt32(0) // BodyCRC
+	bb.PutInt32(m.Flag)
+	bb.PutInt32(int32(len(m.Body)))
+	bb.PutBytes(m.Body)
+	bb.PutInt16(int16(len(properties)))
+	bb.PutBytes([]byte(properties))
+	return bb.Bytes()
+}
+
+// EncodeBatch encodes the messages as the body of the batch message
+func EncodeBatch(msgs []*Message) []byte {
+	size := 0
+	for _, m := range msgs {
+		size += m.EncodedSize()
+	}
+
+	bs := make([]byte, 0, size)
+	for _, m := range msgs {
+		bs = append(bs, m.Encode()...)
+	}
+	return bs
+}
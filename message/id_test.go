@@ -35,7 +35,7 @@ func TestID(t *testing.T) {
 	addr := &Addr{Host: []byte{192, 168, 1, 1}, Port: 22}
 	id := CreateMessageID(addr, 20)
 	t.Log(id)
-	t.Log(addr.String())
+	assert.Equal(t, "192.168.1.1:22", addr.String())
 
 	addr1, commitOffset, err := ParseMessageID(id)
 	if err != nil {
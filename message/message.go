@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"strconv"
 	"strings"
 
@@ -126,7 +127,7 @@ type Addr struct {
 }
 
 func (addr *Addr) String() string {
-	return fmt.Sprintf("%v:%d", addr.Host, addr.Port)
+	return fmt.Sprintf("%s:%d", net.IP(addr.Host), addr.Port)
 }
 
 type MessageExt struct {
@@ -1,10 +1,13 @@
 package message
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/buf"
 )
 
 func TestStr2Property(t *testing.T) {
@@ -83,3 +86,32 @@ func TestMessage(t *testing.T) {
 	assert.Equal(t, int32(0), mext.ReconsumeTimes)
 	assert.Equal(t, map[string]string{"a": "123", "b": "hello", "c": "3.14"}, mext.Properties)
 }
+
+func TestEncodeBatch(t *testing.T) {
+	msgs := []*Message{
+		&Message{Topic: "t", Body: []byte("body0"), Flag: 1},
+		&Message{Topic: "t", Body: []byte("body10"), Properties: map[string]string{"k": "v"}},
+	}
+
+	d := EncodeBatch(msgs)
+	assert.Equal(t, msgs[0].EncodedSize()+msgs[1].EncodedSize(), len(d))
+
+	bb := buf.WrapBytes(binary.BigEndian, d)
+	for _, m := range msgs {
+		size, _ := bb.GetInt32()
+		assert.Equal(t, int32(m.EncodedSize()), size)
+		magicCode, _ := bb.GetInt32()
+		assert.Equal(t, int32(0), magicCode)
+		bodyCRC, _ := bb.GetInt32()
+		assert.Equal(t, int32(0), bodyCRC)
+		flag, _ := bb.GetInt32()
+		assert.Equal(t, m.Flag, flag)
+		bodyLen, _ := bb.GetInt32()
+		body, _ := bb.GetBytes(int(bodyLen))
+		assert.Equal(t, m.Body, body)
+		propertiesLen, _ := bb.GetInt16()
+		properties, _ := bb.GetBytes(int(propertiesLen))
+		assert.Equal(t, Properties2String(m.Properties), string(properties))
+	}
+	assert.Equal(t, 0, bb.Len())
+}
@@ -7,9 +7,9 @@ import (
 
 // Queue the consume queue in the broker
 type Queue struct {
-	Topic      string
-	BrokerName string
-	QueueID    uint8
+	Topic      string `json:"topic"`
+	BrokerName string `json:"brokerName"`
+	QueueID    uint8  `json:"queueId"`
 }
 
 func (q *Queue) String() string {
@@ -0,0 +1,105 @@
+// Package metrics exposes the counters, histograms & gauges of the producers, consumers and
+// the remote client through a pluggable sink
+package metrics
+
+import (
+	"sync/atomic"
+)
+
+// the names of the metrics emitted by the client
+const (
+	// SendTotal counts the sending requests, labels: group, topic, status
+	SendTotal = "rocketmq_send_total"
+	// SendLatency observes the latency of the sending request in seconds, labels: group, topic
+	SendLatency = "rocketmq_send_latency_seconds"
+	// PullTotal counts the pulling requests, labels: group, topic, status
+	PullTotal = "rocketmq_pull_total"
+	// PullLatency observes the latency of the pulling request in seconds, labels: group, topic
+	PullLatency = "rocketmq_pull_latency_seconds"
+	// PullMessages counts the pulled messages, labels: group, topic
+	PullMessages = "rocketmq_pull_messages_total"
+	// ConsumeMessages counts the consumed messages, labels: group, topic, status
+	ConsumeMessages = "rocketmq_consume_messages_total"
+	// ConsumeLatency observes the latency of consuming in seconds, labels: group, topic
+	ConsumeLatency = "rocketmq_consume_latency_seconds"
+	// RebalanceTotal counts the rebalancing which changes the queues, labels: group, topic
+	RebalanceTotal = "rocketmq_rebalance_total"
+	// ConsumerLag the count of the messages not consumed, labels: group, topic, broker, queue
+	ConsumerLag = "rocketmq_consumer_lag"
+	// ConnectionEvents counts the events of the connections, labels: event
+	ConnectionEvents = "rocketmq_connection_events_total"
+)
+
+// the values of the label status
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// the values of the label event
+const (
+	EventActive   = "active"
+	EventDeactive = "deactive"
+	EventError    = "error"
+	EventClose    = "close"
+)
+
+// Labels the labels of the metric
+type Labels map[string]string
+
+// Sink receives the metrics
+type Sink interface {
+	IncCounter(name string, labels Labels, delta float64)
+	ObserveHistogram(name string, labels Labels, value float64)
+	SetGauge(name string, labels Labels, value float64)
+	// DeleteGauge deletes the gauge, which is not exported any more
+	DeleteGauge(name string, labels Labels)
+}
+
+type nopSink struct{}
+
+func (nopSink) IncCounter(string, Labels, float64)       {}
+func (nopSink) ObserveHistogram(string, Labels, float64) {}
+func (nopSink) SetGauge(string, Labels, float64)         {}
+func (nopSink) DeleteGauge(string, Labels)               {}
+
+type sinkHolder struct{ Sink }
+
+var sink atomic.Value
+
+func init() {
+	sink.Store(sinkHolder{nopSink{}})
+}
+
+// SetSink sets the sink receiving the metrics, nil means dropping the metrics
+func SetSink(s Sink) {
+	if s == nil {
+		s = nopSink{}
+	}
+	sink.Store(sinkHolder{s})
+}
+
+// GetSink returns the current sink
+func GetSink() Sink {
+	return sink.Load().(sinkHolder).Sink
+}
+
+// IncCounter increases the counter by delta
+func IncCounter(name string, labels Labels, delta float64) {
+	GetSink().IncCounter(name, labels, delta)
+}
+
+// ObserveHistogram observes the value of the histogram
+func ObserveHistogram(name string, labels Labels, value float64) {
+	GetSink().ObserveHistogram(name, labels, value)
+}
+
+// SetGauge sets the value of the gauge
+func SetGauge(name string, labels Labels, value float64) {
+	GetSink().SetGauge(name, labels, value)
+}
+
+// DeleteGauge deletes the gauge
+func DeleteGauge(name string, labels Labels) {
+	GetSink().DeleteGauge(name, labels)
+}
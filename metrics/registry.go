@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets the default upper bounds of the histogram buckets in seconds
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+type histogram struct {
+	counts []uint64 // cumulative counts are computed when rendering
+	count  uint64
+	sum    float64
+}
+
+type series struct {
+	labels Labels
+	value  float64
+	hist   *histogram
+}
+
+type family struct {
+	typ    string
+	series map[string]*series // key: rendered labels
+}
+
+// Registry keeps the metrics in the memory, and renders them in the prometheus text format
+type Registry struct {
+	sync.Mutex
+	buckets  []float64
+	families map[string]*family
+}
+
+// NewRegistry creates the registry, the histograms use the DefaultBuckets if buckets is empty
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	bs := make([]float64, len(buckets))
+	copy(bs, buckets)
+	sort.Float64s(bs)
+	return &Registry{buckets: bs, families: make(map[string]*family)}
+}
+
+func (r *Registry) series(name, typ string, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{typ: typ, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+
+	key := formatLabels(labels, "", "")
+	s, ok := f.series[key]
+	if !ok {
+		ls := make(Labels, len(labels))
+		for k, v := range labels {
+			ls[k] = v
+		}
+		s = &series{labels: ls}
+		if typ == typeHistogram {
+			s.hist = &histogram{counts: make([]uint64, len(r.buckets))}
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// IncCounter increases the counter by delta
+func (r *Registry) IncCounter(name string, labels Labels, delta float64) {
+	r.Lock()
+	r.series(name, typeCounter, labels).value += delta
+	r.Unlock()
+}
+
+// SetGauge sets the value of the gauge
+func (r *Registry) SetGauge(name string, labels Labels, value float64) {
+	r.Lock()
+	r.series(name, typeGauge, labels).value = value
+	r.Unlock()
+}
+
+// DeleteGauge deletes the gauge, the metric is removed if it has no gauge
+func (r *Registry) DeleteGauge(name string, labels Labels) {
+	r.Lock()
+	if f, ok := r.families[name]; ok && f.typ == typeGauge {
+		delete(f.series, formatLabels(labels, "", ""))
+		if len(f.series) == 0 {
+			delete(r.families, name)
+		}
+	}
+	r.Unlock()
+}
+
+// ObserveHistogram observes the value of the histogram
+func (r *Registry) ObserveHistogram(name string, labels Labels, value float64) {
+	r.Lock()
+	h := r.series(name, typeHistogram, labels).hist
+	if i := sort.SearchFloat64s(r.buckets, value); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+	r.Unlock()
+}
+
+// WriteTo writes the metrics in the prometheus text format, sorted by the name & labels
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	bw := &countWriter{w: buf}
+
+	r.Lock()
+	names := make([]string, 0, len(r.families))
+	for n := range r.families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := r.families[n]
+		fmt.Fprintf(bw, "# TYPE %s %s\n", n, f.typ)
+
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			s := f.series[k]
+			if s.hist == nil {
+				fmt.Fprintf(bw, "%s%s %s\n", n, k, formatFloat(s.value))
+				continue
+			}
+			r.writeHistogram(bw, n, s)
+		}
+	}
+	r.Unlock()
+
+	if bw.err != nil {
+		return bw.n, bw.err
+	}
+	return bw.n, buf.Flush()
+}
+
+func (r *Registry) writeHistogram(w io.Writer, name string, s *series) {
+	var cumulative uint64
+	for i, b := range r.buckets {
+		cumulative += s.hist.counts[i]
+		fmt.Fprintf(
+			w, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatFloat(b)), cumulative,
+		)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.hist.count)
+
+	ls := formatLabels(s.labels, "", "")
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, ls, formatFloat(s.hist.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, ls, s.hist.count)
+}
+
+// Handler returns the http handler rendering the metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// formatLabels renders the labels sorted by the name, the extra label is appended if its name is not empty
+func formatLabels(labels Labels, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		writeLabel(&sb, n, labels[n])
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		writeLabel(&sb, extraName, extraValue)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeLabel(sb *strings.Builder, name, value string) {
+	sb.WriteString(name)
+	sb.WriteString(`="`)
+	labelEscaper.WriteString(sb, value)
+	sb.WriteByte('"')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
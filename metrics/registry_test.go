@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(0.1, 0.01, 1)
+
+	r.IncCounter(SendTotal, Labels{"topic": "t", "status": StatusOK}, 1)
+	r.IncCounter(SendTotal, Labels{"status": StatusOK, "topic": "t"}, 2)
+	r.IncCounter(SendTotal, Labels{"topic": "t", "status": StatusFailed}, 1)
+
+	r.SetGauge(ConsumerLag, Labels{"group": "g", "queue": "1"}, 10)
+	r.SetGauge(ConsumerLag, Labels{"group": "g", "queue": "1"}, 5)
+	r.IncCounter(ConnectionEvents, nil, 1)
+
+	r.ObserveHistogram(SendLatency, Labels{"topic": "t\"\n\\"}, 0.01)
+	r.ObserveHistogram(SendLatency, Labels{"topic": "t\"\n\\"}, 0.5)
+	r.ObserveHistogram(SendLatency, Labels{"topic": "t\"\n\\"}, 2)
+
+	buf := &bytes.Buffer{}
+	n, err := r.WriteTo(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, `# TYPE rocketmq_connection_events_total counter
+rocketmq_connection_events_total 1
+# TYPE rocketmq_consumer_lag gauge
+rocketmq_consumer_lag{group="g",queue="1"} 5
+# TYPE rocketmq_send_latency_seconds histogram
+rocketmq_send_latency_seconds_bucket{topic="t\"\n\\",le="0.01"} 1
+rocketmq_send_latency_seconds_bucket{topic="t\"\n\\",le="0.1"} 1
+rocketmq_send_latency_seconds_bucket{topic="t\"\n\\",le="1"} 2
+rocketmq_send_latency_seconds_bucket{topic="t\"\n\\",le="+Inf"} 3
+rocketmq_send_latency_seconds_sum{topic="t\"\n\\"} 2.51
+rocketmq_send_latency_seconds_count{topic="t\"\n\\"} 3
+# TYPE rocketmq_send_total counter
+rocketmq_send_total{status="failed",topic="t"} 1
+rocketmq_send_total{status="ok",topic="t"} 3
+`, buf.String())
+
+	// handler
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, buf.String(), w.Body.String())
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestRegistryDeleteGauge(t *testing.T) {
+	r := NewRegistry()
+	r.SetGauge(ConsumerLag, Labels{"group": "g", "queue": "1"}, 10)
+	r.SetGauge(ConsumerLag, Labels{"group": "g", "queue": "2"}, 5)
+	r.IncCounter(SendTotal, Labels{"topic": "t"}, 1)
+
+	// not gauge or not exist
+	r.DeleteGauge(SendTotal, Labels{"topic": "t"})
+	r.DeleteGauge(ConsumerLag, Labels{"group": "g", "queue": "3"})
+	assert.Equal(t, 2, len(r.families[ConsumerLag].series))
+	assert.Equal(t, 1, len(r.families[SendTotal].series))
+
+	r.DeleteGauge(ConsumerLag, Labels{"queue": "1", "group": "g"})
+	buf := &bytes.Buffer{}
+	r.WriteTo(buf)
+	assert.Equal(t, `# TYPE rocketmq_consumer_lag gauge
+rocketmq_consumer_lag{group="g",queue="2"} 5
+# TYPE rocketmq_send_total counter
+rocketmq_send_total{topic="t"} 1
+`, buf.String())
+
+	// the metric without gauge is removed
+	r.DeleteGauge(ConsumerLag, Labels{"group": "g", "queue": "2"})
+	_, ok := r.families[ConsumerLag]
+	assert.False(t, ok)
+}
+
+func TestSetSink(t *testing.T) {
+	defer SetSink(nil)
+
+	// nop by default
+	IncCounter(SendTotal, nil, 1)
+
+	r := NewRegistry()
+	SetSink(r)
+	assert.Equal(t, r, GetSink())
+	IncCounter(PullTotal, Labels{"group": "g"}, 1)
+	ObserveHistogram(PullLatency, Labels{"group": "g"}, 0.2)
+	SetGauge(ConsumerLag, Labels{"group": "g"}, 3)
+	assert.Equal(t, 3, len(r.families))
+	assert.Equal(t, float64(1), r.families[PullTotal].series[`{group="g"}`].value)
+	assert.Equal(t, float64(3), r.families[ConsumerLag].series[`{group="g"}`].value)
+	assert.Equal(t, uint64(1), r.families[PullLatency].series[`{group="g"}`].hist.count)
+	DeleteGauge(ConsumerLag, Labels{"group": "g"})
+	assert.Equal(t, 2, len(r.families))
+
+	SetSink(nil)
+	assert.Equal(t, nopSink{}, GetSink())
+}
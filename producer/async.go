@@ -0,0 +1,168 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+)
+
+// SendCallback the function called when the message sent asynchronously is done
+// the result is nil if the error is not nil
+type SendCallback func(*SendResult, error)
+
+// SendFuture the pending result of the message sent asynchronously
+type SendFuture struct {
+	done   chan struct{}
+	result *SendResult
+	err    error
+}
+
+func newSendFuture() *SendFuture {
+	return &SendFuture{done: make(chan struct{})}
+}
+
+func (f *SendFuture) put(r *SendResult, err error) {
+	f.result, f.err = r, err
+	close(f.done)
+}
+
+// Done returns the channel closed when the sending is done
+func (f *SendFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits until the sending is done, then returns the result
+func (f *SendFuture) Get() (*SendResult, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// GetTimeout waits at most the timeout, returns the send timeout error if the sending is not done
+func (f *SendFuture) GetTimeout(timeout time.Duration) (*SendResult, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-time.After(timeout):
+		return nil, errSendTimeout
+	}
+}
+
+// SendAsync sends the message asynchronously, the callback is called when the sending is done
+// the callback is not called if the returned error is not nil
+// the message must not be modified before the callback is called
+func (p *Producer) SendAsync(m *message.Message, callback SendCallback) error {
+	if callback == nil {
+		return errEmptyCallback
+	}
+
+	pi, sysFlag, prevBody, err := p.prepareSend(m)
+	if err != nil {
+		return err
+	}
+
+	s := &asyncSending{
+		p:            p,
+		router:       pi,
+		m:            m,
+		sysFlag:      sysFlag,
+		prevBody:     prevBody,
+		callback:     callback,
+		maxSendCount: p.RetryTimesWhenSendAsyncFailed + 1,
+		startPoint:   time.Now(),
+	}
+	s.send()
+	return nil
+}
+
+// SendAsyncFuture sends the message asynchronously, returns the future of the result
+func (p *Producer) SendAsyncFuture(m *message.Message) (*SendFuture, error) {
+	f := newSendFuture()
+	if err := p.SendAsync(m, f.put); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// asyncSending the state of the message sent asynchronously, retries on another broker
+// when failed, at most maxSendCount times
+type asyncSending struct {
+	p        *Producer
+	router   *topicPublishInfo
+	m        *message.Message
+	sysFlag  int32
+	prevBody []byte
+	callback SendCallback
+
+	maxSendCount int32
+	sendCount    int32
+	prevBroker   string
+	startPoint   time.Time
+}
+
+func (s *asyncSending) send() {
+	q := s.p.mqFaultStrategy.SelectOneQueue(s.router, s.prevBroker)
+	s.sendCount++
+	start := time.Now()
+	err := s.p.sendAsync(s.m, q, s.sysFlag, func(r *SendResult, err error) {
+		s.onSent(q, start, r, err)
+	})
+	if err != nil {
+		s.onSent(q, start, nil, err)
+	}
+}
+
+func (s *asyncSending) onSent(q *message.Queue, start time.Time, r *SendResult, err error) {
+	s.p.recordSend(s.m.Topic, time.Since(start), err)
+	cost := time.Since(start) / time.Millisecond
+	s.prevBroker = q.BrokerName
+	s.p.mqFaultStrategy.UpdateFault(q.BrokerName, int64(cost), err != nil)
+
+	if err == nil {
+		s.done(r, nil)
+		return
+	}
+
+	if s.sendCount < s.maxSendCount {
+		s.p.Logger.Errorf(
+			"resend async %s RT:%dms, Queue:%s, err %s", s.m.GetUniqID(), cost, q, err,
+		)
+		s.send()
+		return
+	}
+
+	s.p.Logger.Errorf("send async %d times, still failed, cost %s, topic:%s, err:%s",
+		s.sendCount, time.Since(s.startPoint), s.m.Topic, err)
+	s.done(nil, err)
+}
+
+func (s *asyncSending) done(r *SendResult, err error) {
+	s.m.Body = s.prevBody
+	s.callback(r, err)
+}
+
+func (p *Producer) sendAsync(
+	m *message.Message, q *message.Queue, sysFlag int32, callback SendCallback,
+) error {
+	addr := p.client.GetMasterBrokerAddr(q.BrokerName)
+	if addr == "" {
+		p.Logger.Errorf("cannot find broker:" + q.BrokerName)
+		return errBrokerNotFound
+	}
+
+	err := rpc.SendMessageAsync(
+		p.client.RemotingClient(), addr, m.Body, p.buildSendHeader(m, q, sysFlag), p.SendMsgTimeout,
+		func(resp *rpc.SendResponse, err error) {
+			if err != nil {
+				p.Logger.Errorf("request send message %s async error:%v", m.String(), err)
+				callback(nil, err)
+				return
+			}
+			callback(p.toSendResult(m, q, resp))
+		},
+	)
+	if err != nil {
+		p.Logger.Errorf("request send message %s async error:%v", m.String(), err)
+	}
+	return err
+}
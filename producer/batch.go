@@ -0,0 +1,110 @@
+package producer
+
+import (
+	"strings"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+)
+
+// SendBatch sends the messages in batch, the messages must have the same topic without delay level
+// the batch is split into several requests when the size of it exceeds the MaxMessageSize,
+// returns the results of the requests sent, one result per request
+func (p *Producer) SendBatch(msgs []*message.Message) ([]*SendResult, error) {
+	if err := checkBatch(msgs); err != nil {
+		return nil, err
+	}
+
+	pi, err := p.getRouters(msgs[0].Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range msgs {
+		m.SetUniqID(message.CreateUniqID())
+	}
+
+	batches, err := splitBatch(msgs, int(p.MaxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*SendResult, 0, len(batches))
+	for _, b := range batches {
+		r, err := p.sendBatch(pi, b)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func checkBatch(msgs []*message.Message) error {
+	if len(msgs) == 0 {
+		return errEmptyBatch
+	}
+
+	for _, m := range msgs {
+		if m == nil {
+			return errEmptyMessage
+		}
+
+		if len(m.Body) == 0 {
+			return errEmptyBody
+		}
+
+		if m.Topic == "" {
+			return errEmptyTopic
+		}
+
+		if m.Topic != msgs[0].Topic {
+			return errMixedTopicsInBatch
+		}
+
+		if m.GetDelayTimeLevel() > 0 {
+			return errDelayInBatch
+		}
+	}
+	return nil
+}
+
+// splitBatch splits the messages, the encoded size of each batch is not greater than the maxSize
+func splitBatch(msgs []*message.Message, maxSize int) ([][]*message.Message, error) {
+	var (
+		batches [][]*message.Message
+		start   int
+		size    int
+	)
+	for i, m := range msgs {
+		s := m.EncodedSize()
+		if s > maxSize {
+			return nil, errMessageTooLarge
+		}
+
+		if size+s > maxSize {
+			batches = append(batches, msgs[start:i])
+			start, size = i, 0
+		}
+		size += s
+	}
+	return append(batches, msgs[start:]), nil
+}
+
+func (p *Producer) sendBatch(router *topicPublishInfo, msgs []*message.Message) (*SendResult, error) {
+	m := &message.Message{Topic: msgs[0].Topic, Body: message.EncodeBatch(msgs)}
+	if !msgs[0].GetWaitStoreMsgOK() {
+		m.SetWaitStoreMsgOK(false)
+	}
+
+	r, err := p.sendMessageWithFault(router, m, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.GetUniqID()
+	}
+	r.UniqID = strings.Join(ids, ",")
+	return r, nil
+}
@@ -0,0 +1,131 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+func TestCheckBatch(t *testing.T) {
+	assert.Equal(t, errEmptyBatch, checkBatch(nil))
+	assert.Equal(t, errEmptyMessage, checkBatch([]*message.Message{nil}))
+	assert.Equal(t, errEmptyBody, checkBatch([]*message.Message{&message.Message{Topic: "t"}}))
+	assert.Equal(t, errEmptyTopic, checkBatch([]*message.Message{&message.Message{Body: []byte("b")}}))
+	assert.Equal(t, errMixedTopicsInBatch, checkBatch([]*message.Message{
+		&message.Message{Topic: "t", Body: []byte("b")},
+		&message.Message{Topic: "t1", Body: []byte("b")},
+	}))
+
+	m := &message.Message{Topic: "t", Body: []byte("b")}
+	m.SetDelayTimeLevel(1)
+	assert.Equal(t, errDelayInBatch, checkBatch([]*message.Message{
+		&message.Message{Topic: "t", Body: []byte("b")}, m,
+	}))
+
+	assert.Nil(t, checkBatch([]*message.Message{
+		&message.Message{Topic: "t", Body: []byte("b")},
+		&message.Message{Topic: "t", Body: []byte("b")},
+	}))
+}
+
+func TestSplitBatch(t *testing.T) {
+	msgs := make([]*message.Message, 5)
+	for i := range msgs {
+		msgs[i] = &message.Message{Topic: "t", Body: []byte("0123456789")}
+	}
+	size := msgs[0].EncodedSize()
+
+	// fit in one batch
+	batches, err := splitBatch(msgs, size*len(msgs))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]*message.Message{msgs}, batches)
+
+	// split
+	batches, err = splitBatch(msgs, size*2+1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]*message.Message{msgs[:2], msgs[2:4], msgs[4:]}, batches)
+
+	batches, err = splitBatch(msgs, size)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(batches))
+
+	// too large
+	_, err = splitBatch(msgs, size-1)
+	assert.Equal(t, errMessageTooLarge, err)
+}
+
+func TestSendBatch(t *testing.T) {
+	p := NewProducer("sendBatch", []string{"abc"}, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "b1 addr"}, p: p}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	msgs := make([]*message.Message, 5)
+	for i := range msgs {
+		msgs[i] = &message.Message{Topic: "send batch", Body: []byte("0123456789")}
+	}
+
+	// no routers
+	_, err := p.SendBatch(msgs)
+	assert.Equal(t, errNoRouters, err)
+
+	mc.p.UpdateTopicPublish(msgs[0].Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+		},
+	})
+	mc.mqClient.command.ExtFields = map[string]string{
+		"msgId":       "1",
+		"queueOffset": "111",
+		"queueId":     "0",
+	}
+
+	// one request
+	rs, err := p.SendBatch(msgs)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, OK, rs[0].Status)
+	ids := ""
+	for i, m := range msgs {
+		assert.True(t, m.GetUniqID() != "")
+		if i > 0 {
+			ids += ","
+		}
+		ids += m.GetUniqID()
+	}
+	assert.Equal(t, ids, rs[0].UniqID)
+
+	assert.Equal(t, 1, len(mc.mqClient.requestSyncCommands))
+	cmd := mc.mqClient.requestSyncCommands[0]
+	assert.Equal(t, rpc.SendBatchMessage, cmd.Code)
+	assert.Equal(t, "true", cmd.ExtFields["batch"])
+	assert.Equal(t, msgs[0].Topic, cmd.ExtFields["topic"])
+	assert.Equal(t, message.EncodeBatch(msgs), cmd.Body)
+
+	// split
+	mc.mqClient.requestSyncCommands = nil
+	p.MaxMessageSize = int32(msgs[0].EncodedSize() * 2)
+	rs, err = p.SendBatch(msgs)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(rs))
+	assert.Equal(t, 3, len(mc.mqClient.requestSyncCommands))
+	assert.Equal(t, message.EncodeBatch(msgs[:2]), mc.mqClient.requestSyncCommands[0].Body)
+	assert.Equal(t, message.EncodeBatch(msgs[2:4]), mc.mqClient.requestSyncCommands[1].Body)
+	assert.Equal(t, message.EncodeBatch(msgs[4:]), mc.mqClient.requestSyncCommands[2].Body)
+	assert.Equal(t, msgs[4].GetUniqID(), rs[2].UniqID)
+
+	// too large
+	p.MaxMessageSize = 1
+	_, err = p.SendBatch(msgs)
+	assert.Equal(t, errMessageTooLarge, err)
+}
@@ -0,0 +1,203 @@
+package producer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+)
+
+const (
+	brokerConfigDelayLevel = "messageDelayLevel"
+
+	// the interval of requesting the delay levels again after failed
+	delayLevelsRetryInterval = 30 * time.Second
+)
+
+// delayLevelTable caches the delay levels of the broker, the first element is the delay of level 1,
+// and the error of requesting them, which is returned before retrying
+type delayLevelTable struct {
+	sync.RWMutex
+	levels   []time.Duration
+	err      error
+	failTime time.Time
+}
+
+// get returns the cached levels, or the error failed within the retry interval
+func (t *delayLevelTable) get(now time.Time) ([]time.Duration, error) {
+	t.RLock()
+	levels, err := t.levels, t.err
+	if err != nil && now.Sub(t.failTime) >= delayLevelsRetryInterval {
+		err = nil
+	}
+	t.RUnlock()
+	return levels, err
+}
+
+func (t *delayLevelTable) put(levels []time.Duration) {
+	t.Lock()
+	t.levels, t.err = levels, nil
+	t.Unlock()
+}
+
+func (t *delayLevelTable) putError(err error, now time.Time) {
+	t.Lock()
+	t.err, t.failTime = err, now
+	t.Unlock()
+}
+
+// SendAfter sends the message which is delivered to the consumer after the delay,
+// the delay is mapped to the nearest delay level of the broker
+func (p *Producer) SendAfter(m *message.Message, delay time.Duration) (*SendResult, error) {
+	if m == nil {
+		return nil, errEmptyMessage
+	}
+
+	if delay <= 0 {
+		return nil, errBadDelay
+	}
+
+	levels, err := p.delayLevels(m.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := nearestDelayLevel(levels, delay)
+	if err != nil {
+		return nil, err
+	}
+
+	m.SetDelayTimeLevel(l)
+	return p.SendSync(m)
+}
+
+// SendAt sends the message which is delivered to the consumer at the time,
+// the time is mapped to the nearest delay level of the broker
+func (p *Producer) SendAt(m *message.Message, t time.Time) (*SendResult, error) {
+	return p.SendAfter(m, time.Until(t))
+}
+
+// checkDelayLevel returns error if the delay level of the message is out of the range of the broker's
+// the message without delay level, or the delay levels of broker are unknown is always ok
+func (p *Producer) checkDelayLevel(m *message.Message) error {
+	l := m.GetDelayTimeLevel()
+	if l == 0 {
+		return nil
+	}
+
+	if l < 0 {
+		return errBadDelayLevel
+	}
+
+	levels, err := p.delayLevels(m.Topic)
+	if err != nil {
+		return nil
+	}
+
+	if l > len(levels) {
+		return errBadDelayLevel
+	}
+	return nil
+}
+
+// delayLevels returns the delay levels, requests from one master broker of the topic if not cached,
+// the failure of the broker is cached for delayLevelsRetryInterval
+func (p *Producer) delayLevels(topic string) ([]time.Duration, error) {
+	if levels, err := p.delayLevelTable.get(time.Now()); levels != nil || err != nil {
+		return levels, err
+	}
+
+	pi, err := p.getRouters(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := ""
+	for _, q := range pi.queues {
+		if addr = p.client.GetMasterBrokerAddr(q.BrokerName); addr != "" {
+			break
+		}
+	}
+	if addr == "" {
+		return nil, errBrokerNotFound
+	}
+
+	config, err := rpc.BrokerConfig(p.client.RemotingClient(), addr, p.SendMsgTimeout)
+	if err != nil {
+		p.Logger.Warnf(
+			"get delay levels from broker:%s error:%s, retry after %s", addr, err, delayLevelsRetryInterval,
+		)
+		p.delayLevelTable.putError(err, time.Now())
+		return nil, err
+	}
+
+	levels, err := parseDelayLevels(config[brokerConfigDelayLevel])
+	if err != nil {
+		p.Logger.Errorf("bad delay levels from broker:%s, levels:%s", addr, config[brokerConfigDelayLevel])
+		p.delayLevelTable.putError(err, time.Now())
+		return nil, err
+	}
+
+	p.delayLevelTable.put(levels)
+	return levels, nil
+}
+
+// parseDelayLevels parses the delay levels like "1s 5s 10m 2h 1d"
+func parseDelayLevels(s string) ([]time.Duration, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errNoDelayLevels
+	}
+
+	levels := make([]time.Duration, len(fields))
+	for i, f := range fields {
+		var unit time.Duration
+		switch f[len(f)-1] {
+		case 's':
+			unit = time.Second
+		case 'm':
+			unit = time.Minute
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		default:
+			return nil, errNoDelayLevels
+		}
+
+		n, err := strconv.ParseInt(f[:len(f)-1], 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errNoDelayLevels
+		}
+		levels[i] = time.Duration(n) * unit
+	}
+	return levels, nil
+}
+
+// nearestDelayLevel returns the level whose delay is nearest to the specified one, the later one is returned
+// if there are two, returns error if the delay is longer than the max delay
+func nearestDelayLevel(levels []time.Duration, delay time.Duration) (int, error) {
+	if len(levels) == 0 {
+		return 0, errNoDelayLevels
+	}
+
+	if delay > levels[len(levels)-1] {
+		return 0, errDelayTooLong
+	}
+
+	l, diff := 0, time.Duration(-1)
+	for i, d := range levels {
+		dd := d - delay
+		if dd < 0 {
+			dd = -dd
+		}
+
+		if diff < 0 || dd <= diff {
+			l, diff = i+1, dd
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,145 @@
+package producer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+const testDelayLevels = "1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h"
+
+func TestParseDelayLevels(t *testing.T) {
+	levels, err := parseDelayLevels(testDelayLevels)
+	assert.Nil(t, err)
+	assert.Equal(t, 18, len(levels))
+	assert.Equal(t, time.Second, levels[0])
+	assert.Equal(t, 10*time.Minute, levels[13])
+	assert.Equal(t, 2*time.Hour, levels[17])
+
+	levels, err = parseDelayLevels(" 1d ")
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{24 * time.Hour}, levels)
+
+	for _, s := range []string{"", "1", "1x", "xs", "0s", "-1s"} {
+		_, err = parseDelayLevels(s)
+		assert.Equal(t, errNoDelayLevels, err, s)
+	}
+}
+
+func TestNearestDelayLevel(t *testing.T) {
+	levels, _ := parseDelayLevels(testDelayLevels)
+
+	_, err := nearestDelayLevel(nil, time.Second)
+	assert.Equal(t, errNoDelayLevels, err)
+
+	_, err = nearestDelayLevel(levels, 2*time.Hour+time.Second)
+	assert.Equal(t, errDelayTooLong, err)
+
+	for d, l := range map[time.Duration]int{
+		time.Millisecond:                1,
+		time.Second:                     1,
+		3 * time.Second:                 2,
+		2 * time.Second:                 1,
+		10 * time.Minute:                14,
+		15 * time.Minute:                15,
+		14 * time.Minute:                14,
+		90 * time.Minute:                18,
+		89 * time.Minute:                17,
+		2 * time.Hour:                   18,
+		10*time.Minute + time.Second*20: 14,
+	} {
+		got, err := nearestDelayLevel(levels, d)
+		assert.Nil(t, err)
+		assert.Equal(t, l, got, d.String())
+	}
+}
+
+func TestSendAfter(t *testing.T) {
+	p := NewProducer("sendAfter", []string{"abc"}, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "b1 addr"}, p: p}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	m := &message.Message{Topic: "test send after", Body: []byte("after")}
+
+	_, err := p.SendAfter(nil, time.Minute)
+	assert.Equal(t, errEmptyMessage, err)
+
+	_, err = p.SendAt(m, time.Now().Add(-time.Second))
+	assert.Equal(t, errBadDelay, err)
+
+	// no routers
+	_, err = p.SendAfter(m, time.Minute)
+	assert.Equal(t, errNoRouters, err)
+
+	p.UpdateTopicPublish(m.Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+		},
+	})
+
+	// bad delay levels
+	mc.mqClient.command.Body = []byte("brokerName=b1\n")
+	_, err = p.SendAfter(m, time.Minute)
+	assert.Equal(t, errNoDelayLevels, err)
+
+	// the failure is cached before retrying
+	mc.mqClient.requestSyncCommands = nil
+	_, err = p.SendAfter(m, time.Minute)
+	assert.Equal(t, errNoDelayLevels, err)
+	m.SetDelayTimeLevel(1)
+	p.SendSync(m)
+	for _, c := range mc.mqClient.requestSyncCommands {
+		assert.NotEqual(t, rpc.GetBrokerConfig, c.Code)
+	}
+	p.delayLevelTable.failTime = time.Now().Add(-delayLevelsRetryInterval)
+
+	// ok, the delay levels are requested once
+	mc.mqClient.requestSyncCommands = nil
+	mc.mqClient.command.Body = []byte("brokerName=b1\nmessageDelayLevel=" + testDelayLevels + "\n")
+	mc.mqClient.command.ExtFields = map[string]string{
+		"msgId":       "1",
+		"queueOffset": "11",
+		"MSG_REGION":  "RegionID",
+		"TRACE_ON":    "true",
+		"queueId":     "1",
+	}
+	sr, err := p.SendAfter(m, 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, OK, sr.Status)
+	assert.Equal(t, 14, m.GetDelayTimeLevel())
+	assert.Equal(t, 2, len(mc.mqClient.requestSyncCommands))
+	assert.Equal(t, rpc.GetBrokerConfig, mc.mqClient.requestSyncCommands[0].Code)
+	props := message.String2Properties(mc.mqClient.requestSyncCommands[1].ExtFields["properties"])
+	assert.Equal(t, "14", props[message.PropertyDelayTimeLevel])
+
+	_, err = p.SendAt(m, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 17, m.GetDelayTimeLevel())
+	assert.Equal(t, 3, len(mc.mqClient.requestSyncCommands))
+
+	_, err = p.SendAfter(m, 3*time.Hour)
+	assert.Equal(t, errDelayTooLong, err)
+
+	// check the level of the message
+	m.SetDelayTimeLevel(19)
+	_, err = p.SendSync(m)
+	assert.Equal(t, errBadDelayLevel, err)
+	m.SetDelayTimeLevel(-1)
+	_, err = p.SendSync(m)
+	assert.Equal(t, errBadDelayLevel, err)
+	m.SetDelayTimeLevel(18)
+	_, err = p.SendSync(m)
+	assert.Nil(t, err)
+}
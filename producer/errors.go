@@ -7,4 +7,21 @@ var (
 	errEmptyTopic   = errors.New("empty topic")
 	errEmptyBody    = errors.New("empty body")
 	errNoRouters    = errors.New("no routers")
+
+	errBrokerNotFound = errors.New("cannot find broker")
+	errEmptyCallback  = errors.New("empty callback")
+	errSendTimeout    = errors.New("send timeout")
+
+	errEmptyBatch         = errors.New("empty batch")
+	errMixedTopicsInBatch = errors.New("mixed topics in batch")
+	errDelayInBatch       = errors.New("delay level is not supported in batch")
+	errMessageTooLarge    = errors.New("message too large")
+
+	errEmptySelector   = errors.New("empty selector")
+	errNoQueueSelected = errors.New("no queue selected")
+
+	errBadDelay      = errors.New("bad delay")
+	errDelayTooLong  = errors.New("delay too long")
+	errBadDelayLevel = errors.New("bad delay level")
+	errNoDelayLevels = errors.New("no delay levels")
 )
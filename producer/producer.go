@@ -1,7 +1,8 @@
 package producer
 
 import (
-	"errors"
+	"bytes"
+	"compress/zlib"
 	"fmt"
 	"os"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"github.com/zjykzk/rocketmq-client-go/client"
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/metrics"
 	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
 	"github.com/zjykzk/rocketmq-client-go/route"
 )
@@ -21,6 +23,7 @@ type Config struct {
 	rocketmq.Client
 	SendMsgTimeout                   time.Duration
 	CompressSizeThreshod             int32
+	CompressLevel                    int
 	RetryTimesWhenSendFailed         int32
 	RetryTimesWhenSendAsyncFailed    int32
 	RetryAnotherBrokerWhenNotStoreOK bool
@@ -38,6 +41,7 @@ var defaultConfig = Config{
 	},
 	SendMsgTimeout:                   3 * time.Second,
 	CompressSizeThreshod:             1 << 12, // 4K
+	CompressLevel:                    5,
 	RetryTimesWhenSendFailed:         2,
 	RetryTimesWhenSendAsyncFailed:    2,
 	RetryAnotherBrokerWhenNotStoreOK: false,
@@ -53,6 +57,9 @@ type Producer struct {
 	topicPublishInfos topicPublishInfoTable
 	client            client.MQClient
 	mqFaultStrategy   *MQFaultStrategy
+	delayLevelTable   delayLevelTable
+
+	transactionListener TransactionListener
 
 	Logger log.Logger
 }
@@ -135,6 +142,20 @@ func (p *Producer) Unpublish(topic string) bool {
 // the router must not be nil
 func (p *Producer) UpdateTopicPublish(topic string, router *route.TopicRouter) {
 	p.Logger.Debugf("update topic publish %s %s", topic, router.String())
+	tp := &topicPublishInfo{router: router, haveTopicRouterInfo: true}
+	if router.OrderTopicConf != "" {
+		tp.orderTopic, tp.queues = true, p.orderTopicQueues(topic, router.OrderTopicConf)
+	} else {
+		tp.queues = writableQueues(topic, router)
+	}
+
+	prev := p.topicPublishInfos.put(topic, tp)
+	if prev != nil {
+		p.Logger.Info("UpdateTopicPublish prev is not null, " + prev.String())
+	}
+}
+
+func writableQueues(topic string, router *route.TopicRouter) []*message.Queue {
 	route.SortTopicQueue(router.Queues) // for the select consume queue is not duplicated by brokername
 	qs := make([]*message.Queue, 0, 8)
 	for _, q := range router.Queues {
@@ -162,18 +183,31 @@ func (p *Producer) UpdateTopicPublish(topic string, router *route.TopicRouter) {
 			qs = append(qs, &message.Queue{Topic: topic, BrokerName: b.Name, QueueID: uint8(i)})
 		}
 	}
+	return qs
+}
 
-	tp := &topicPublishInfo{
-		orderTopic:          false, // NOTE: unsupport the order now
-		router:              router,
-		queues:              qs,
-		haveTopicRouterInfo: true,
-	}
+// orderTopicQueues returns the queues of the order topic
+// the format of the conf is "brokerName:queueCount;brokerName:queueCount"
+func (p *Producer) orderTopicQueues(topic, conf string) []*message.Queue {
+	qs := make([]*message.Queue, 0, 8)
+	for _, b := range strings.Split(conf, ";") {
+		items := strings.Split(b, ":")
+		if len(items) != 2 {
+			p.Logger.Errorf("bad order topic conf:%s of topic:%s", conf, topic)
+			continue
+		}
 
-	prev := p.topicPublishInfos.put(topic, tp)
-	if prev != nil {
-		p.Logger.Info("UpdateTopicPublish prev is not null, " + prev.String())
+		n, err := strconv.Atoi(items[1])
+		if err != nil {
+			p.Logger.Errorf("bad queue count of order topic conf:%s of topic:%s", conf, topic)
+			continue
+		}
+
+		for i := 0; i < n; i++ {
+			qs = append(qs, &message.Queue{Topic: topic, BrokerName: items[0], QueueID: uint8(i)})
+		}
 	}
+	return qs
 }
 
 // NeedUpdateTopicPublish returns true if the published topic's consume queue is empty
@@ -186,31 +220,73 @@ func (p *Producer) NeedUpdateTopicPublish(topic string) bool {
 // SendSync sends the message
 // the message must not be nil
 func (p *Producer) SendSync(m *message.Message) (sendResult *SendResult, err error) {
+	pi, sysFlag, prevBody, err := p.prepareSend(m)
+	if err != nil {
+		return nil, err
+	}
+
+	sendResult, err = p.sendMessageWithFault(pi, m, sysFlag, false)
+	m.Body = prevBody
+	return
+}
+
+// SendOneway sends the message without waiting for the response of the broker
+// the message must not be nil
+func (p *Producer) SendOneway(m *message.Message) error {
+	pi, sysFlag, prevBody, err := p.prepareSend(m)
+	if err != nil {
+		return err
+	}
+
+	q := p.mqFaultStrategy.SelectOneQueue(pi, "")
+	start := time.Now()
+	err = p.sendOneway(m, q, sysFlag)
+	p.mqFaultStrategy.UpdateFault(q.BrokerName, int64(time.Since(start)/time.Millisecond), err != nil)
+	p.recordSend(m.Topic, time.Since(start), err)
+	m.Body = prevBody
+	return err
+}
+
+// prepareSend checks the message and compresses the body if necessary,
+// returns the original body which should be restored after sending
+func (p *Producer) prepareSend(m *message.Message) (
+	pi *topicPublishInfo, sysFlag int32, prevBody []byte, err error,
+) {
 	if m == nil {
-		return nil, errEmptyMessage
+		err = errEmptyMessage
+		return
 	}
 
 	if len(m.Body) == 0 {
-		return nil, errEmptyBody
+		err = errEmptyBody
+		return
 	}
 
 	if m.Topic == "" {
-		return nil, errEmptyTopic
+		err = errEmptyTopic
+		return
 	}
 
-	pi, err := p.getRouters(m.Topic)
+	pi, err = p.getRouters(m.Topic)
 	if err != nil {
-		return nil, err
+		return
+	}
+
+	if err = p.checkDelayLevel(m); err != nil {
+		return
 	}
 
 	m.SetUniqID(message.CreateUniqID())
 
-	sysFlag := int32(0)
+	if m.GetProperty(message.PropertyTransactionPrepared) == "true" {
+		sysFlag |= message.TransactionPreparedType
+	}
+
+	prevBody = m.Body
 	if p.tryToCompress(m) {
 		sysFlag |= message.Compress
 	}
-
-	return p.sendMessageWithFault(pi, m, sysFlag)
+	return
 }
 
 func (p *Producer) getRouters(topic string) (*topicPublishInfo, error) {
@@ -237,7 +313,7 @@ func (p *Producer) getRouters(topic string) (*topicPublishInfo, error) {
 }
 
 func (p *Producer) sendMessageWithFault(
-	router *topicPublishInfo, m *message.Message, sysFlag int32,
+	router *topicPublishInfo, m *message.Message, sysFlag int32, batch bool,
 ) (
 	sendResult *SendResult, err error,
 ) {
@@ -245,16 +321,16 @@ func (p *Producer) sendMessageWithFault(
 		q           *message.Queue
 		brokersSent = make([]string, p.RetryTimesWhenSendFailed+1)
 		retryCount  = int32(1)
-		prevBody    = m.Body
 	)
 
 	startPoint := time.Now()
 	prev := startPoint
 	for maxSendCount := p.RetryTimesWhenSendFailed + 1; retryCount < maxSendCount; retryCount++ {
 		q = p.mqFaultStrategy.SelectOneQueue(router, brokersSent[retryCount-1])
-		sendResult, err = p.sendSync(m, q, sysFlag)
+		sendResult, err = p.sendSync(m, q, sysFlag, batch)
 
 		now := time.Now()
+		p.recordSend(m.Topic, now.Sub(prev), err)
 		cost := now.Sub(prev) / 10e6
 
 		prev = now
@@ -270,36 +346,71 @@ func (p *Producer) sendMessageWithFault(
 		}
 
 		p.mqFaultStrategy.UpdateFault(q.BrokerName, int64(cost), false)
-		goto END
+		return
 	}
 
 	p.Logger.Errorf("send %d times, still failed, cost %s, topic:%s, sendBrokers:%v",
 		retryCount-1, time.Now().Sub(startPoint), m.Topic, brokersSent[1:])
-END:
-	m.Body = prevBody
-
 	return
 }
 
-func (p *Producer) sendSync(m *message.Message, q *message.Queue, sysFlag int32) (
+// recordSend emits the metrics of one sending request
+func (p *Producer) recordSend(topic string, cost time.Duration, err error) {
+	status := metrics.StatusOK
+	if err != nil {
+		status = metrics.StatusFailed
+	}
+	metrics.IncCounter(
+		metrics.SendTotal, metrics.Labels{"group": p.GroupName, "topic": topic, "status": status}, 1,
+	)
+	metrics.ObserveHistogram(
+		metrics.SendLatency, metrics.Labels{"group": p.GroupName, "topic": topic}, cost.Seconds(),
+	)
+}
+
+func (p *Producer) sendSync(m *message.Message, q *message.Queue, sysFlag int32, batch bool) (
 	*SendResult, error,
 ) {
 	addr := p.client.GetMasterBrokerAddr(q.BrokerName)
 	if addr == "" {
 		p.Logger.Errorf("cannot find broker:" + q.BrokerName)
-		return nil, errors.New("cannot find broker")
+		return nil, errBrokerNotFound
 	}
 
 	println("=============", q.BrokerName, addr)
 
+	header := p.buildSendHeader(m, q, sysFlag)
+	header.Batch = batch
 	resp, err := rpc.SendMessageSync(
-		p.client.RemotingClient(), addr, m.Body, p.buildSendHeader(m, q, sysFlag), p.SendMsgTimeout,
+		p.client.RemotingClient(), addr, m.Body, header, p.SendMsgTimeout,
 	)
 	if err != nil {
 		p.Logger.Errorf("request send message %s sync error:%v", m.String(), err)
 		return nil, err
 	}
 
+	return p.toSendResult(m, q, resp)
+}
+
+func (p *Producer) sendOneway(m *message.Message, q *message.Queue, sysFlag int32) error {
+	addr := p.client.GetMasterBrokerAddr(q.BrokerName)
+	if addr == "" {
+		p.Logger.Errorf("cannot find broker:" + q.BrokerName)
+		return errBrokerNotFound
+	}
+
+	err := rpc.SendMessageOneway(
+		p.client.RemotingClient(), addr, m.Body, p.buildSendHeader(m, q, sysFlag),
+	)
+	if err != nil {
+		p.Logger.Errorf("request send message %s oneway error:%v", m.String(), err)
+	}
+	return err
+}
+
+func (p *Producer) toSendResult(m *message.Message, q *message.Queue, resp *rpc.SendResponse) (
+	*SendResult, error,
+) {
 	var sendResult *SendResult
 	switch resp.Code {
 	case rpc.FlushDiskTimeout:
@@ -367,6 +478,30 @@ func (p *Producer) buildSendHeader(m *message.Message, q *message.Queue, sysFlag
 	return
 }
 
+// tryToCompress compresses the body with zlib when the size of it exceeds the threshold
+// returns true if the body is replaced with the compressed one
 func (p *Producer) tryToCompress(m *message.Message) bool {
-	return false // TODO
+	if len(m.Body) < int(p.CompressSizeThreshod) {
+		return false
+	}
+
+	var b bytes.Buffer
+	z, err := zlib.NewWriterLevel(&b, p.CompressLevel)
+	if err != nil {
+		p.Logger.Errorf("compress with level %d error:%s", p.CompressLevel, err)
+		return false
+	}
+
+	if _, err = z.Write(m.Body); err != nil {
+		p.Logger.Errorf("compress message %s error:%s", m.GetUniqID(), err)
+		return false
+	}
+
+	if err = z.Close(); err != nil {
+		p.Logger.Errorf("compress message %s error:%s", m.GetUniqID(), err)
+		return false
+	}
+
+	m.Body = b.Bytes()
+	return true
 }
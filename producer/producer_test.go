@@ -1,7 +1,12 @@
 package producer
 
 import (
+	"bytes"
+	"compress/zlib"
 	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,8 +58,22 @@ func TestSendHeader(t *testing.T) {
 type mockRemoteClient struct {
 	*remote.MockClient
 
-	requestSyncErr error
-	command        remote.Command
+	requestSyncErr      error
+	command             remote.Command
+	requestSyncCommands []*remote.Command
+
+	requestAsyncErr   error
+	requestAsyncCount int
+	callbackErr       error
+
+	requestOnewayErr error
+	onewayCommand    *remote.Command
+	onewayAddr       string
+}
+
+func (m *mockRemoteClient) RequestOneway(addr string, cmd *remote.Command) error {
+	m.onewayAddr, m.onewayCommand = addr, cmd
+	return m.requestOnewayErr
 }
 
 func (m *mockRemoteClient) RequestSync(
@@ -62,9 +81,26 @@ func (m *mockRemoteClient) RequestSync(
 ) (
 	*remote.Command, error,
 ) {
+	m.requestSyncCommands = append(m.requestSyncCommands, cmd)
 	return &m.command, m.requestSyncErr
 }
 
+func (m *mockRemoteClient) RequestAsync(
+	addr string, cmd *remote.Command, timeout time.Duration, callback func(*remote.Command, error),
+) error {
+	m.requestAsyncCount++
+	if m.requestAsyncErr != nil {
+		return m.requestAsyncErr
+	}
+
+	if m.callbackErr != nil {
+		callback(nil, m.callbackErr)
+	} else {
+		callback(&m.command, nil)
+	}
+	return nil
+}
+
 type mockMQClient struct {
 	*client.EmptyMQClient
 	mqClient mockRemoteClient
@@ -94,13 +130,13 @@ func TestSendSync0(t *testing.T) {
 	p.client = mockMQClient
 
 	// no broker
-	sr, err := p.sendSync(&message.Message{}, &message.Queue{BrokerName: "not exist"}, 123)
+	sr, err := p.sendSync(&message.Message{}, &message.Queue{BrokerName: "not exist"}, 123, false)
 	assert.NotNil(t, err)
 	assert.Equal(t, "cannot find broker", err.Error())
 
 	// bad send
 	mockRemoteClient.requestSyncErr = errors.New("bad request")
-	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123)
+	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123, false)
 	assert.NotNil(t, err)
 	assert.Equal(t, remote.RequestError(mockRemoteClient.requestSyncErr), err)
 	mockRemoteClient.requestSyncErr = nil
@@ -114,7 +150,7 @@ func TestSendSync0(t *testing.T) {
 		"TRACE_ON":    "true",
 		"queueId":     "3",
 	}
-	sr, err = p.sendSync(&message.Message{}, q, 123)
+	sr, err = p.sendSync(&message.Message{}, q, 123, false)
 	assert.Nil(t, err)
 	assert.Equal(t, OK, sr.Status)
 	assert.Equal(t, "1", sr.OffsetID)
@@ -125,19 +161,19 @@ func TestSendSync0(t *testing.T) {
 
 	// disk timeout
 	mockRemoteClient.command.Code = rpc.FlushDiskTimeout
-	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123)
+	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123, false)
 	assert.Nil(t, err)
 	assert.Equal(t, FlushDiskTimeout, sr.Status)
 
 	// slave timeout
 	mockRemoteClient.command.Code = rpc.FlushSlaveTimeout
-	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123)
+	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123, false)
 	assert.Nil(t, err)
 	assert.Equal(t, FlushSlaveTimeout, sr.Status)
 
 	// slave not available
 	mockRemoteClient.command.Code = rpc.SlaveNotAvailable
-	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123)
+	sr, err = p.sendSync(&message.Message{}, &message.Queue{BrokerName: "ok"}, 123, false)
 	assert.Nil(t, err)
 	assert.Equal(t, SlaveNotAvailable, sr.Status)
 }
@@ -274,3 +310,221 @@ func TestUpdateTopicRouter(t *testing.T) {
 		assert.Equal(t, uint8(i), q.QueueID)
 	}
 }
+
+func TestSendAsync(t *testing.T) {
+	p := NewProducer("sendAsync", []string{"abc"}, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "ok", "b2": "b2"}, p: p}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	// empty callback
+	err := p.SendAsync(&message.Message{}, nil)
+	assert.Equal(t, errEmptyCallback, err)
+
+	// empty message
+	err = p.SendAsync(nil, func(*SendResult, error) {})
+	assert.Equal(t, errEmptyMessage, err)
+
+	m := &message.Message{Topic: "test send async topic", Body: []byte("test send async body")}
+	mc.p.UpdateTopicPublish(m.Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+			&route.TopicQueue{BrokerName: "b2", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "ok"}},
+			&route.Broker{Cluster: "c", Name: "b2", Addresses: map[int32]string{0: "b2"}},
+		},
+	})
+	mc.mqClient.command.ExtFields = map[string]string{
+		"msgId":       "1",
+		"queueOffset": "111",
+		"queueId":     "3",
+	}
+
+	// ok
+	var (
+		sr    *SendResult
+		cbErr error
+		count int
+	)
+	err = p.SendAsync(m, func(r *SendResult, e error) { sr, cbErr, count = r, e, count+1 })
+	assert.Nil(t, err)
+	assert.Nil(t, cbErr)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, OK, sr.Status)
+	assert.Equal(t, int64(111), sr.QueueOffset)
+	assert.Equal(t, m.GetUniqID(), sr.UniqID)
+
+	// future
+	f, err := p.SendAsyncFuture(m)
+	assert.Nil(t, err)
+	sr, err = f.GetTimeout(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, OK, sr.Status)
+
+	// response failed, retry
+	mc.mqClient.requestAsyncCount, count = 0, 0
+	mc.mqClient.callbackErr = errors.New("bad response")
+	p.RetryTimesWhenSendAsyncFailed = 2
+	err = p.SendAsync(m, func(r *SendResult, e error) { sr, cbErr, count = r, e, count+1 })
+	assert.Nil(t, err)
+	assert.Equal(t, remote.RequestError(mc.mqClient.callbackErr), cbErr)
+	assert.Nil(t, sr)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 3, mc.mqClient.requestAsyncCount)
+	mc.mqClient.callbackErr = nil
+
+	// request failed, retry
+	mc.mqClient.requestAsyncCount = 0
+	mc.mqClient.requestAsyncErr = errors.New("bad request")
+	f, err = p.SendAsyncFuture(m)
+	assert.Nil(t, err)
+	sr, err = f.Get()
+	assert.Equal(t, remote.RequestError(mc.mqClient.requestAsyncErr), err)
+	assert.Nil(t, sr)
+	assert.Equal(t, 3, mc.mqClient.requestAsyncCount)
+	mc.mqClient.requestAsyncErr = nil
+}
+
+func TestSendFuture(t *testing.T) {
+	f := newSendFuture()
+	_, err := f.GetTimeout(time.Millisecond)
+	assert.Equal(t, errSendTimeout, err)
+
+	go f.put(&SendResult{Status: FlushDiskTimeout}, nil)
+	<-f.Done()
+	sr, err := f.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, FlushDiskTimeout, sr.Status)
+}
+
+func TestSendOneway(t *testing.T) {
+	p := NewProducer("sendOneway", []string{"abc"}, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "b1 addr"}, p: p}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	// empty message
+	assert.Equal(t, errEmptyMessage, p.SendOneway(nil))
+	m := &message.Message{}
+	assert.Equal(t, errEmptyBody, p.SendOneway(m))
+	m.Body = []byte("test send oneway body")
+	assert.Equal(t, errEmptyTopic, p.SendOneway(m))
+	m.Topic = "test send oneway topic"
+
+	// no routers
+	assert.Equal(t, errNoRouters, p.SendOneway(m))
+	assert.Nil(t, mc.mqClient.onewayCommand)
+
+	mc.p.UpdateTopicPublish(m.Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+		},
+	})
+
+	// ok
+	assert.Nil(t, p.SendOneway(m))
+	cmd := mc.mqClient.onewayCommand
+	assert.Equal(t, "b1 addr", mc.mqClient.onewayAddr)
+	assert.Equal(t, rpc.SendMessage, cmd.Code)
+	assert.Equal(t, m.Body, cmd.Body)
+	assert.Equal(t, m.Topic, cmd.ExtFields["topic"])
+	assert.Equal(t, p.GroupName, cmd.ExtFields["producerGroup"])
+	assert.True(t, m.GetUniqID() != "")
+	assert.Equal(t, m.GetUniqID(), message.String2Properties(cmd.ExtFields["properties"])[message.PropertyUniqClientMessageIDKeyidx])
+	assert.True(t, p.mqFaultStrategy.Available("b1"))
+
+	// request failed
+	mc.mqClient.requestOnewayErr = errors.New("bad oneway")
+	assert.Equal(t, remote.RequestError(mc.mqClient.requestOnewayErr), p.SendOneway(m))
+	assert.False(t, p.mqFaultStrategy.Available("b1"))
+	mc.mqClient.requestOnewayErr = nil
+
+	// broker not found
+	delete(mc.brokerAddr, "b1")
+	assert.Equal(t, errBrokerNotFound, p.SendOneway(m))
+}
+
+func TestTryToCompress(t *testing.T) {
+	p := NewProducer("compress", []string{"abc"}, &log.MockLogger{})
+	p.CompressSizeThreshod = 10
+
+	// less than the threshold
+	m := &message.Message{Body: []byte("012345678")}
+	assert.False(t, p.tryToCompress(m))
+	assert.Equal(t, []byte("012345678"), m.Body)
+
+	// compressed
+	body := []byte(strings.Repeat("0123456789", 100))
+	m.Body = body
+	assert.True(t, p.tryToCompress(m))
+	assert.True(t, len(m.Body) < len(body))
+	z, err := zlib.NewReader(bytes.NewReader(m.Body))
+	assert.Nil(t, err)
+	d, err := ioutil.ReadAll(z)
+	assert.Nil(t, err)
+	assert.Equal(t, body, d)
+
+	// bad level
+	p.CompressLevel = 100
+	m.Body = body
+	assert.False(t, p.tryToCompress(m))
+	assert.Equal(t, body, m.Body)
+}
+
+func TestSendCompressed(t *testing.T) {
+	p := NewProducer("sendCompressed", []string{"abc"}, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "b1 addr"}, p: p}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	body := []byte(strings.Repeat("0123456789", 100))
+	m := &message.Message{Topic: "send compressed", Body: body}
+	p.CompressSizeThreshod = 100
+	mc.p.UpdateTopicPublish(m.Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+		},
+	})
+	mc.mqClient.command.ExtFields = map[string]string{
+		"msgId":       "1",
+		"queueOffset": "111",
+		"queueId":     "0",
+	}
+
+	// sync
+	_, err := p.SendSync(m)
+	assert.Nil(t, err)
+	assert.Equal(t, body, m.Body)
+	cmd := mc.mqClient.requestSyncCommands[0]
+	assert.Equal(t, strconv.Itoa(message.Compress), cmd.ExtFields["sysFlag"])
+	assert.True(t, len(cmd.Body) < len(body))
+
+	// oneway
+	assert.Nil(t, p.SendOneway(m))
+	assert.Equal(t, body, m.Body)
+	assert.Equal(t, strconv.Itoa(message.Compress), mc.mqClient.onewayCommand.ExtFields["sysFlag"])
+
+	// async
+	assert.Nil(t, p.SendAsync(m, func(*SendResult, error) {}))
+	assert.Equal(t, body, m.Body)
+
+	// not compressed
+	p.CompressSizeThreshod = int32(len(body) + 1)
+	assert.Nil(t, p.SendOneway(m))
+	assert.Equal(t, "0", mc.mqClient.onewayCommand.ExtFields["sysFlag"])
+	assert.Equal(t, body, mc.mqClient.onewayCommand.Body)
+}
@@ -0,0 +1,132 @@
+package producer
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+)
+
+// MessageQueueSelector selects the queue which the message is sent to
+// returns nil if no queue is selected
+type MessageQueueSelector interface {
+	Select(qs []*message.Queue, m *message.Message, arg interface{}) *message.Queue
+}
+
+// MessageQueueSelectorFunc the function adapter of the MessageQueueSelector
+type MessageQueueSelectorFunc func([]*message.Queue, *message.Message, interface{}) *message.Queue
+
+// Select calls the function
+func (f MessageQueueSelectorFunc) Select(
+	qs []*message.Queue, m *message.Message, arg interface{},
+) *message.Queue {
+	return f(qs, m, arg)
+}
+
+// HashSelector selects the queue by the hash of the key
+// the key is the arg if it is a string, otherwise the keys of the message
+type HashSelector struct{}
+
+// Select selects the queue by the hash of the key
+func (s HashSelector) Select(qs []*message.Queue, m *message.Message, arg interface{}) *message.Queue {
+	if len(qs) == 0 {
+		return nil
+	}
+
+	key, ok := arg.(string)
+	if !ok {
+		key = m.GetProperty(message.PropertyKeys)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return qs[h.Sum32()%uint32(len(qs))]
+}
+
+// ModuloSelector selects the queue by the arg modulo the count of the queues
+// the arg must be an integer, otherwise no queue is selected
+type ModuloSelector struct{}
+
+// Select selects the queue by the arg modulo the count of the queues
+func (s ModuloSelector) Select(qs []*message.Queue, m *message.Message, arg interface{}) *message.Queue {
+	if len(qs) == 0 {
+		return nil
+	}
+
+	var n int64
+	switch v := arg.(type) {
+	case int:
+		n = int64(v)
+	case int8:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint:
+		n = int64(v % uint(len(qs)))
+	case uint8:
+		n = int64(v)
+	case uint16:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case uint64:
+		n = int64(v % uint64(len(qs)))
+	default:
+		return nil
+	}
+
+	i := n % int64(len(qs))
+	if i < 0 {
+		i = -i
+	}
+	return qs[i]
+}
+
+// SendSyncWithSelector sends the message to the queue selected by the selector
+// the message is resent to the same queue when failed, never to the other one
+// for keeping the order of the messages sent to the queue
+func (p *Producer) SendSyncWithSelector(
+	m *message.Message, selector MessageQueueSelector, arg interface{},
+) (
+	sendResult *SendResult, err error,
+) {
+	if selector == nil {
+		return nil, errEmptySelector
+	}
+
+	pi, sysFlag, prevBody, err := p.prepareSend(m)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { m.Body = prevBody }()
+
+	q := selector.Select(pi.MessageQueues(), m, arg)
+	if q == nil {
+		return nil, errNoQueueSelected
+	}
+
+	maxSendCount := p.RetryTimesWhenSendFailed + 1
+	for i := int32(0); i < maxSendCount; i++ {
+		start := time.Now()
+		sendResult, err = p.sendSync(m, q, sysFlag, false)
+		elapsed := time.Since(start)
+		p.recordSend(m.Topic, elapsed, err)
+		cost := elapsed / time.Millisecond
+		p.mqFaultStrategy.UpdateFault(q.BrokerName, int64(cost), err != nil)
+		if err == nil {
+			return
+		}
+
+		p.Logger.Errorf(
+			"send %s with selector RT:%dms, Queue:%s, err %s", m.GetUniqID(), cost, q, err,
+		)
+	}
+
+	p.Logger.Errorf("send %d times with selector, still failed, topic:%s, queue:%s",
+		maxSendCount, m.Topic, q)
+	return
+}
@@ -0,0 +1,169 @@
+package producer
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/metrics"
+	"github.com/zjykzk/rocketmq-client-go/remote"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+func testQueues(n int) []*message.Queue {
+	qs := make([]*message.Queue, n)
+	for i := range qs {
+		qs[i] = &message.Queue{Topic: "selector", BrokerName: "b", QueueID: uint8(i)}
+	}
+	return qs
+}
+
+func TestHashSelector(t *testing.T) {
+	s, qs := HashSelector{}, testQueues(4)
+	assert.Nil(t, s.Select(nil, &message.Message{}, "key"))
+
+	// same key, same queue
+	q := s.Select(qs, &message.Message{}, "order-1")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, q, s.Select(qs, &message.Message{}, "order-1"))
+	}
+
+	// use the keys of the message
+	m := &message.Message{}
+	m.SetKey("order-1")
+	assert.Equal(t, q, s.Select(qs, m, nil))
+
+	// spread
+	selected := map[*message.Queue]bool{}
+	for i := 0; i < 100; i++ {
+		selected[s.Select(qs, m, "order-"+strconv.Itoa(i))] = true
+	}
+	assert.Equal(t, len(qs), len(selected))
+}
+
+func TestModuloSelector(t *testing.T) {
+	s, qs := ModuloSelector{}, testQueues(4)
+	assert.Nil(t, s.Select(nil, &message.Message{}, 1))
+	assert.Nil(t, s.Select(qs, &message.Message{}, "1"))
+
+	m := &message.Message{}
+	assert.Equal(t, qs[1], s.Select(qs, m, 5))
+	assert.Equal(t, qs[1], s.Select(qs, m, int8(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, int16(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, int32(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, int64(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, uint(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, uint8(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, uint16(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, uint32(5)))
+	assert.Equal(t, qs[1], s.Select(qs, m, uint64(5)))
+	assert.Equal(t, qs[3], s.Select(qs, m, uint64(1<<64-1)))
+	assert.Equal(t, qs[1], s.Select(qs, m, -5))
+}
+
+func TestUpdateOrderTopicRouter(t *testing.T) {
+	p := NewProducer("order topic", []string{"abc"}, &log.MockLogger{})
+	topic := "order topic"
+	p.topicPublishInfos.table = make(map[string]*topicPublishInfo)
+	p.UpdateTopicPublish(topic, &route.TopicRouter{
+		OrderTopicConf: "b1:2;bad;b2:x;b2:1",
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b3", ReadCount: 3, WriteCount: 3, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b3", Addresses: map[int32]string{0: "b3"}},
+		},
+	})
+
+	pi := p.topicPublishInfos.get(topic)
+	assert.True(t, pi.orderTopic)
+	assert.Equal(t, []*message.Queue{
+		&message.Queue{Topic: topic, BrokerName: "b1", QueueID: 0},
+		&message.Queue{Topic: topic, BrokerName: "b1", QueueID: 1},
+		&message.Queue{Topic: topic, BrokerName: "b2", QueueID: 0},
+	}, pi.queues)
+}
+
+func TestSendSyncWithSelector(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.SetSink(r)
+	defer metrics.SetSink(nil)
+
+	p := NewProducer("sendSelector", []string{"abc"}, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "b1 addr", "b2": "b2 addr"}, p: p}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	m := &message.Message{Topic: "test send selector", Body: []byte("selector")}
+
+	// empty selector
+	_, err := p.SendSyncWithSelector(m, nil, nil)
+	assert.Equal(t, errEmptySelector, err)
+
+	// no routers
+	_, err = p.SendSyncWithSelector(m, ModuloSelector{}, 1)
+	assert.Equal(t, errNoRouters, err)
+
+	mc.p.UpdateTopicPublish(m.Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+			&route.TopicQueue{BrokerName: "b2", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+			&route.Broker{Cluster: "c", Name: "b2", Addresses: map[int32]string{0: "b2 addr"}},
+		},
+	})
+
+	// no queue selected
+	_, err = p.SendSyncWithSelector(m, ModuloSelector{}, "bad arg")
+	assert.Equal(t, errNoQueueSelected, err)
+
+	// ok
+	mc.mqClient.command.ExtFields = map[string]string{
+		"msgId":       "1",
+		"queueOffset": "11",
+		"MSG_REGION":  "RegionID",
+		"TRACE_ON":    "true",
+		"queueId":     "3",
+	}
+	queues := p.topicPublishInfos.get(m.Topic).queues
+	for i := 0; i < len(queues)*2; i++ {
+		sr, err := p.SendSyncWithSelector(m, ModuloSelector{}, i)
+		assert.Nil(t, err)
+		assert.Equal(t, OK, sr.Status)
+		assert.Equal(t, queues[i%len(queues)], sr.Queue)
+	}
+
+	// failed, resend to the same queue
+	mc.mqClient.requestSyncCommands = nil
+	mc.mqClient.requestSyncErr = errors.New("bad send")
+	_, err = p.SendSyncWithSelector(m, ModuloSelector{}, 3)
+	assert.Equal(t, remote.RequestError(mc.mqClient.requestSyncErr), err)
+	assert.Equal(t, int(p.RetryTimesWhenSendFailed+1), len(mc.mqClient.requestSyncCommands))
+	for _, cmd := range mc.mqClient.requestSyncCommands {
+		assert.Equal(t, strconv.Itoa(int(queues[3].QueueID)), cmd.ExtFields["queueId"])
+	}
+	assert.Equal(t, []byte("selector"), m.Body)
+
+	// every sending is recorded
+	buf := &bytes.Buffer{}
+	r.WriteTo(buf)
+	out := buf.String()
+	for _, l := range []string{
+		`rocketmq_send_total{group="sendSelector",status="ok",topic="test send selector"} ` +
+			strconv.Itoa(len(queues)*2),
+		`rocketmq_send_total{group="sendSelector",status="failed",topic="test send selector"} ` +
+			strconv.Itoa(int(p.RetryTimesWhenSendFailed+1)),
+	} {
+		assert.True(t, strings.Contains(out, l+"\n"), l)
+	}
+}
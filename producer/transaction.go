@@ -0,0 +1,153 @@
+package producer
+
+import (
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+)
+
+// LocalTransactionState the state of the local transaction
+type LocalTransactionState int8
+
+// predefined local transaction state
+const (
+	UnknownTransaction LocalTransactionState = iota
+	CommitTransaction
+	RollbackTransaction
+)
+
+var localTransactionStateDescs = []string{"unknown", "commit", "rollback"}
+
+func (s LocalTransactionState) String() string {
+	if s < 0 || int(s) >= len(localTransactionStateDescs) {
+		return "unknown state"
+	}
+	return localTransactionStateDescs[s]
+}
+
+func (s LocalTransactionState) flag() int32 {
+	switch s {
+	case CommitTransaction:
+		return message.TransactionCommitType
+	case RollbackTransaction:
+		return message.TransactionRollbackType
+	default:
+		return message.TransactionNotType
+	}
+}
+
+// TransactionListener executes the local transaction, and checks the state of it
+// when the broker does not know the result of the transaction
+type TransactionListener interface {
+	ExecuteLocalTransaction(m *message.Message, arg interface{}) LocalTransactionState
+	CheckLocalTransaction(m *message.MessageExt) LocalTransactionState
+}
+
+// TransactionSendResult the result of the transaction message
+type TransactionSendResult struct {
+	*SendResult
+	LocalState LocalTransactionState
+}
+
+// TransactionProducer sends the transaction messages
+type TransactionProducer struct {
+	*Producer
+}
+
+// NewTransactionProducer creates the producer sending the transaction messages
+// the listener must not be nil
+func NewTransactionProducer(
+	group string, namesrvAddrs []string, listener TransactionListener, logger log.Logger,
+) *TransactionProducer {
+	p := NewProducer(group, namesrvAddrs, logger)
+	p.transactionListener = listener
+	return &TransactionProducer{Producer: p}
+}
+
+// SendMessageInTransaction sends the prepared message, executes the local transaction if it
+// is sent successfully, then commits or rollbacks the message by the state of the local transaction
+func (p *TransactionProducer) SendMessageInTransaction(m *message.Message, arg interface{}) (
+	*TransactionSendResult, error,
+) {
+	if m == nil {
+		return nil, errEmptyMessage
+	}
+
+	m.ClearProperty(message.PropertyDelayTimeLevel)
+	m.PutProperty(message.PropertyTransactionPrepared, "true")
+	m.PutProperty(message.PropertyProducerGroup, p.GroupName)
+
+	r, err := p.SendSync(m)
+	if err != nil {
+		return nil, err
+	}
+
+	state := RollbackTransaction
+	if r.Status == OK {
+		state = p.transactionListener.ExecuteLocalTransaction(m, arg)
+	}
+
+	if err = p.endTransaction(r, state); err != nil {
+		p.Logger.Warnf("end transaction of message %s error:%s", r.UniqID, err)
+	}
+
+	return &TransactionSendResult{SendResult: r, LocalState: state}, nil
+}
+
+func (p *TransactionProducer) endTransaction(r *SendResult, state LocalTransactionState) error {
+	_, offset, err := message.ParseMessageID(r.OffsetID)
+	if err != nil {
+		return err
+	}
+
+	addr := p.client.GetMasterBrokerAddr(r.Queue.BrokerName)
+	if addr == "" {
+		return errBrokerNotFound
+	}
+
+	return rpc.EndTransactionOneway(p.client.RemotingClient(), addr, &rpc.EndTransactionHeader{
+		Group:                p.GroupName,
+		TranStateTableOffset: r.QueueOffset,
+		CommitLogOffset:      offset,
+		CommitOrRollback:     state.flag(),
+		MsgID:                r.UniqID,
+		TransactionID:        r.TransactionID,
+	}, "")
+}
+
+// CheckTransactionState checks the state of the local transaction asynchronously,
+// then commits or rollbacks the message by the state
+func (p *Producer) CheckTransactionState(
+	addr string, m *message.MessageExt, header *rpc.CheckTransactionStateHeader,
+) {
+	if p.transactionListener == nil {
+		p.Logger.Errorf("check transaction state of message %s, but no listener", m.MsgID)
+		return
+	}
+
+	go p.checkTransactionState(addr, m, header)
+}
+
+func (p *Producer) checkTransactionState(
+	addr string, m *message.MessageExt, header *rpc.CheckTransactionStateHeader,
+) {
+	state := p.transactionListener.CheckLocalTransaction(m)
+
+	msgID := m.GetUniqID()
+	if msgID == "" {
+		msgID = m.MsgID
+	}
+
+	err := rpc.EndTransactionOneway(p.client.RemotingClient(), addr, &rpc.EndTransactionHeader{
+		Group:                p.GroupName,
+		TranStateTableOffset: header.TranStateTableOffset,
+		CommitLogOffset:      m.CommitLogOffset,
+		CommitOrRollback:     state.flag(),
+		FromTransactionCheck: true,
+		MsgID:                msgID,
+		TransactionID:        header.TransactionID,
+	}, "")
+	if err != nil {
+		p.Logger.Errorf("end transaction of message %s when checking error:%s", msgID, err)
+	}
+}
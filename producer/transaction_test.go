@@ -0,0 +1,140 @@
+package producer
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote/rpc"
+	"github.com/zjykzk/rocketmq-client-go/route"
+)
+
+type mockTransactionListener struct {
+	executeState, checkState LocalTransactionState
+
+	executeArg    interface{}
+	checkMessage  *message.MessageExt
+	executeCalled int
+}
+
+func (l *mockTransactionListener) ExecuteLocalTransaction(
+	m *message.Message, arg interface{},
+) LocalTransactionState {
+	l.executeCalled++
+	l.executeArg = arg
+	return l.executeState
+}
+
+func (l *mockTransactionListener) CheckLocalTransaction(m *message.MessageExt) LocalTransactionState {
+	l.checkMessage = m
+	return l.checkState
+}
+
+func TestSendMessageInTransaction(t *testing.T) {
+	listener := &mockTransactionListener{executeState: CommitTransaction}
+	p := NewTransactionProducer("transaction", []string{"abc"}, listener, &log.MockLogger{})
+	p.Start()
+	mc := &mockMQClient{brokerAddr: map[string]string{"b1": "b1 addr"}, p: p.Producer}
+	p.client = mc
+
+	defer p.Shutdown()
+
+	_, err := p.SendMessageInTransaction(nil, nil)
+	assert.Equal(t, errEmptyMessage, err)
+
+	m := &message.Message{Topic: "send transaction", Body: []byte("transaction")}
+	m.SetDelayTimeLevel(2)
+
+	// no routers
+	_, err = p.SendMessageInTransaction(m, nil)
+	assert.Equal(t, errNoRouters, err)
+	assert.Equal(t, 0, listener.executeCalled)
+
+	mc.p.UpdateTopicPublish(m.Topic, &route.TopicRouter{
+		Queues: []*route.TopicQueue{
+			&route.TopicQueue{BrokerName: "b1", ReadCount: 2, WriteCount: 2, Perm: route.PermWrite},
+		},
+		Brokers: []*route.Broker{
+			&route.Broker{Cluster: "c", Name: "b1", Addresses: map[int32]string{0: "b1 addr"}},
+		},
+	})
+	offsetID := message.CreateMessageID(&message.Addr{Host: []byte{127, 0, 0, 1}, Port: 10911}, 1234)
+	mc.mqClient.command.ExtFields = map[string]string{
+		"msgId":         offsetID,
+		"queueOffset":   "111",
+		"queueId":       "0",
+		"transactionId": "tid",
+	}
+
+	// commit
+	r, err := p.SendMessageInTransaction(m, "arg")
+	assert.Nil(t, err)
+	assert.Equal(t, CommitTransaction, r.LocalState)
+	assert.Equal(t, 1, listener.executeCalled)
+	assert.Equal(t, "arg", listener.executeArg)
+	assert.Equal(t, 0, m.GetDelayTimeLevel())
+	assert.Equal(t, "true", m.GetProperty(message.PropertyTransactionPrepared))
+	assert.Equal(t, p.GroupName, m.GetProperty(message.PropertyProducerGroup))
+
+	cmd := mc.mqClient.requestSyncCommands[0]
+	assert.Equal(t, strconv.Itoa(message.TransactionPreparedType), cmd.ExtFields["sysFlag"])
+
+	cmd = mc.mqClient.onewayCommand
+	assert.Equal(t, "b1 addr", mc.mqClient.onewayAddr)
+	assert.Equal(t, rpc.EndTransaction, cmd.Code)
+	assert.Equal(t, p.GroupName, cmd.ExtFields["producerGroup"])
+	assert.Equal(t, "111", cmd.ExtFields["tranStateTableOffset"])
+	assert.Equal(t, "1234", cmd.ExtFields["commitLogOffset"])
+	assert.Equal(t, strconv.Itoa(message.TransactionCommitType), cmd.ExtFields["commitOrRollback"])
+	assert.Equal(t, "false", cmd.ExtFields["fromTransactionCheck"])
+	assert.Equal(t, m.GetUniqID(), cmd.ExtFields["msgId"])
+	assert.Equal(t, "tid", cmd.ExtFields["transactionId"])
+
+	// rollback since the sending is not ok
+	mc.mqClient.command.Code = rpc.FlushDiskTimeout
+	r, err = p.SendMessageInTransaction(m, "arg")
+	assert.Nil(t, err)
+	assert.Equal(t, RollbackTransaction, r.LocalState)
+	assert.Equal(t, 1, listener.executeCalled)
+	assert.Equal(t,
+		strconv.Itoa(message.TransactionRollbackType),
+		mc.mqClient.onewayCommand.ExtFields["commitOrRollback"],
+	)
+}
+
+func TestCheckTransactionState(t *testing.T) {
+	listener := &mockTransactionListener{checkState: RollbackTransaction}
+	p := NewTransactionProducer("transaction", []string{"abc"}, listener, &log.MockLogger{})
+	mc := &mockMQClient{p: p.Producer}
+	p.client = mc
+
+	m := &message.MessageExt{MsgID: "offset msg id", CommitLogOffset: 123}
+	header := &rpc.CheckTransactionStateHeader{TranStateTableOffset: 11, TransactionID: "tid"}
+
+	p.checkTransactionState("broker addr", m, header)
+	assert.Equal(t, m, listener.checkMessage)
+	cmd := mc.mqClient.onewayCommand
+	assert.Equal(t, "broker addr", mc.mqClient.onewayAddr)
+	assert.Equal(t, rpc.EndTransaction, cmd.Code)
+	assert.Equal(t, "11", cmd.ExtFields["tranStateTableOffset"])
+	assert.Equal(t, "123", cmd.ExtFields["commitLogOffset"])
+	assert.Equal(t, strconv.Itoa(message.TransactionRollbackType), cmd.ExtFields["commitOrRollback"])
+	assert.Equal(t, "true", cmd.ExtFields["fromTransactionCheck"])
+	assert.Equal(t, "offset msg id", cmd.ExtFields["msgId"])
+	assert.Equal(t, "tid", cmd.ExtFields["transactionId"])
+
+	m.SetUniqID("uniq id")
+	listener.checkState = UnknownTransaction
+	p.checkTransactionState("broker addr", m, header)
+	cmd = mc.mqClient.onewayCommand
+	assert.Equal(t, "uniq id", cmd.ExtFields["msgId"])
+	assert.Equal(t, strconv.Itoa(message.TransactionNotType), cmd.ExtFields["commitOrRollback"])
+
+	// no listener
+	mc.mqClient.onewayCommand = nil
+	NewProducer("no listener", []string{"abc"}, &log.MockLogger{}).CheckTransactionState("", m, header)
+	assert.Nil(t, mc.mqClient.onewayCommand)
+}
@@ -5,11 +5,13 @@ import (
 	"time"
 
 	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/metrics"
 )
 
 // Client exchange the message with server
 type Client interface {
 	RequestSync(addr string, cmd *Command, timeout time.Duration) (*Command, error)
+	RequestAsync(addr string, cmd *Command, timeout time.Duration, callback func(*Command, error)) error
 	RequestOneway(addr string, cmd *Command) error
 	Start() error
 	Shutdown()
@@ -53,6 +55,8 @@ func NewClient(
 		encoder:          EncoderFunc(encode),
 		decoder:          DecoderFunc(decode),
 		packetReader:     PacketReaderFunc(ReadPacket),
+		channels:         make(map[string]*channel),
+		responseFutures:  make(map[int64]*responseFuture),
 		logger:           logger,
 	}
 	return c
@@ -67,7 +71,7 @@ func (c *client) RequestSync(addr string, cmd *Command, timeout time.Duration) (
 		return nil, err
 	}
 
-	future := c.putFuture(timeout, cmd.ID(), &ch.ctx)
+	future := c.putFuture(timeout, cmd.ID(), &ch.ctx, nil)
 	if err := ch.SendSync(cmd); err != nil {
 		c.logger.Errorf("send message [%d] sync error:%v", cmd.ID(), err)
 		return nil, err
@@ -78,12 +82,42 @@ func (c *client) RequestSync(addr string, cmd *Command, timeout time.Duration) (
 	return r, err
 }
 
+// RequestAsync request the command async, the callback is called with the response when it arrives,
+// or with the error when the request is timeout or the connection is broken
+//
+// NOTE: the callback is not called if the returned error is not nil
+func (c *client) RequestAsync(
+	addr string, cmd *Command, timeout time.Duration, callback func(*Command, error),
+) error {
+	if callback == nil {
+		return errEmptyCallback
+	}
+
+	ch, err := c.getChannel(addr)
+	if err != nil {
+		return err
+	}
+
+	c.putFuture(timeout, cmd.ID(), &ch.ctx, callback)
+	if err := ch.SendSync(cmd); err != nil {
+		c.logger.Errorf("send message [%d] async error:%v", cmd.ID(), err)
+		if f := c.removeFuture(cmd.ID()); f != nil { // otherwise, the callback is called with the error
+			f.release()
+			return err
+		}
+		return nil
+	}
+	c.logger.Debugf("send message [%d] async ok, %s", cmd.ID(), addr)
+	return nil
+}
+
 func (c *client) RequestOneway(addr string, cmd *Command) error {
 	ch, err := c.getChannel(addr)
 	if err != nil {
 		return err
 	}
 
+	cmd.MarkOnewayType()
 	if err := ch.SendSync(cmd); err != nil {
 		c.logger.Errorf("send message [%d] sync error:%v", cmd.ID(), err)
 		return err
@@ -91,33 +125,49 @@ func (c *client) RequestOneway(addr string, cmd *Command) error {
 	return nil
 }
 
-func (c *client) putFuture(timeout time.Duration, id int64, ctx *ChannelContext) *responseFuture {
-	f := newFuture(timeout, id, ctx)
+func (c *client) putFuture(
+	timeout time.Duration, id int64, ctx *ChannelContext, callback func(*Command, error),
+) *responseFuture {
+	f := newFuture(timeout, id, ctx, callback)
 	c.futureLocker.Lock()
 	c.responseFutures[id] = f
 	c.futureLocker.Unlock()
 	return f
 }
 
+func (c *client) removeFuture(id int64) *responseFuture {
+	c.futureLocker.Lock()
+	f, ok := c.responseFutures[id]
+	if ok {
+		delete(c.responseFutures, id)
+	}
+	c.futureLocker.Unlock()
+	return f
+}
+
 // OnActive callback when connected
 func (c *client) OnActive(ctx *ChannelContext) {
+	metrics.IncCounter(metrics.ConnectionEvents, metrics.Labels{"event": metrics.EventActive}, 1)
 	c.logger.Infof("channel active:%s", ctx)
 }
 
 // OnDeactive callback when disconnected
 func (c *client) OnDeactive(ctx *ChannelContext) {
+	metrics.IncCounter(metrics.ConnectionEvents, metrics.Labels{"event": metrics.EventDeactive}, 1)
 	c.logger.Infof("channel deactive:%s", ctx)
 	c.clearChan(ctx, errConnDeactive)
 }
 
 // OnError callback when errors occurs
 func (c *client) OnError(ctx *ChannelContext, err error) {
+	metrics.IncCounter(metrics.ConnectionEvents, metrics.Labels{"event": metrics.EventError}, 1)
 	c.logger.Errorf("channel error:%s %s\n", ctx, err)
 	c.clearChan(ctx, err)
 }
 
 // OnClose callback when closed
 func (c *client) OnClose(ctx *ChannelContext) {
+	metrics.IncCounter(metrics.ConnectionEvents, metrics.Labels{"event": metrics.EventClose}, 1)
 	c.logger.Error("channel closed " + ctx.String())
 	c.clearChan(ctx, errConnClosed)
 }
@@ -153,14 +203,8 @@ func (c *client) OnMessage(ctx *ChannelContext, o interface{}) {
 		return
 	}
 
-	c.futureLocker.Lock()
-	f, ok := c.responseFutures[id]
-	if ok {
-		delete(c.responseFutures, f.id)
-	}
-	c.futureLocker.Unlock()
-
-	if ok {
+	f := c.removeFuture(id)
+	if f != nil {
 		f.put(cmd)
 	} else {
 		c.logger.Errorf("message [%d] LOST: %v", id, o)
@@ -207,14 +251,7 @@ func (c *client) getFutures(filter func(*responseFuture) bool) []*responseFuture
 // thread-safe
 func (c *client) removeFuturesOnError(futures []*responseFuture, err error) {
 	for _, f := range futures {
-		c.futureLocker.Lock()
-		_, ok := c.responseFutures[f.id]
-		if ok {
-			delete(c.responseFutures, f.id)
-		}
-		c.futureLocker.Unlock()
-
-		if !ok {
+		if c.removeFuture(f.id) == nil {
 			continue
 		}
 
@@ -223,8 +260,7 @@ func (c *client) removeFuturesOnError(futures []*responseFuture, err error) {
 			f.id, f.startTime, f.timeout, time.Now(), err,
 		)
 
-		f.err = err
-		f.response <- nil
+		f.fail(err)
 	}
 }
 
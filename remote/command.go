@@ -23,6 +23,7 @@ const (
 
 const (
 	responsType    = 1
+	onewayType     = 1 << 1
 	commandFlag    = 0
 	commandVersion = 252
 )
@@ -59,10 +60,20 @@ func (cmd *Command) isResponseType() bool {
 	return cmd.Flag&(responsType) == responsType
 }
 
-func (cmd *Command) markResponseType() {
+// MarkResponseType marks the command as the response
+func (cmd *Command) MarkResponseType() {
 	cmd.Flag = (cmd.Flag | responsType)
 }
 
+func (cmd *Command) isOnewayType() bool {
+	return cmd.Flag&(onewayType) == onewayType
+}
+
+// MarkOnewayType marks the command as the oneway request, which the peer does not respond
+func (cmd *Command) MarkOnewayType() {
+	cmd.Flag = (cmd.Flag | onewayType)
+}
+
 //NewCommand create command with empty body
 func NewCommand(code Code, header HeaderOfMapper) *Command {
 	return NewCommandWithBody(code, header, nil)
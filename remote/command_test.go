@@ -76,6 +76,28 @@ func TestCommand(t *testing.T) {
 
 	})
 
+	t.Run("oneway", func(t *testing.T) {
+		cmd := NewCommand(0, h)
+		assert.False(t, cmd.isOnewayType())
+		cmd.MarkOnewayType()
+		bs, err := encode(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet, err := ReadPacket(bytes.NewReader(bs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd1, err := decode(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, int32(2), cmd1.Flag)
+		assert.True(t, cmd1.isOnewayType())
+		assert.False(t, cmd1.isResponseType())
+	})
+
 	t.Run("body", func(t *testing.T) {
 		cmd := NewCommandWithBody(0, h, []byte("body"))
 		bs, err := encode(cmd)
@@ -6,9 +6,10 @@ import (
 )
 
 var (
-	errTimeout      = errors.New("timeout")
-	errConnClosed   = errors.New("connection closed")
-	errConnDeactive = errors.New("connection deactive")
+	errTimeout       = errors.New("timeout")
+	errConnClosed    = errors.New("connection closed")
+	errConnDeactive  = errors.New("connection deactive")
+	errEmptyCallback = errors.New("empty callback")
 )
 
 // IsTimeoutError timeout error
@@ -21,6 +21,7 @@ type responseFuture struct {
 	timeout   time.Duration
 	id        int64
 	ctx       *ChannelContext
+	callback  func(*Command, error) // not nil, when the request is asynchronous
 }
 
 // get return the reponse command
@@ -29,10 +30,26 @@ func (f *responseFuture) get() (*Command, error) {
 }
 
 func (f *responseFuture) put(resp *Command) {
+	if f.callback != nil {
+		f.callback(resp, nil)
+		f.release()
+		return
+	}
 	f.response <- resp
 }
 
+func (f *responseFuture) fail(err error) {
+	if f.callback != nil {
+		f.callback(nil, err)
+		f.release()
+		return
+	}
+	f.err = err
+	f.response <- nil
+}
+
 func (f *responseFuture) release() {
+	f.callback = nil
 	futurePool.Put(f)
 }
 
@@ -40,11 +57,15 @@ func (f *responseFuture) String() string {
 	return fmt.Sprintf("id:%d, start:%s, timeout:%s, ctx:%s", f.id, f.startTime, f.timeout, f.ctx)
 }
 
-func newFuture(timeout time.Duration, id int64, ctx *ChannelContext) *responseFuture {
+func newFuture(
+	timeout time.Duration, id int64, ctx *ChannelContext, callback func(*Command, error),
+) *responseFuture {
 	r := futurePool.Get().(*responseFuture)
 	r.timeout = timeout
 	r.id = id
 	r.startTime = time.Now()
 	r.ctx = ctx
+	r.err = nil
+	r.callback = callback
 	return r
 }
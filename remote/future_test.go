@@ -0,0 +1,44 @@
+package remote
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuture(t *testing.T) {
+	// sync
+	f := newFuture(time.Second, 1, nil, nil)
+	cmd := &Command{Opaque: 1}
+	f.put(cmd)
+	r, err := f.get()
+	assert.Nil(t, err)
+	assert.Equal(t, cmd, r)
+	f.release()
+
+	f = newFuture(time.Second, 2, nil, nil)
+	f.fail(errTimeout)
+	r, err = f.get()
+	assert.Nil(t, r)
+	assert.Equal(t, errTimeout, err)
+	f.release()
+
+	// async
+	var (
+		resp    *Command
+		respErr error
+	)
+	callback := func(c *Command, err error) { resp, respErr = c, err }
+	f = newFuture(time.Second, 3, nil, callback)
+	assert.Nil(t, f.err)
+	f.put(cmd)
+	assert.Equal(t, cmd, resp)
+	assert.Nil(t, respErr)
+
+	f = newFuture(time.Second, 4, nil, callback)
+	f.fail(errors.New("bad connection"))
+	assert.Nil(t, resp)
+	assert.Equal(t, "bad connection", respErr.Error())
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zjykzk/rocketmq-client-go/remote"
@@ -326,3 +327,36 @@ func UnregisterClient(
 	}
 	return
 }
+
+// BrokerConfig returns the configuration of the broker
+func BrokerConfig(client remote.Client, addr string, to time.Duration) (map[string]string, error) {
+	cmd, err := client.RequestSync(addr, remote.NewCommand(GetBrokerConfig, nil), to)
+	if err != nil {
+		return nil, remote.RequestError(err)
+	}
+
+	if cmd.Code != Success {
+		return nil, remote.BrokerError(cmd)
+	}
+
+	return parseBrokerConfig(string(cmd.Body)), nil
+}
+
+// parseBrokerConfig parses the config in the format of the java properties, one "key=value" per line
+func parseBrokerConfig(s string) map[string]string {
+	config := make(map[string]string, 128)
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || l[0] == '#' || l[0] == '!' {
+			continue
+		}
+
+		i := strings.IndexAny(l, "=:")
+		if i < 0 {
+			config[l] = ""
+			continue
+		}
+		config[strings.TrimSpace(l[:i])] = strings.TrimSpace(l[i+1:])
+	}
+	return config
+}
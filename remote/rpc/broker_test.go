@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/zjykzk/rocketmq-client-go/log"
 	"github.com/zjykzk/rocketmq-client-go/remote"
 )
@@ -33,3 +35,13 @@ func testDeleteTopic(t *testing.T) {
 	err := rpc.DeleteTopicInBroker("localhost:10909", "test_create_topic", time.Millisecond*100)
 	t.Log(err)
 }
+
+func TestParseBrokerConfig(t *testing.T) {
+	config := parseBrokerConfig("#comment\nbrokerName=broker-a\n\nmessageDelayLevel = 1s 5s 10s\r\nflag:true\nempty\n")
+	assert.Equal(t, map[string]string{
+		"brokerName":        "broker-a",
+		"messageDelayLevel": "1s 5s 10s",
+		"flag":              "true",
+		"empty":             "",
+	}, config)
+}
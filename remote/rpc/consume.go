@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"github.com/zjykzk/rocketmq-client-go/remote"
+)
+
+// the result of consuming the message directly
+const (
+	ConsumeSuccess        = "CR_SUCCESS"
+	ConsumeLater          = "CR_LATER"
+	ConsumeRollback       = "CR_ROLLBACK"
+	ConsumeCommit         = "CR_COMMIT"
+	ConsumeThrowException = "CR_THROW_EXCEPTION"
+	ConsumeReturnNull     = "CR_RETURN_NULL"
+)
+
+// ConsumeMessageDirectlyHeader the header of the request consuming the message directly, sent by the broker
+type ConsumeMessageDirectlyHeader struct {
+	Group      string
+	ClientID   string
+	MsgID      string
+	BrokerName string
+}
+
+// ParseConsumeMessageDirectlyHeader parses the header from the request
+func ParseConsumeMessageDirectlyHeader(cmd *remote.Command) *ConsumeMessageDirectlyHeader {
+	return &ConsumeMessageDirectlyHeader{
+		Group:      cmd.ExtFields["consumerGroup"],
+		ClientID:   cmd.ExtFields["clientId"],
+		MsgID:      cmd.ExtFields["msgId"],
+		BrokerName: cmd.ExtFields["brokerName"],
+	}
+}
+
+// ConsumeMessageDirectlyResult the result of consuming the message directly
+type ConsumeMessageDirectlyResult struct {
+	Order          bool   `json:"order"`
+	AutoCommit     bool   `json:"autoCommit"`
+	ConsumeResult  string `json:"consumeResult"`
+	Remark         string `json:"remark"`
+	SpentTimeMills int64  `json:"spentTimeMills"`
+}
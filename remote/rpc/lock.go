@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote"
+)
+
+type lockBatchRequest struct {
+	Group    string          `json:"consumerGroup"`
+	ClientID string          `json:"clientId"`
+	Queues   []message.Queue `json:"mqSet"`
+}
+
+// LockMessageQueues locks the message queues in the broker, returns the queues locked successfully
+func (r *RPC) LockMessageQueues(
+	addr, group, clientID string, queues []message.Queue, to time.Duration,
+) (
+	[]message.Queue, error,
+) {
+	d, err := json.Marshal(&lockBatchRequest{Group: group, ClientID: clientID, Queues: queues})
+	if err != nil {
+		return nil, remote.DataError(err)
+	}
+
+	cmd, err := r.client.RequestSync(addr, remote.NewCommandWithBody(LockBatchMq, nil, d), to)
+	if err != nil {
+		return nil, remote.RequestError(err)
+	}
+
+	if cmd.Code != Success {
+		return nil, remote.BrokerError(cmd)
+	}
+
+	resp := &struct {
+		Queues []message.Queue `json:"lockOKMQSet"`
+	}{}
+	if err = json.Unmarshal(cmd.Body, resp); err != nil {
+		return nil, remote.DataError(err)
+	}
+	return resp.Queues, nil
+}
+
+// UnlockMessageQueues unlocks the message queues in the broker
+func (r *RPC) UnlockMessageQueues(
+	addr, group, clientID string, queues []message.Queue, to time.Duration,
+) error {
+	d, err := json.Marshal(&lockBatchRequest{Group: group, ClientID: clientID, Queues: queues})
+	if err != nil {
+		return remote.DataError(err)
+	}
+
+	cmd, err := r.client.RequestSync(addr, remote.NewCommandWithBody(UnlockBatchMq, nil, d), to)
+	if err != nil {
+		return remote.RequestError(err)
+	}
+
+	if cmd.Code != Success {
+		return remote.BrokerError(cmd)
+	}
+	return nil
+}
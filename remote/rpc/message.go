@@ -45,6 +45,13 @@ func (h *SendHeader) ToMap() map[string]string {
 	}
 }
 
+func (h *SendHeader) requestCode() remote.Code {
+	if h.Batch {
+		return SendBatchMessage
+	}
+	return SendMessage
+}
+
 // SendResponse send response
 type SendResponse struct {
 	Code    remote.Code
@@ -65,11 +72,54 @@ func SendMessageSync(
 ) (
 	*SendResponse, error,
 ) {
-	cmd, err := client.RequestSync(addr, remote.NewCommandWithBody(SendMessage, header, d), to)
+	cmd, err := client.RequestSync(addr, remote.NewCommandWithBody(header.requestCode(), header, d), to)
 	if err != nil {
 		return nil, remote.RequestError(err)
 	}
 
+	return toSendResponse(cmd)
+}
+
+// SendMessageSync sends message
+func (r *RPC) SendMessageSync(addr string, d []byte, header *SendHeader, to time.Duration) (
+	*SendResponse, error,
+) {
+	return SendMessageSync(r.client, addr, d, header, to)
+}
+
+// SendMessageAsync sends message asynchronously, the callback is called with the response
+// when the broker responses, or with the error when the request is failed
+//
+// NOTE: the callback is not called if the returned error is not nil
+func SendMessageAsync(
+	client remote.Client, addr string, d []byte, header *SendHeader, to time.Duration,
+	callback func(*SendResponse, error),
+) error {
+	err := client.RequestAsync(
+		addr, remote.NewCommandWithBody(header.requestCode(), header, d), to,
+		func(cmd *remote.Command, err error) {
+			if err != nil {
+				callback(nil, remote.RequestError(err))
+				return
+			}
+			callback(toSendResponse(cmd))
+		})
+	if err != nil {
+		return remote.RequestError(err)
+	}
+	return nil
+}
+
+// SendMessageOneway sends message without waiting for the response
+func SendMessageOneway(client remote.Client, addr string, d []byte, header *SendHeader) error {
+	err := client.RequestOneway(addr, remote.NewCommandWithBody(header.requestCode(), header, d))
+	if err != nil {
+		return remote.RequestError(err)
+	}
+	return nil
+}
+
+func toSendResponse(cmd *remote.Command) (*SendResponse, error) {
 	resp := &SendResponse{Code: cmd.Code, Message: cmd.Remark}
 	switch cmd.Code {
 	case FlushDiskTimeout, FlushSlaveTimeout, SlaveNotAvailable:
@@ -80,6 +130,7 @@ func SendMessageSync(
 
 	resp.Code, resp.Message = cmd.Code, cmd.Remark
 	resp.MsgID = cmd.ExtFields["msgId"]
+	resp.TransactionID = cmd.ExtFields["transactionId"]
 	queueID, err := strconv.ParseInt(cmd.ExtFields["queueId"], 10, 32)
 	if err != nil {
 		return nil, remote.DataError(err)
@@ -158,6 +209,28 @@ func (r *RPC) PullMessageSync(addr string, header *PullHeader, to time.Duration)
 		return nil, err
 	}
 
+	return toPullResponse(cmd)
+}
+
+// PullMessageAsync pull message async, the callback is called with the response when the broker
+// responses, or with the error when the request is failed
+//
+// NOTE: the callback is not called if the returned error is not nil
+func (r *RPC) PullMessageAsync(
+	addr string, header *PullHeader, to time.Duration, callback func(*PullResponse, error),
+) error {
+	return r.client.RequestAsync(
+		addr, remote.NewCommand(PullMessage, header), to,
+		func(cmd *remote.Command, err error) {
+			if err != nil {
+				callback(nil, err)
+				return
+			}
+			callback(toPullResponse(cmd))
+		})
+}
+
+func toPullResponse(cmd *remote.Command) (pr *PullResponse, err error) {
 	switch cmd.Code {
 	case Success, PullNotFound, PullRetryImmediately, PullOffsetMoved:
 	default:
@@ -264,12 +337,12 @@ func (r *RPC) SendBack(addr string, h *SendBackHeader, to time.Duration) (err er
 	return
 }
 
-type maxOffsetHeader struct {
+type queueOffsetHeader struct {
 	topic   string
 	queueID uint8
 }
 
-func (h *maxOffsetHeader) ToMap() map[string]string {
+func (h *queueOffsetHeader) ToMap() map[string]string {
 	return map[string]string{
 		"topic":   h.topic,
 		"queueId": strconv.FormatInt(int64(h.queueID), 10),
@@ -282,9 +355,20 @@ type maxOffsetResponse struct {
 
 // MaxOffset returns the max offset in the consume queue
 func (r *RPC) MaxOffset(addr, topic string, queueID uint8, to time.Duration) (int64, *remote.RPCError) {
+	return r.queueOffset(GetMaxOffset, addr, topic, queueID, to)
+}
+
+// MinOffset returns the min offset in the consume queue
+func (r *RPC) MinOffset(addr, topic string, queueID uint8, to time.Duration) (int64, *remote.RPCError) {
+	return r.queueOffset(GetMinOffset, addr, topic, queueID, to)
+}
+
+func (r *RPC) queueOffset(code remote.Code, addr, topic string, queueID uint8, to time.Duration) (
+	int64, *remote.RPCError,
+) {
 	cmd, err := r.client.RequestSync(
 		addr,
-		remote.NewCommand(GetMaxOffset, &maxOffsetHeader{
+		remote.NewCommand(code, &queueOffsetHeader{
 			topic:   topic,
 			queueID: queueID,
 		}),
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/remote"
+)
+
+type mockAsyncClient struct {
+	remote.MockClient
+
+	resp       *remote.Command
+	respErr    error
+	requestErr error
+}
+
+func (c *mockAsyncClient) RequestAsync(
+	addr string, cmd *remote.Command, timeout time.Duration, callback func(*remote.Command, error),
+) error {
+	if c.requestErr != nil {
+		return c.requestErr
+	}
+	go callback(c.resp, c.respErr)
+	return nil
+}
+
+func TestPullMessageAsync(t *testing.T) {
+	type result struct {
+		resp *PullResponse
+		err  error
+	}
+	results := make(chan result, 1)
+	callback := func(resp *PullResponse, err error) { results <- result{resp, err} }
+
+	c := &mockAsyncClient{}
+	r := NewRPC(c)
+
+	c.requestErr = errors.New("mock request error")
+	assert.Equal(t, c.requestErr, r.PullMessageAsync("addr", &PullHeader{}, time.Second, callback))
+	c.requestErr = nil
+
+	c.respErr = errors.New("mock timeout")
+	assert.Nil(t, r.PullMessageAsync("addr", &PullHeader{}, time.Second, callback))
+	res := <-results
+	assert.Equal(t, c.respErr, res.err)
+	c.respErr = nil
+
+	c.resp = &remote.Command{Code: SystemError}
+	assert.Nil(t, r.PullMessageAsync("addr", &PullHeader{}, time.Second, callback))
+	res = <-results
+	assert.NotNil(t, res.err)
+
+	c.resp = &remote.Command{Code: PullNotFound, ExtFields: map[string]string{
+		"nextBeginOffset": "10", "minOffset": "1", "maxOffset": "10", "suggestWhichBrokerId": "1",
+	}}
+	assert.Nil(t, r.PullMessageAsync("addr", &PullHeader{}, time.Second, callback))
+	res = <-results
+	assert.Nil(t, res.err)
+	assert.Equal(t, &PullResponse{
+		Code: PullNotFound, NextBeginOffset: 10, MinOffset: 1, MaxOffset: 10, SuggestBrokerID: 1,
+	}, res.resp)
+
+	c.resp.ExtFields["maxOffset"] = "x"
+	assert.Nil(t, r.PullMessageAsync("addr", &PullHeader{}, time.Second, callback))
+	res = <-results
+	assert.NotNil(t, res.err)
+}
@@ -56,6 +56,15 @@ func (h getTopicRouteInfoHeader) ToMap() map[string]string {
 	return map[string]string{"topic": string(h)}
 }
 
+// GetTopicRouteInfo returns the topic information.
+func (r *RPC) GetTopicRouteInfo(addr, topic string, to time.Duration) (*route.TopicRouter, error) {
+	router, err := GetTopicRouteInfo(r.client, addr, topic, to)
+	if err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
 // GetTopicRouteInfo returns the topic information.
 func GetTopicRouteInfo(client remote.Client, addr string, topic string, to time.Duration) (
 	router *route.TopicRouter, err *remote.RPCError,
@@ -0,0 +1,201 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote"
+)
+
+var errBadQueueOffsetTable = errors.New("bad queue offset table")
+
+// ResetOffsetHeader the header of the request resetting the consume offset, which is sent by the broker
+type ResetOffsetHeader struct {
+	Topic     string
+	Group     string
+	Timestamp int64
+	IsForce   bool
+}
+
+// ParseResetOffsetHeader parses the header from the request
+func ParseResetOffsetHeader(cmd *remote.Command) (*ResetOffsetHeader, error) {
+	timestamp, err := strconv.ParseInt(cmd.ExtFields["timestamp"], 10, 64)
+	if err != nil {
+		return nil, remote.DataError(err)
+	}
+
+	isForce, _ := strconv.ParseBool(cmd.ExtFields["isForce"])
+	return &ResetOffsetHeader{
+		Topic:     cmd.ExtFields["topic"],
+		Group:     cmd.ExtFields["group"],
+		Timestamp: timestamp,
+		IsForce:   isForce,
+	}, nil
+}
+
+// ParseResetOffsetBody parses the offsets of the queues from the body of the request resetting the offset
+func ParseResetOffsetBody(body []byte) (map[message.Queue]int64, error) {
+	offsets, err := parseQueueOffsetTable(body, "offsetTable")
+	if err != nil {
+		return nil, remote.DataError(err)
+	}
+	return offsets, nil
+}
+
+// ConsumerStatusHeader the header of the request getting the consume offsets of the client
+type ConsumerStatusHeader struct {
+	Topic      string
+	Group      string
+	ClientAddr string
+}
+
+// ParseConsumerStatusHeader parses the header from the request
+func ParseConsumerStatusHeader(cmd *remote.Command) *ConsumerStatusHeader {
+	return &ConsumerStatusHeader{
+		Topic:      cmd.ExtFields["topic"],
+		Group:      cmd.ExtFields["group"],
+		ClientAddr: cmd.ExtFields["clientAddr"],
+	}
+}
+
+// EncodeConsumerStatusBody encodes the consume offsets of the queues as the response body
+func EncodeConsumerStatusBody(offsets map[message.Queue]int64) ([]byte, error) {
+	table, err := encodeQueueOffsetTable(offsets)
+	if err != nil {
+		return nil, remote.DataError(err)
+	}
+
+	buf := bytes.NewBufferString(`{"messageQueueTable":`)
+	buf.Write(table)
+	buf.WriteString(`,"consumerTable":{}}`)
+	return buf.Bytes(), nil
+}
+
+// encodeQueueOffsetTable encodes the map whose key is the queue as the broker does,
+// like {{"brokerName":"b","queueId":0,"topic":"t"}:1}
+func encodeQueueOffsetTable(offsets map[message.Queue]int64) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	first := true
+	for q, o := range offsets {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		k, err := json.Marshal(&q)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatInt(o, 10))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// parseQueueOffsetTable parses the map whose key is the queue, in the field of the json object
+// returns empty map if the field is not exist
+func parseQueueOffsetTable(d []byte, field string) (map[message.Queue]int64, error) {
+	offsets := make(map[message.Queue]int64)
+	i := bytes.Index(d, []byte(`"`+field+`"`))
+	if i < 0 {
+		return offsets, nil
+	}
+
+	d, ok := skipByte(d[i+len(field)+2:], ':')
+	if !ok {
+		return nil, errBadQueueOffsetTable
+	}
+
+	if d, ok = skipByte(d, '{'); !ok {
+		return nil, errBadQueueOffsetTable
+	}
+
+	for {
+		d = bytes.TrimSpace(d)
+		if len(d) == 0 {
+			return nil, errBadQueueOffsetTable
+		}
+
+		switch d[0] {
+		case '}':
+			return offsets, nil
+		case ',':
+			d = d[1:]
+			continue
+		}
+
+		end := objectEnd(d)
+		if end < 0 {
+			return nil, errBadQueueOffsetTable
+		}
+
+		var q message.Queue
+		if err := json.Unmarshal(d[:end], &q); err != nil {
+			return nil, err
+		}
+
+		if d, ok = skipByte(d[end:], ':'); !ok {
+			return nil, errBadQueueOffsetTable
+		}
+
+		n := bytes.IndexAny(d, ",}")
+		if n < 0 {
+			return nil, errBadQueueOffsetTable
+		}
+
+		o, err := strconv.ParseInt(string(bytes.TrimSpace(d[:n])), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		offsets[q] = o
+		d = d[n:]
+	}
+}
+
+// skipByte skips the spaces and the byte, returns false if the first non-space byte is not the one
+func skipByte(d []byte, b byte) ([]byte, bool) {
+	d = bytes.TrimSpace(d)
+	if len(d) == 0 || d[0] != b {
+		return nil, false
+	}
+	return d[1:], true
+}
+
+// objectEnd returns the index after the end of the json object at the beginning, -1 if not found
+func objectEnd(d []byte) int {
+	if d[0] != '{' {
+		return -1
+	}
+
+	depth, inString := 0, false
+	for i := 0; i < len(d); i++ {
+		c := d[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
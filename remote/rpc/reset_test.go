@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/remote"
+)
+
+func TestParseResetOffset(t *testing.T) {
+	_, err := ParseResetOffsetHeader(&remote.Command{ExtFields: map[string]string{"timestamp": "x"}})
+	assert.NotNil(t, err)
+
+	h, err := ParseResetOffsetHeader(&remote.Command{ExtFields: map[string]string{
+		"topic": "t", "group": "g", "timestamp": "123", "isForce": "true",
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, &ResetOffsetHeader{Topic: "t", Group: "g", Timestamp: 123, IsForce: true}, h)
+
+	offsets, err := ParseResetOffsetBody([]byte(`{"offsetTable":{` +
+		`{"brokerName":"b{1}","queueId":0,"topic":"t"}:100, ` +
+		`{"brokerName":"b\"2","queueId":1,"topic":"t"} : -1}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[message.Queue]int64{
+		{Topic: "t", BrokerName: "b{1}", QueueID: 0}: 100,
+		{Topic: "t", BrokerName: "b\"2", QueueID: 1}: -1,
+	}, offsets)
+
+	offsets, err = ParseResetOffsetBody([]byte(`{}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(offsets))
+
+	for _, body := range []string{
+		`{"offsetTable"}`,
+		`{"offsetTable":[]}`,
+		`{"offsetTable":{{"brokerName":"b"}}}`,
+		`{"offsetTable":{{"brokerName":"b"}:x}}`,
+		`{"offsetTable":{{"brokerName":"b"}:1`,
+		`{"offsetTable":{{"brokerName":"b":1}}`,
+		`{"offsetTable":{"b":1}}`,
+	} {
+		_, err = ParseResetOffsetBody([]byte(body))
+		assert.NotNil(t, err, body)
+	}
+}
+
+func TestConsumerStatus(t *testing.T) {
+	h := ParseConsumerStatusHeader(&remote.Command{ExtFields: map[string]string{
+		"topic": "t", "group": "g", "clientAddr": "addr",
+	}})
+	assert.Equal(t, &ConsumerStatusHeader{Topic: "t", Group: "g", ClientAddr: "addr"}, h)
+
+	offsets := map[message.Queue]int64{
+		{Topic: "t", BrokerName: "b", QueueID: 0}: 1,
+		{Topic: "t", BrokerName: "b", QueueID: 1}: 2,
+	}
+	body, err := EncodeConsumerStatusBody(offsets)
+	assert.Nil(t, err)
+
+	parsed, err := parseQueueOffsetTable(body, "messageQueueTable")
+	assert.Nil(t, err)
+	assert.Equal(t, offsets, parsed)
+
+	body, err = EncodeConsumerStatusBody(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"messageQueueTable":{},"consumerTable":{}}`, string(body))
+}
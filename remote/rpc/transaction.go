@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"strconv"
+
+	"github.com/zjykzk/rocketmq-client-go/remote"
+)
+
+// EndTransactionHeader the header of the request commits or rollbacks the transaction
+type EndTransactionHeader struct {
+	Group                string
+	TranStateTableOffset int64
+	CommitLogOffset      int64
+	CommitOrRollback     int32
+	FromTransactionCheck bool
+	MsgID                string
+	TransactionID        string
+}
+
+// ToMap converts end transaction header to map
+func (h *EndTransactionHeader) ToMap() map[string]string {
+	return map[string]string{
+		"producerGroup":        h.Group,
+		"tranStateTableOffset": strconv.FormatInt(h.TranStateTableOffset, 10),
+		"commitLogOffset":      strconv.FormatInt(h.CommitLogOffset, 10),
+		"commitOrRollback":     strconv.FormatInt(int64(h.CommitOrRollback), 10),
+		"fromTransactionCheck": strconv.FormatBool(h.FromTransactionCheck),
+		"msgId":                h.MsgID,
+		"transactionId":        h.TransactionID,
+	}
+}
+
+// EndTransactionOneway commits or rollbacks the transaction, the broker does not response
+func EndTransactionOneway(client remote.Client, addr string, header *EndTransactionHeader, remark string) error {
+	cmd := remote.NewCommand(EndTransaction, header)
+	cmd.Remark = remark
+	err := client.RequestOneway(addr, cmd)
+	if err != nil {
+		return remote.RequestError(err)
+	}
+	return nil
+}
+
+// CheckTransactionStateHeader the header of the request checks the state of the transaction
+type CheckTransactionStateHeader struct {
+	TranStateTableOffset int64
+	CommitLogOffset      int64
+	MsgID                string
+	TransactionID        string
+	OffsetMsgID          string
+}
+
+// ParseCheckTransactionStateHeader parses the header from the request
+func ParseCheckTransactionStateHeader(cmd *remote.Command) (*CheckTransactionStateHeader, error) {
+	tranStateTableOffset, err := strconv.ParseInt(cmd.ExtFields["tranStateTableOffset"], 10, 64)
+	if err != nil {
+		return nil, remote.DataError(err)
+	}
+
+	commitLogOffset, err := strconv.ParseInt(cmd.ExtFields["commitLogOffset"], 10, 64)
+	if err != nil {
+		return nil, remote.DataError(err)
+	}
+
+	return &CheckTransactionStateHeader{
+		TranStateTableOffset: tranStateTableOffset,
+		CommitLogOffset:      commitLogOffset,
+		MsgID:                cmd.ExtFields["msgId"],
+		TransactionID:        cmd.ExtFields["transactionId"],
+		OffsetMsgID:          cmd.ExtFields["offsetMsgId"],
+	}, nil
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zjykzk/rocketmq-client-go/admin"
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/message"
+	"github.com/zjykzk/rocketmq-client-go/tool/command"
+)
+
+func init() {
+	cmd := &dlqBrowse{}
+	flags := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	flags.StringVar(&cmd.group, "g", "", "consumer group")
+	flags.StringVar(&cmd.broker, "b", "", "broker name")
+	flags.IntVar(&cmd.queueID, "q", 0, "queue id")
+	flags.Int64Var(&cmd.offset, "o", 0, "offset")
+	flags.IntVar(&cmd.maxCount, "m", 32, "max count")
+	flags.StringVar(&cmd.namesrvAddrs, "n", "", "name servers")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", cmd.Name())
+		flags.PrintDefaults()
+	}
+
+	cmd.flags = flags
+
+	command.RegisterCommand(cmd)
+}
+
+type dlqBrowse struct {
+	group        string
+	broker       string
+	queueID      int
+	offset       int64
+	maxCount     int
+	namesrvAddrs string
+
+	flags *flag.FlagSet
+}
+
+func (d *dlqBrowse) Name() string {
+	return "dlqBrowse"
+}
+
+func (d *dlqBrowse) Run(args []string) {
+	d.flags.Parse(args)
+
+	if len(d.group) == 0 {
+		fmt.Println("empty group:[" + d.group + "]")
+		d.Usage()
+		return
+	}
+
+	if len(d.broker) == 0 {
+		fmt.Println("empty broker:[" + d.broker + "]")
+		d.Usage()
+		return
+	}
+
+	if len(d.namesrvAddrs) == 0 {
+		fmt.Println("empty namesrv: [" + d.namesrvAddrs + "]")
+		d.Usage()
+		return
+	}
+
+	logger := &log.MockLogger{}
+	a := admin.NewAdmin(strings.Split(d.namesrvAddrs, ","), logger)
+	a.Start()
+	defer a.Shutdown()
+
+	msgs, next, err := a.BrowseDLQ(&message.Queue{
+		Topic:      admin.DLQTopic(d.group),
+		BrokerName: d.broker,
+		QueueID:    uint8(d.queueID),
+	}, d.offset, d.maxCount)
+	if err != nil {
+		fmt.Printf("Error:%v\n", err)
+		return
+	}
+
+	for _, m := range msgs {
+		fmt.Printf("%s\n", m)
+	}
+	fmt.Printf("message count:%d, next offset:%d\n", len(msgs), next)
+}
+
+func (d *dlqBrowse) Usage() {
+	d.flags.Usage()
+}
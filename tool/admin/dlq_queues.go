@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zjykzk/rocketmq-client-go/admin"
+	"github.com/zjykzk/rocketmq-client-go/log"
+	"github.com/zjykzk/rocketmq-client-go/tool/command"
+)
+
+func init() {
+	cmd := &dlqQueues{}
+	flags := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	flags.StringVar(&cmd.group, "g", "", "consumer group")
+	flags.StringVar(&cmd.namesrvAddrs, "n", "", "name servers")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", cmd.Name())
+		flags.PrintDefaults()
+	}
+
+	cmd.flags = flags
+
+	command.RegisterCommand(cmd)
+}
+
+type dlqQueues struct {
+	group        string
+	namesrvAddrs string
+
+	flags *flag.FlagSet
+}
+
+func (d *dlqQueues) Name() string {
+	return "dlqQueues"
+}
+
+func (d *dlqQueues) Run(args []string) {
+	d.flags.Parse(args)
+
+	if len(d.group) == 0 {
+		fmt.Println("empty group:[" + d.group + "]")
+		d.Usage()
+		return
+	}
+
+	if len(d.namesrvAddrs) == 0 {
+		fmt.Println("empty namesrv: [" + d.namesrvAddrs + "]")
+		d.Usage()
+		return
+	}
+
+	logger := &log.MockLogger{}
+	a := admin.NewAdmin(strings.Split(d.namesrvAddrs, ","), logger)
+	a.Start()
+	defer a.Shutdown()
+
+	qs, err := a.DLQQueues(d.group)
+	if err != nil {
+		fmt.Printf("Error:%v\n", err)
+		return
+	}
+
+	fmt.Printf("%-32s %-8s %-16s %-16s\n", "broker", "queue", "min offset", "max offset")
+	for _, q := range qs {
+		fmt.Printf("%-32s %-8d %-16d %-16d\n", q.BrokerName, q.QueueID, q.MinOffset, q.MaxOffset)
+	}
+}
+
+func (d *dlqQueues) Usage() {
+	d.flags.Usage()
+}